@@ -16,12 +16,23 @@ type App struct {
 	Posts        *services.PostModel
 	Comment      *services.CommentModel
 	Sessions     *services.Session
-	Likes        *services.LikeModel
+	Reactions    *services.ReactionModel
+	Reputation   *services.ReputationModel
+	Badges       *services.BadgeModel
+	Follows      *services.FollowModel
+	Watches      *services.WatchModel
+	Messages     *services.MessageModel
 	Category     *services.CategoryModel
 	User         *services.UserModel
-	CommentLikes *services.LikeModelComment
 	Notification *services.Notification
+	Digests      *services.DigestModel
+	Uploads      *services.UploadModel
+	Hub          *services.NotificationHub
+	Live         *services.LiveHub
 	Activity     *services.Activity
+	Search       *services.SearchModel
+	Scores       *services.ScoreModel
+	Permissions  *services.PermissionModel
 }
 
 // GetProjectPath retourne le chemin du répertoire racine du projet
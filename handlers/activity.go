@@ -43,16 +43,20 @@ func (aw *AppWrapper) ActivityPageHandler(w http.ResponseWriter, r *http.Request
 
 	// Pass activities and username to the template
 	data := struct {
-		Activities []models.ActivityPage
-		Username   string
+		Activities     []models.ActivityPage
+		Username       string
+		ReturnTo       string
+		UnreadMessages int
 	}{
-		Activities: activities,
-		Username:   Username,
+		Activities:     activities,
+		Username:       Username,
+		ReturnTo:       r.URL.RequestURI(),
+		UnreadMessages: aw.unreadMessages(r),
 	}
 
 	// Load and execute the template
 	templatePath := filepath.Join(projectPath, "templates", "page.activity.html")
-	t, err := template.ParseFiles(templatePath)
+	t, err := template.New("page.activity.html").Funcs(contentFuncs).ParseFiles(templatePath)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,175 @@
+package handlers
+
+//Description : Administration des catégories (création, renommage, fusion, ordre, archivage, sous-catégories).
+//
+//    Toutes les routes sont réservées aux administrateurs.
+
+import (
+	"errors"
+	"forum/services"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+)
+
+// AdminCategories affiche la liste des catégories, archivées comprises, avec les formulaires d'administration.
+func (aw AppWrapper) AdminCategories(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	categories, err := aw.App.Category.GetAllCategoryForAdmin()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"categories": categories,
+	}
+
+	templatePath := filepath.Join(projectPath, "templates", "page.admincategories.html")
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = t.Execute(w, data)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CreateCategory ajoute une nouvelle catégorie.
+func (aw AppWrapper) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	parentID, err := parentIDFromForm(r)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid parent category")
+		return
+	}
+
+	_, err = aw.App.Category.CreateCategory(r.FormValue("name"), r.FormValue("description"),
+		r.FormValue("color"), r.FormValue("icon"), parentID)
+	aw.finishCategoryAction(w, r, err)
+}
+
+// UpdateCategory renomme une catégorie et met à jour sa description, sa couleur et son icône.
+func (aw AppWrapper) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+
+	err = aw.App.Category.UpdateCategory(id, r.FormValue("name"), r.FormValue("description"),
+		r.FormValue("color"), r.FormValue("icon"))
+	aw.finishCategoryAction(w, r, err)
+}
+
+// SetCategoryParent place une catégorie sous une autre catégorie, ou à la racine avec parent=0.
+func (aw AppWrapper) SetCategoryParent(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+	parentID, err := parentIDFromForm(r)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid parent category")
+		return
+	}
+
+	err = aw.App.Category.SetParent(id, parentID)
+	aw.finishCategoryAction(w, r, err)
+}
+
+// MoveCategory monte ou descend une catégorie dans la liste.
+func (aw AppWrapper) MoveCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+
+	err = aw.App.Category.MoveCategory(id, r.FormValue("direction") == "up")
+	aw.finishCategoryAction(w, r, err)
+}
+
+// ArchiveCategory archive (archived=1) ou restaure (archived=0) une catégorie.
+func (aw AppWrapper) ArchiveCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+
+	err = aw.App.Category.SetArchived(id, r.FormValue("archived") == "1")
+	aw.finishCategoryAction(w, r, err)
+}
+
+// MergeCategory déplace les posts d'une catégorie vers la catégorie cible puis supprime la première.
+func (aw AppWrapper) MergeCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+	target, err := strconv.Atoi(r.FormValue("target"))
+	if err != nil || target == id {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Please choose another category to merge into")
+		return
+	}
+
+	err = aw.App.Category.MergeCategories(id, target)
+	aw.finishCategoryAction(w, r, err)
+}
+
+// finishCategoryAction traduit l'erreur éventuelle d'une action d'administration, sinon revient à la liste.
+func (aw AppWrapper) finishCategoryAction(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == nil:
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+	case errors.Is(err, services.ErrCategoryNotFound):
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidCategory), errors.Is(err, services.ErrCategoryExists),
+		errors.Is(err, services.ErrCategoryCycle), errors.Is(err, services.ErrCategoryRules):
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+	default:
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parentIDFromForm lit la catégorie parente choisie ; vide ou 0 désigne la racine.
+func parentIDFromForm(r *http.Request) (int, error) {
+	value := r.FormValue("parent")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+//Description : Administration des droits d'accès aux catégories et des groupes d'utilisateurs.
+//
+//    Une règle accorde une action (lecture, création de posts, commentaires) dans une catégorie
+//    à un rôle minimum ou à un groupe. Toutes les routes sont réservées aux administrateurs.
+
+import (
+	"errors"
+	"forum/services"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AdminPermissions affiche les règles d'accès par catégorie et les groupes d'utilisateurs.
+func (aw AppWrapper) AdminPermissions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	rules, err := aw.App.Permissions.Rules()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	groups, err := aw.App.Permissions.Groups()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	categories, err := aw.App.Category.GetAllCategoryForAdmin()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"rules":      rules,
+		"groups":     groups,
+		"categories": categories,
+		"roles":      []string{"guest", "user", "moderator", "admin"},
+		"privileges": aw.App.Reputation.Rules.Privileges,
+	}
+
+	templatePath := filepath.Join(projectPath, "templates", "page.adminpermissions.html")
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = t.Execute(w, data)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// AddPermission ajoute une règle. Le champ "subject" vaut "role:<rôle>" ou "group:<id>".
+func (aw AppWrapper) AddPermission(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	catID, err := strconv.Atoi(r.FormValue("category"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid category id")
+		return
+	}
+
+	var role string
+	var groupID int
+	kind, value, _ := strings.Cut(r.FormValue("subject"), ":")
+	switch kind {
+	case "role":
+		role = value
+	case "group":
+		groupID, err = strconv.Atoi(value)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid group id")
+			return
+		}
+	default:
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Please choose a role or a group")
+		return
+	}
+
+	err = aw.App.Permissions.AddRule(catID, r.FormValue("action"), role, groupID)
+	aw.finishPermissionAction(w, r, err)
+}
+
+// DeletePermission supprime une règle.
+func (aw AppWrapper) DeletePermission(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid permission id")
+		return
+	}
+
+	err = aw.App.Permissions.DeleteRule(id)
+	aw.finishPermissionAction(w, r, err)
+}
+
+// CreateGroup crée un groupe d'utilisateurs.
+func (aw AppWrapper) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	_, err := aw.App.Permissions.CreateGroup(r.FormValue("name"))
+	aw.finishPermissionAction(w, r, err)
+}
+
+// DeleteGroup supprime un groupe et les règles qui le concernent.
+func (aw AppWrapper) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid group id")
+		return
+	}
+
+	err = aw.App.Permissions.DeleteGroup(id)
+	aw.finishPermissionAction(w, r, err)
+}
+
+// AddGroupMember ajoute un utilisateur (par son nom) à un groupe.
+func (aw AppWrapper) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid group id")
+		return
+	}
+
+	err = aw.App.Permissions.AddMember(id, r.FormValue("username"))
+	aw.finishPermissionAction(w, r, err)
+}
+
+// RemoveGroupMember retire un utilisateur d'un groupe.
+func (aw AppWrapper) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid group id")
+		return
+	}
+
+	err = aw.App.Permissions.RemoveMember(id, r.FormValue("user_id"))
+	aw.finishPermissionAction(w, r, err)
+}
+
+// finishPermissionAction traduit l'erreur éventuelle d'une action d'administration, sinon revient à la page.
+func (aw AppWrapper) finishPermissionAction(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == nil:
+		http.Redirect(w, r, "/admin/permissions", http.StatusSeeOther)
+	case errors.Is(err, services.ErrCategoryNotFound), errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidPermission):
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+	default:
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"forum/services"
 	"html/template"
 	"net/http"
 	"path/filepath"
@@ -52,21 +53,57 @@ func (aw AppWrapper) GetAllPostByCat(w http.ResponseWriter, r *http.Request) {
 		username = ""
 	}
 
-	// Récupérer les posts par nom de catégorie
-	posts, err := aw.App.Category.GetPostsByCategoryName(nameCat, sessionID)
+	// Une catégorie que l'utilisateur ne peut pas voir est traitée comme inexistante
+	viewer := aw.viewerID(r)
+	currentCategory, err := aw.App.Category.GetCategoryByName(nameCat)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de la catégorie", http.StatusInternalServerError)
+		return
+	}
+	if currentCategory != nil {
+		canView, err := aw.App.Permissions.Can(viewer, currentCategory.ID, services.ActionView)
+		if err != nil {
+			http.Error(w, "Erreur lors de la récupération de la catégorie", http.StatusInternalServerError)
+			return
+		}
+		if !canView {
+			currentCategory = nil
+		}
+	}
+	if currentCategory == nil {
+		aw.ErrorHandler(w, r, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	// Récupérer les posts par nom de catégorie, avec ceux des sous-catégories si demandé
+	sort := feedSortFromRequest(r)
+	includeSub := r.URL.Query().Get("sub") == "1"
+	posts, err := aw.App.Category.GetPostsByCategoryName(nameCat, viewer, sort, includeSub)
 	if err != nil {
 		http.Error(w, "Erreur lors de la récupération des posts", http.StatusInternalServerError)
 		return
 	}
 
 	// Récupérer toutes les catégories pour l'affichage (par exemple, pour un menu de navigation)
-	categories, err := aw.App.Category.GetAllCategory()
+	categories, err := aw.App.Category.GetAllCategory(viewer)
 	if err != nil {
 		http.Error(w, "Erreur lors de la récupération des catégories", http.StatusInternalServerError)
 		return
 	}
 
-	currentCategory, err := aw.App.Category.GetCategoryByName(nameCat)
+	// Fil d'Ariane et sous-catégories directes
+	breadcrumbs, err := aw.App.Category.GetBreadcrumbs(currentCategory.ID)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération de la catégorie", http.StatusInternalServerError)
+		return
+	}
+	subcategories, err := aw.App.Category.GetSubcategories(currentCategory.ID, viewer)
+	if err != nil {
+		http.Error(w, "Erreur lors de la récupération des catégories", http.StatusInternalServerError)
+		return
+	}
+
+	watching, err := aw.App.Watches.IsWatching(viewer, services.TargetCategory, currentCategory.ID)
 	if err != nil {
 		http.Error(w, "Erreur lors de la récupération de la catégorie", http.StatusInternalServerError)
 		return
@@ -74,14 +111,20 @@ func (aw AppWrapper) GetAllPostByCat(w http.ResponseWriter, r *http.Request) {
 
 	// Préparer les données à passer au template
 	data := map[string]interface{}{
-		"category":   currentCategory, // Catégorie courante
-		"posts":      posts,           // Liste des posts
-		"categories": categories,      // Toutes les catégories
-		"username":   username,        // Nom d'utilisateur connecté
+		"category":      currentCategory, // Catégorie courante
+		"posts":         posts,           // Liste des posts
+		"categories":    categories,      // Toutes les catégories
+		"username":      username,        // Nom d'utilisateur connecté
+		"sort":          sort,            // Tri courant
+		"includeSub":    includeSub,      // Posts des sous-catégories inclus
+		"breadcrumbs":   breadcrumbs,     // Ancêtres de la catégorie, racine en premier
+		"subcategories": subcategories,   // Sous-catégories directes
+		"watching":      watching,        // Visiteur abonné aux nouveaux posts de la catégorie
+		"returnTo":      r.URL.RequestURI(),
 	}
 
 	templatePath := filepath.Join(projectPath, "templates", "page.categoryname.html")
-	t, err := template.ParseFiles(templatePath)
+	t, err := template.New("page.categoryname.html").Funcs(contentFuncs).ParseFiles(templatePath)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -7,7 +7,10 @@ package handlers
 //    Vérifier que seuls les utilisateurs enregistrés peuvent commenter.
 
 import (
+	"errors"
 	"fmt"
+	"forum/services"
+	"log"
 	"net/http"
 	"strconv"
 )
@@ -40,31 +43,71 @@ func (aw AppWrapper) HandlerCommentStore(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	author, err := r.Cookie("userID")
-	if err != nil {
+	// Réponse à un autre commentaire du post, ou commentaire de premier niveau
+	parentID := 0
+	if value := r.PostFormValue("parent_id"); value != "" {
+		parentID, err = strconv.Atoi(value)
+		if err != nil || parentID <= 0 {
+			http.Error(w, "Invalid parent comment ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// L'auteur est identifié par sa session : les droits de commenter en dépendent
+	sessionId := aw.viewerID(r)
+	if sessionId == "" {
 		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
 	}
-	sessionId := author.Value
 
 	// Declare commentID
 	var commentID int
 
 	// Insertion du commentaire dans la base de données avec un postId en int
-	commentID, err = aw.App.Comment.CommentInsert(id, content, sessionId)
-	if err != nil {
+	commentID, err = aw.App.Comment.CommentInsert(id, parentID, content, sessionId)
+	if errors.Is(err, services.ErrForbidden) {
+		http.Error(w, "You are not allowed to comment in this category", http.StatusForbidden)
+		return
+	} else if errors.Is(err, services.ErrPostNotFound) || errors.Is(err, services.ErrCommentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, services.ErrReplyTooDeep) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, services.ErrPostLocked) || errors.Is(err, services.ErrPostArchived) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
 		http.Error(w, "Unable to submit comment, please try again later", http.StatusInternalServerError)
 		return
 	}
 
 	fmt.Println(commentID)
 
+	if err := aw.App.Scores.RefreshPost(id); err != nil {
+		log.Printf("Erreur lors de la mise à jour du score du post %d: %v", id, err)
+	}
+
 	// Add notification using the comment ID
 	err = aw.App.Notification.AddCommentNotification(commentID)
 	if err != nil {
 		http.Error(w, "Unable to add notification, please try again later", http.StatusInternalServerError)
 		return
 	}
+	if parentID != 0 {
+		err = aw.App.Notification.AddReplyNotification(commentID)
+		if err != nil {
+			http.Error(w, "Unable to add notification, please try again later", http.StatusInternalServerError)
+			return
+		}
+	}
+	// Commenter abonne au post, puis les abonnés du post et de ses catégories sont prévenus
+	if err := aw.App.Watches.AutoWatch(sessionId, id); err != nil {
+		log.Printf("Erreur lors de l'abonnement au post %d: %v", id, err)
+	}
+	if _, err := aw.App.Watches.NotifyComment(commentID); err != nil {
+		log.Printf("Erreur lors de la notification des abonnés du post %d: %v", id, err)
+	}
 	// Add activity
 	err = aw.App.Activity.CreateActivity(sessionId, "comment", id, commentID)
 	if err != nil {
@@ -72,8 +115,49 @@ func (aw AppWrapper) HandlerCommentStore(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Redirection après insertion
-	http.Redirect(w, r, fmt.Sprintf("/post/direct/%d", id), http.StatusSeeOther)
+	// Redirection après insertion, vers le nouveau commentaire
+	http.Redirect(w, r, fmt.Sprintf("/comment/%d", commentID), http.StatusSeeOther)
+}
+
+// CommentPermalink redirige le lien permanent d'un commentaire vers la page du post où il apparaît,
+// ancré sur le commentaire. Le paramètre "sort" choisit le tri des commentaires.
+func (aw AppWrapper) CommentPermalink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+
+	sort := commentSortFromRequest(r)
+	postId, page, err := aw.App.Comment.Locate(id, sort)
+	if errors.Is(err, services.ErrCommentNotFound) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Un commentaire d'un post invisible pour l'utilisateur n'existe pas pour lui
+	err = aw.App.Permissions.CheckPost(aw.viewerID(r), postId, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, services.ErrCommentNotFound.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/direct/%d?sort=%s&page=%d#comment-%d", postId, sort, page, id), http.StatusSeeOther)
+}
+
+// commentSortFromRequest lit le paramètre "sort" des commentaires : "newest" (par défaut), "oldest" ou "best".
+func commentSortFromRequest(r *http.Request) string {
+	switch sort := r.URL.Query().Get("sort"); sort {
+	case "oldest", "best":
+		return sort
+	}
+	return "newest"
 }
 
 func (aw AppWrapper) DeleteComment(w http.ResponseWriter, r *http.Request) {
@@ -107,6 +191,10 @@ func (aw AppWrapper) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := aw.App.Scores.RefreshPost(postId); err != nil {
+		log.Printf("Erreur lors de la mise à jour du score du post %d: %v", postId, err)
+	}
+
 	// Delete activity
 	commentID, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -1,47 +1,274 @@
-// config.go
-package handlers
-
-import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
-	"os"
-)
-
-type Config struct {
-	GithubClientID     string `json:"github_client_id"`
-	GithubClientSecret string `json:"github_client_secret"`
-	GoogleClientID     string `json:"google_client_id"`
-	GoogleClientSecret string `json:"google_client_secret"`
-}
-
-var AppConfig Config
-
-func LoadConfig() {
-	log.Println("Début du chargement de la configuration...")
-	file, err := ioutil.ReadFile("config.json")
-	if err != nil {
-		log.Printf("Erreur lors de la lecture du fichier config.json: %v", err)
-		log.Fatal("Chemin actuel:", getCurrentPath())
-		return
-	}
-
-	log.Printf("Contenu du fichier config.json: %s", string(file))
-
-	err = json.Unmarshal(file, &AppConfig)
-	if err != nil {
-		log.Fatal("Erreur lors du parsing du fichier config.json:", err)
-		return
-	}
-
-	log.Printf("Configuration chargée: %+v", AppConfig)
-}
-
-func getCurrentPath() string {
-	dir, err := os.Getwd()
-	if err != nil {
-		log.Printf("Erreur lors de la récupération du chemin: %v", err)
-		return ""
-	}
-	return dir
-}
+// config.go
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/models"
+	"forum/services"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	GithubClientID     string `json:"github_client_id"`
+	GithubClientSecret string `json:"github_client_secret"`
+	GoogleClientID     string `json:"google_client_id"`
+	GoogleClientSecret string `json:"google_client_secret"`
+	ArchiveAfterDays   int    `json:"archive_after_days"` // 0 : valeur par défaut, négatif : désactivé
+	MaxReplyDepth      int    `json:"max_reply_depth"`    // 0 : valeur par défaut, négatif : pas de réponses
+	// Réactions proposées en plus de like et dislike ; vide : réactions par défaut
+	Reactions []models.ReactionKind `json:"reactions"`
+	// Poids des votes, plafond quotidien et seuils des privilèges ; les clés absentes gardent leur valeur par défaut
+	Reputation models.ReputationRules `json:"reputation"`
+	// Badges attribués automatiquement ; vide : badges par défaut
+	Badges []models.BadgeRule `json:"badges"`
+	// Notifications de nouveaux posts des utilisateurs suivis reçues au plus par jour ; 0 : valeur par défaut, négatif : désactivées
+	FollowNotificationsPerDay int `json:"follow_notifications_per_day"`
+	// Flux de notifications en temps réel ouverts en même temps par un utilisateur ; 0 : valeur par défaut, négatif : pas de limite
+	NotificationStreamsPerUser int `json:"notification_streams_per_user"`
+	// Jours de conservation des notifications lues ; 0 : valeur par défaut, négatif : conservées indéfiniment
+	NotificationRetentionDays int `json:"notification_retention_days"`
+	// Images traitées en parallèle après un upload ; 0 : valeur par défaut, négatif : traitées pendant la requête
+	ImageWorkers int `json:"image_workers"`
+	// Envoi des emails : résumés et notifications du canal email
+	Mail MailConfig `json:"mail"`
+	// Stockage des images envoyées : dossier local ou service compatible S3
+	Storage StorageConfig `json:"storage"`
+}
+
+// MailConfig règle l'envoi des emails ; sans smtp_addr, ils sont écrits dans le dossier dir.
+type MailConfig struct {
+	From     string `json:"from"`      // expéditeur ; vide : valeur par défaut
+	SMTPAddr string `json:"smtp_addr"` // serveur SMTP (hôte:port) sans authentification, par exemple un relais local
+	Dir      string `json:"dir"`       // dossier des emails sans serveur SMTP ; vide : valeur par défaut
+	BaseURL  string `json:"base_url"`  // adresse publique du forum pour les liens des emails ; vide : valeur par défaut
+	Secret   string `json:"secret"`    // clé de signature des liens de désabonnement
+}
+
+// StorageConfig choisit où sont conservées les images envoyées ; backend "local" (par défaut) ou "s3".
+type StorageConfig struct {
+	Backend  string `json:"backend"`
+	Dir      string `json:"dir"`      // dossier du stockage local ; vide : valeur par défaut
+	Secret   string `json:"secret"`   // clé de signature des liens du stockage local
+	Redirect bool   `json:"redirect"` // rediriger vers un lien signé au lieu de relayer les images
+	// Service compatible S3 (AWS S3, MinIO...)
+	Endpoint  string `json:"endpoint"` // par exemple http://localhost:9000
+	Region    string `json:"region"`   // vide : us-east-1
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	PathStyle bool   `json:"path_style"` // bucket dans le chemin plutôt que dans le nom d'hôte, comme l'attend MinIO
+}
+
+// defaultArchiveAfterDays est le délai d'inactivité avant archivage quand config.json ne le précise pas.
+const defaultArchiveAfterDays = 90
+
+// ArchiveDays retourne le nombre de jours sans activité avant l'archivage automatique d'un fil,
+// ou 0 si l'archivage automatique est désactivé.
+func (c Config) ArchiveDays() int {
+	switch {
+	case c.ArchiveAfterDays < 0:
+		return 0
+	case c.ArchiveAfterDays == 0:
+		return defaultArchiveAfterDays
+	}
+	return c.ArchiveAfterDays
+}
+
+// defaultMaxReplyDepth est la profondeur maximale des réponses quand config.json ne la précise pas.
+const defaultMaxReplyDepth = 5
+
+// ReplyDepth retourne la profondeur maximale d'une réponse à un commentaire, ou 0 si les réponses sont désactivées.
+func (c Config) ReplyDepth() int {
+	switch {
+	case c.MaxReplyDepth < 0:
+		return 0
+	case c.MaxReplyDepth == 0:
+		return defaultMaxReplyDepth
+	}
+	return c.MaxReplyDepth
+}
+
+// defaultFollowNotificationsPerDay est la limite quotidienne des notifications de nouveaux posts
+// quand config.json ne la précise pas.
+const defaultFollowNotificationsPerDay = 20
+
+// FollowNotificationLimit retourne le nombre de notifications de nouveaux posts qu'un abonné reçoit
+// au plus par jour, ou 0 si ces notifications sont désactivées.
+func (c Config) FollowNotificationLimit() int {
+	switch {
+	case c.FollowNotificationsPerDay < 0:
+		return 0
+	case c.FollowNotificationsPerDay == 0:
+		return defaultFollowNotificationsPerDay
+	}
+	return c.FollowNotificationsPerDay
+}
+
+// defaultNotificationStreamsPerUser est le nombre de flux de notifications simultanés par utilisateur
+// quand config.json ne le précise pas : quelques onglets ouverts.
+const defaultNotificationStreamsPerUser = 5
+
+// NotificationStreamLimit retourne le nombre de flux de notifications qu'un utilisateur peut ouvrir
+// en même temps, ou 0 s'il n'y a pas de limite.
+func (c Config) NotificationStreamLimit() int {
+	switch {
+	case c.NotificationStreamsPerUser < 0:
+		return 0
+	case c.NotificationStreamsPerUser == 0:
+		return defaultNotificationStreamsPerUser
+	}
+	return c.NotificationStreamsPerUser
+}
+
+// defaultNotificationRetentionDays est la durée de conservation des notifications lues
+// quand config.json ne la précise pas.
+const defaultNotificationRetentionDays = 30
+
+// NotificationRetention retourne le nombre de jours après lequel une notification lue est supprimée,
+// ou 0 si les notifications sont conservées indéfiniment.
+func (c Config) NotificationRetention() int {
+	switch {
+	case c.NotificationRetentionDays < 0:
+		return 0
+	case c.NotificationRetentionDays == 0:
+		return defaultNotificationRetentionDays
+	}
+	return c.NotificationRetentionDays
+}
+
+// defaultImageWorkers est le nombre d'images traitées en parallèle quand config.json ne le précise pas.
+const defaultImageWorkers = 2
+
+// ImageWorkerCount retourne le nombre d'images traitées en parallèle, ou 0 si elles sont traitées
+// pendant la requête d'upload.
+func (c Config) ImageWorkerCount() int {
+	switch {
+	case c.ImageWorkers < 0:
+		return 0
+	case c.ImageWorkers == 0:
+		return defaultImageWorkers
+	}
+	return c.ImageWorkers
+}
+
+// Valeurs par défaut de l'envoi des emails quand config.json ne les précise pas.
+const (
+	defaultMailFrom = "forum@localhost"
+	defaultMailDir  = "mail"
+	defaultSiteURL  = "https://localhost:8080"
+)
+
+// Mailer retourne l'envoi des emails configuré : le serveur SMTP s'il est donné, sinon des fichiers .eml.
+func (c Config) Mailer() services.Mailer {
+	from := c.Mail.From
+	if from == "" {
+		from = defaultMailFrom
+	}
+	if c.Mail.SMTPAddr != "" {
+		return &services.SMTPMailer{Addr: c.Mail.SMTPAddr, From: from}
+	}
+	dir := c.Mail.Dir
+	if dir == "" {
+		dir = defaultMailDir
+	}
+	return &services.FileMailer{Dir: dir, From: from}
+}
+
+// SiteURL retourne l'adresse publique du forum, sans "/" final, utilisée dans les emails.
+func (c Config) SiteURL() string {
+	if c.Mail.BaseURL == "" {
+		return defaultSiteURL
+	}
+	return strings.TrimSuffix(c.Mail.BaseURL, "/")
+}
+
+// MailSecret retourne la clé de signature des liens de désabonnement. Sans clé dans config.json,
+// une clé aléatoire est tirée : les liens déjà envoyés ne fonctionnent plus après un redémarrage.
+func (c Config) MailSecret() []byte {
+	if c.Mail.Secret != "" {
+		return []byte(c.Mail.Secret)
+	}
+	log.Println("Aucune clé mail.secret dans config.json : les liens de désabonnement changeront au redémarrage")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("Erreur lors de la génération de la clé des liens de désabonnement:", err)
+	}
+	return secret
+}
+
+// defaultStorageDir est le dossier du stockage local quand config.json ne le précise pas.
+const defaultStorageDir = "uploads"
+
+// MediaStorage retourne le stockage des images envoyées configuré : un service compatible S3
+// ou, par défaut, un dossier local dont les liens signés sont servis sous /media.
+func (c Config) MediaStorage() (services.Storage, error) {
+	switch c.Storage.Backend {
+	case "", "local":
+		dir := c.Storage.Dir
+		if dir == "" {
+			dir = defaultStorageDir
+		}
+		secret := []byte(c.Storage.Secret)
+		if len(secret) == 0 {
+			// Les liens signés ne servent qu'aux redirections, valables quelques minutes
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+		}
+		return &services.LocalStorage{Dir: dir, URL: "/media", Secret: secret}, nil
+	case "s3":
+		if c.Storage.Endpoint == "" || c.Storage.Bucket == "" || c.Storage.AccessKey == "" || c.Storage.SecretKey == "" {
+			return nil, errors.New("storage: endpoint, bucket, access_key and secret_key are required for the s3 backend")
+		}
+		return &services.S3Storage{
+			Endpoint:  c.Storage.Endpoint,
+			Region:    c.Storage.Region,
+			Bucket:    c.Storage.Bucket,
+			AccessKey: c.Storage.AccessKey,
+			SecretKey: c.Storage.SecretKey,
+			PathStyle: c.Storage.PathStyle,
+			Client:    &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	}
+	return nil, fmt.Errorf("storage: unknown backend %q", c.Storage.Backend)
+}
+
+var AppConfig = Config{Reputation: services.DefaultReputationRules()}
+
+func LoadConfig() {
+	log.Println("Début du chargement de la configuration...")
+	file, err := ioutil.ReadFile("config.json")
+	if err != nil {
+		log.Printf("Erreur lors de la lecture du fichier config.json: %v", err)
+		log.Fatal("Chemin actuel:", getCurrentPath())
+		return
+	}
+
+	log.Printf("Contenu du fichier config.json: %s", string(file))
+
+	err = json.Unmarshal(file, &AppConfig)
+	if err != nil {
+		log.Fatal("Erreur lors du parsing du fichier config.json:", err)
+		return
+	}
+
+	log.Printf("Configuration chargée: %+v", AppConfig)
+}
+
+func getCurrentPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du chemin: %v", err)
+		return ""
+	}
+	return dir
+}
@@ -0,0 +1,49 @@
+package handlers
+
+//Description : Désabonnement du résumé par email : le lien signé de chaque résumé mène à
+//
+//    GET /digest/unsubscribe, qui demande confirmation ; POST /digest/unsubscribe désactive le résumé,
+//    sans connexion. Les clients mail qui gèrent List-Unsubscribe-Post font ce POST en un clic.
+
+import (
+	"errors"
+	"forum/services"
+	"html/template"
+	"net/http"
+	"path/filepath"
+)
+
+// DigestUnsubscribe affiche la confirmation du désabonnement d'un lien de résumé.
+func (aw AppWrapper) DigestUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	userId, token := r.URL.Query().Get("user"), r.URL.Query().Get("token")
+	if err := aw.App.Digests.CheckUnsubscribe(userId, token); err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	aw.renderUnsubscribe(w, r, map[string]interface{}{"user": userId, "token": token})
+}
+
+// ConfirmDigestUnsubscribe désactive le résumé de l'utilisateur du lien ; user et token viennent
+// du formulaire ou de l'URL (désabonnement en un clic).
+func (aw AppWrapper) ConfirmDigestUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	err := aw.App.Digests.Unsubscribe(r.FormValue("user"), r.FormValue("token"))
+	if errors.Is(err, services.ErrInvalidUnsubscribe) {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	aw.renderUnsubscribe(w, r, map[string]interface{}{"done": true})
+}
+
+func (aw AppWrapper) renderUnsubscribe(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	t, err := template.ParseFiles(filepath.Join(projectPath, "templates", "page.unsubscribe.html"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := t.Execute(w, data); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
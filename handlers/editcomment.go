@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"forum/services"
 	"html/template"
 	"net/http"
 	"path/filepath"
@@ -65,7 +66,10 @@ func (aw AppWrapper) EditComment(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		err = aw.App.Comment.Update(id, content)
-		if err != nil {
+		if errors.Is(err, services.ErrPostArchived) {
+			aw.ErrorHandler(w, r, http.StatusForbidden, err.Error())
+			return
+		} else if err != nil {
 			http.Error(w, "Unable to update comment, please try again later", http.StatusInternalServerError)
 			return
 		}
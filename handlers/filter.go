@@ -1,7 +1,105 @@
 package handlers
 
 //Description : Gestion des filtres de posts (par catégorie, par likes, par utilisateur).
-//À faire :
 //
-//    Gérer les requêtes pour filtrer les posts selon différentes conditions (catégories, likes/dislikes, posts créés par l'utilisateur).
-//    Assurer que certaines options de filtrage ne sont disponibles que pour les utilisateurs connectés.
+//    Un seul point d'entrée combine les catégories (toutes ou au moins une), l'auteur,
+//    les posts aimés ou créés par l'utilisateur connecté, une période et un score minimum.
+//    Les filtres réservés aux utilisateurs connectés sont vérifiés dans le service.
+
+import (
+	"errors"
+	"forum/models"
+	"forum/services"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FilterPosts affiche les posts correspondant aux filtres passés en paramètres de l'URL.
+func (aw AppWrapper) FilterPosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		aw.ErrorHandler(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// L'utilisateur est identifié par sa session pour les filtres personnels
+	var userId, username string
+	sessionCookie, err := r.Cookie("session_token")
+	if err == nil && sessionCookie.Value != "" {
+		userId, err = aw.App.Sessions.GetUserID(sessionCookie.Value)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+		username, err = aw.App.Sessions.GetUsername(sessionCookie.Value)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	params := r.URL.Query()
+	filter := models.PostFilter{
+		Categories:  params["category"],
+		MatchAll:    params.Get("match") == "all",
+		Author:      strings.TrimSpace(params.Get("author")),
+		LikedByMe:   params.Get("liked") == "1",
+		CreatedByMe: params.Get("mine") == "1",
+		Archived:    params.Get("archived") == "1",
+		From:        params.Get("from"),
+		To:          params.Get("to"),
+		Sort:        feedSortFromRequest(r),
+	}
+	if minScore := params.Get("min_score"); minScore != "" {
+		score, err := strconv.Atoi(minScore)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid minimum score")
+			return
+		}
+		filter.MinScore = &score
+	}
+
+	posts, err := aw.App.Posts.Filter(filter, userId)
+	if errors.Is(err, services.ErrLoginRequired) {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in to use this filter")
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	categories, err := aw.App.Category.GetAllCategory(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	selected := map[string]bool{}
+	for _, name := range filter.Categories {
+		selected[name] = true
+	}
+
+	data := map[string]interface{}{
+		"posts":      posts,
+		"username":   username,
+		"categories": categories,
+		"selected":   selected,
+		"filter":     filter,
+		"minScore":   params.Get("min_score"),
+		"returnTo":   r.URL.RequestURI(),
+	}
+
+	templatePath := filepath.Join(projectPath, "templates", "page.filter.html")
+	t, err := template.New("page.filter.html").Funcs(contentFuncs).ParseFiles(templatePath)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = t.Execute(w, data)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+//Description : Abonnements entre utilisateurs : suivre ou ne plus suivre un utilisateur depuis son profil,
+//
+//    régler les notifications de ses nouveaux posts et lister ses abonnés et abonnements.
+
+import (
+	"database/sql"
+	"errors"
+	"forum/services"
+	"html/template"
+	"net/http"
+	"path/filepath"
+)
+
+// FollowUser abonne le visiteur à l'utilisateur {username}.
+func (aw AppWrapper) FollowUser(w http.ResponseWriter, r *http.Request) {
+	viewer, followedID, ok := aw.userTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := aw.App.Follows.Follow(viewer, followedID)
+	if errors.Is(err, services.ErrSelfFollow) {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/profile/"+r.PathValue("username")), http.StatusSeeOther)
+}
+
+// UnfollowUser désabonne le visiteur de l'utilisateur {username}.
+func (aw AppWrapper) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	viewer, followedID, ok := aw.userTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := aw.App.Follows.Unfollow(viewer, followedID); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/profile/"+r.PathValue("username")), http.StatusSeeOther)
+}
+
+// FollowNotify active (notify=on) ou coupe les notifications des nouveaux posts de {username}.
+func (aw AppWrapper) FollowNotify(w http.ResponseWriter, r *http.Request) {
+	viewer, followedID, ok := aw.userTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := aw.App.Follows.SetNotify(viewer, followedID, r.FormValue("notify") == "on"); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/profile/"+r.PathValue("username")), http.StatusSeeOther)
+}
+
+// userTarget retourne le visiteur connecté et l'identifiant de l'utilisateur {username} de l'URL ;
+// en cas d'échec la réponse d'erreur est déjà envoyée et ok vaut false.
+func (aw AppWrapper) userTarget(w http.ResponseWriter, r *http.Request) (viewer, userID string, ok bool) {
+	viewer = aw.viewerID(r)
+	if viewer == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return "", "", false
+	}
+
+	userID, err := aw.App.User.GetUserIdByUsername(r.PathValue("username"))
+	if errors.Is(err, sql.ErrNoRows) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, "User not found")
+		return "", "", false
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return "", "", false
+	}
+	return viewer, userID, true
+}
+
+// Followers affiche les abonnés de {username}.
+func (aw AppWrapper) Followers(w http.ResponseWriter, r *http.Request) {
+	aw.followList(w, r, "followers")
+}
+
+// Following affiche les utilisateurs suivis par {username}.
+func (aw AppWrapper) Following(w http.ResponseWriter, r *http.Request) {
+	aw.followList(w, r, "following")
+}
+
+// followList affiche la liste "followers" ou "following" de {username}.
+func (aw AppWrapper) followList(w http.ResponseWriter, r *http.Request, list string) {
+	username := r.PathValue("username")
+	userID, err := aw.App.User.GetUserIdByUsername(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	users, err := aw.App.Follows.Followers(userID)
+	if list == "following" {
+		users, err = aw.App.Follows.Following(userID)
+	}
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var currentUsername string
+	if viewer := aw.viewerID(r); viewer != "" {
+		currentUsername, _ = aw.App.Sessions.GetUsername2(viewer)
+	}
+
+	data := map[string]interface{}{
+		"Username":        username,
+		"List":            list,
+		"Users":           users,
+		"CurrentUsername": currentUsername,
+		"LoggedIn":        currentUsername != "",
+	}
+
+	templatePath := filepath.Join(projectPath, "templates", "page.follows.html")
+	t, err := template.New("page.follows.html").Funcs(contentFuncs).ParseFiles(templatePath)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := t.Execute(w, data); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
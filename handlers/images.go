@@ -0,0 +1,162 @@
+package handlers
+
+//Description : Images envoyées : attribut srcset des templates et service des images depuis le stockage
+//(dossier local ou service compatible S3), qui attend les images encore en traitement.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"forum/services"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// uploadWait est le temps pendant lequel une image demandée attend la fin de son traitement.
+const uploadWait = 10 * time.Second
+
+// mediaLinkExpiry est la durée de validité des liens signés vers lesquels les images sont redirigées
+// quand storage.redirect est activé.
+const mediaLinkExpiry = 15 * time.Minute
+
+// uploadKinds associe les dossiers de static/ aux types d'upload.
+var uploadKinds = map[string]string{
+	"images_post":    services.UploadPost,
+	"images_profile": services.UploadProfile,
+}
+
+// imageSrcset retourne le srcset d'une image envoyée ; name est un nom de fichier, éventuellement
+// un pointeur (image facultative d'un post) : {{ with srcset "post" .Image }} srcset="{{ . }}"{{ end }}.
+func imageSrcset(kind string, name interface{}) string {
+	switch name := name.(type) {
+	case string:
+		return services.ImageSrcset(kind, name)
+	case *string:
+		if name != nil {
+			return services.ImageSrcset(kind, *name)
+		}
+	}
+	return ""
+}
+
+// AwaitUpload fait patienter, quelques secondes au plus, une requête de fichier statique qui désigne une
+// image envoyée encore en traitement, pour qu'elle ne reçoive pas une 404 juste après l'upload.
+func (aw AppWrapper) AwaitUpload(r *http.Request) {
+	dir, file := path.Split(strings.TrimPrefix(r.URL.Path, "/static/"))
+	kind, ok := uploadKinds[strings.Trim(dir, "/")]
+	name := services.UploadBaseName(file)
+	if !ok || name == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), uploadWait)
+	defer cancel()
+	aw.App.Uploads.Await(ctx, kind, name)
+}
+
+// ServeUpload sert /static/images_post/{file} et /static/images_profile/{file} : les images envoyées
+// sont lues dans le stockage, ou redirigées vers un lien signé si storage.redirect est activé ;
+// les autres fichiers (image par défaut, anciennes images) restent servis depuis static/.
+func (aw AppWrapper) ServeUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	dir, file := path.Split(strings.TrimPrefix(r.URL.Path, "/static/"))
+	dir = strings.Trim(dir, "/")
+	kind, ok := uploadKinds[dir]
+	if !ok || services.UploadBaseName(file) == "" {
+		http.ServeFile(w, r, filepath.Join("static", dir, file))
+		return
+	}
+
+	// Le nom d'une image envoyée est l'empreinte de son contenu : une copie déjà reçue est toujours à jour
+	etag := `"` + file + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	aw.AwaitUpload(r)
+	storage := aw.App.Uploads.Storage
+	key := services.UploadKey(kind, file)
+	if AppConfig.Storage.Redirect {
+		link, err := storage.SignedURL(key, mediaLinkExpiry)
+		if err != nil {
+			log.Printf("Erreur lors de la signature du lien de %s : %v", key, err)
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, "Image indisponible")
+			return
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(mediaLinkExpiry.Seconds())/2))
+		http.Redirect(w, r, link, http.StatusFound)
+		return
+	}
+
+	body, info, err := storage.Get(r.Context(), key)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		// Image envoyée avant le stockage, restée dans static/, ou introuvable
+		http.ServeFile(w, r, filepath.Join("static", dir, file))
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la lecture de %s : %v", key, err)
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, "Image indisponible")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	writeObject(w, r, body, info)
+}
+
+// ServeMedia sert les liens signés du stockage local (/media/{key...}), vers lesquels ServeUpload
+// redirige quand storage.redirect est activé.
+func (aw AppWrapper) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	local, ok := aw.App.Uploads.Storage.(*services.LocalStorage)
+	if !ok {
+		aw.ErrorHandler(w, r, http.StatusNotFound, "Page non trouvée")
+		return
+	}
+	key := r.PathValue("key")
+	query := r.URL.Query()
+	if err := local.Verify(key, query.Get("expires"), query.Get("signature")); err != nil {
+		aw.ErrorHandler(w, r, http.StatusForbidden, "Lien invalide ou expiré")
+		return
+	}
+
+	body, info, err := local.Get(r.Context(), key)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, "Image introuvable")
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la lecture de %s : %v", key, err)
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, "Image indisponible")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	writeObject(w, r, body, info)
+}
+
+// writeObject écrit un fichier du stockage dans la réponse, sans son contenu pour une requête HEAD.
+func writeObject(w http.ResponseWriter, r *http.Request, body io.Reader, info services.ObjectInfo) {
+	w.Header().Set("Content-Type", info.ContentType)
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(info.Size))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Erreur lors de l'envoi d'une image : %v", err)
+	}
+}
@@ -37,7 +37,7 @@ func (aw AppWrapper) LikedPagePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category, err := aw.App.Category.GetAllCategory()
+	category, err := aw.App.Category.GetAllCategory(aw.viewerID(r))
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -48,11 +48,12 @@ func (aw AppWrapper) LikedPagePost(w http.ResponseWriter, r *http.Request) {
 		"posts":    posts,
 		"username": username,
 		"category": category,
+		"returnTo": r.URL.RequestURI(),
 	}
 
 	// Load the HTML template
 	templatePath := filepath.Join(projectPath, "templates", "page.likepost.html")
-	t, err := template.ParseFiles(templatePath)
+	t, err := template.New("page.likepost.html").Funcs(contentFuncs).ParseFiles(templatePath)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,185 @@
+package handlers
+
+//Description : Page d'un post en direct : GET /post/stream/{id} pousse en Server-Sent Events les nouveaux
+//
+//    commentaires, les modifications, les suppressions, les compteurs de réactions, le nombre de visiteurs
+//    et qui est en train d'écrire (signalé par POST /post/typing/{id}). Un nouveau commentaire est inséré
+//    dans la page avec le rendu de GET /comment/{id}/fragment.
+
+import (
+	"errors"
+	"fmt"
+	"forum/models"
+	"forum/services"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PostStream pousse les événements du post {id} à un visiteur, connecté ou non.
+func (aw AppWrapper) PostStream(w http.ResponseWriter, r *http.Request) {
+	userId, postId, ok := aw.livePost(w, r)
+	if !ok {
+		return
+	}
+
+	lastSeq, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	stream, missed, stale := aw.App.Live.Subscribe(postId, userId, lastSeq)
+	defer aw.App.Live.Unsubscribe(stream)
+
+	rc := openEventStream(w)
+	if stale {
+		if err := writeLiveEvent(w, models.LiveEvent{Type: models.LiveStale}); err != nil {
+			return
+		}
+	}
+	for _, event := range missed {
+		if err := writeLiveEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-stream.Events:
+			if !open {
+				// Flux retiré par le hub (visiteur trop lent) : le navigateur se reconnectera
+				return
+			}
+			if err := writeLiveEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// PostTyping signale aux autres visiteurs du post {id} que le visiteur écrit un commentaire.
+func (aw AppWrapper) PostTyping(w http.ResponseWriter, r *http.Request) {
+	userId, postId, ok := aw.livePost(w, r)
+	if !ok {
+		return
+	}
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	username, err := aw.App.Sessions.GetUsername2(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	aw.App.Live.Typing(postId, userId, username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CommentFragment affiche un commentaire seul, tel qu'il apparaît dans la page de son post,
+// pour l'insérer dans une page déjà ouverte.
+func (aw AppWrapper) CommentFragment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+	userId := aw.viewerID(r)
+
+	comment, err := aw.App.Comment.GetComment(id, userId)
+	if errors.Is(err, services.ErrCommentNotFound) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Un commentaire d'un post invisible pour l'utilisateur n'existe pas pour lui
+	err = aw.App.Permissions.CheckPost(userId, comment.PostID, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, services.ErrCommentNotFound.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	post, err := aw.App.Posts.GetPostUser(strconv.Itoa(comment.PostID), userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var username string
+	if userId != "" {
+		username, _ = aw.App.Sessions.GetUsername2(userId)
+	}
+
+	t, err := postTemplate()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	page := map[string]interface{}{
+		"userId":        userId,
+		"username":      username,
+		"canReply":      username != "" && !post.Locked && !post.Archived,
+		"maxReplyDepth": aw.App.Comment.MaxDepth,
+		"reactionKinds": aw.App.Reactions.Available(),
+		"returnTo":      fmt.Sprintf("/post/direct/%d", comment.PostID),
+	}
+	if err := t.ExecuteTemplate(w, "comment", commentNode(comment, page)); err != nil {
+		log.Printf("Erreur lors du rendu du commentaire %d: %v", id, err)
+	}
+}
+
+// livePost retourne le visiteur ("" s'il n'est pas connecté) et le post {id} de l'URL s'il peut le voir ;
+// en cas d'échec la réponse d'erreur est déjà envoyée et ok vaut false.
+func (aw AppWrapper) livePost(w http.ResponseWriter, r *http.Request) (userId string, postId int, ok bool) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || postId <= 0 {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid post id")
+		return "", 0, false
+	}
+	userId = aw.viewerID(r)
+
+	// Un post invisible pour l'utilisateur n'existe pas pour lui
+	if _, err := aw.App.Posts.GetPostByID(postId); errors.Is(err, services.ErrPostNotFound) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+		return "", 0, false
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return "", 0, false
+	}
+	err = aw.App.Permissions.CheckPost(userId, postId, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, services.ErrPostNotFound.Error())
+		return "", 0, false
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return "", 0, false
+	}
+	return userId, postId, true
+}
+
+// writeLiveEvent écrit un événement de post ; seuls les événements numérotés portent un identifiant.
+func writeLiveEvent(w http.ResponseWriter, event models.LiveEvent) error {
+	id := ""
+	if event.Seq > 0 {
+		id = strconv.Itoa(event.Seq)
+	}
+	return writeStreamEvent(w, event.Type, id, event)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+//Description : Mentions @username : liens vers les profils dans le contenu affiché
+//et suggestions de noms (GET /users/suggest?q=) pour l'autocomplétion des formulaires.
+
+import (
+	"forum/services"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxUserSuggestions est le nombre de noms proposés par /users/suggest.
+const maxUserSuggestions = 8
+
+// contentFuncs ajoute aux templates qui affichent des posts, des commentaires ou des images envoyées
+// {{ mentions .Content }} et {{ srcset "post" .Image }} (voir imageSrcset).
+var contentFuncs = template.FuncMap{
+	"mentions": renderMentions,
+	"srcset":   imageSrcset,
+}
+
+// renderMentions échappe content et transforme ses @username en liens vers les profils.
+func renderMentions(content string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, m := range services.FindMentions(content) {
+		b.WriteString(template.HTMLEscapeString(content[last:m.Start]))
+		b.WriteString(`<a href="/profile/` + url.PathEscape(m.Username) + `" class="mention">@` + template.HTMLEscapeString(m.Username) + `</a>`)
+		last = m.End
+	}
+	b.WriteString(template.HTMLEscapeString(content[last:]))
+	return template.HTML(b.String())
+}
+
+// SuggestUsers retourne en JSON les noms d'utilisateurs mentionnables qui commencent par ?q=.
+func (aw AppWrapper) SuggestUsers(w http.ResponseWriter, r *http.Request) {
+	if aw.viewerID(r) == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Please log in"})
+		return
+	}
+
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+	usernames := []string{}
+	if prefix != "" {
+		found, err := aw.App.User.Suggest(prefix, maxUserSuggestions)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		usernames = append(usernames, found...)
+	}
+	writeJSON(w, http.StatusOK, usernames)
+}
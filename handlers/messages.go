@@ -0,0 +1,292 @@
+package handlers
+
+//Description : Messages privés : boîte de réception, conversations à deux ou en groupe,
+//
+//    suppression d'une conversation pour soi, blocage d'un utilisateur et signalement aux modérateurs.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/services"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Inbox affiche les conversations du visiteur et le formulaire de nouvelle conversation.
+func (aw AppWrapper) Inbox(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	conversations, err := aw.App.Messages.Inbox(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	username, _ := aw.App.Sessions.GetUsername2(userId)
+
+	aw.renderMessages(w, r, "page.messages.html", map[string]interface{}{
+		"username":        username,
+		"conversations":   conversations,
+		"to":              r.URL.Query().Get("to"), // destinataire prérempli depuis un profil
+		"maxParticipants": services.MaxConversationParticipants,
+	})
+}
+
+// StartConversation ouvre une conversation avec les utilisateurs du champ "to" (noms séparés par des virgules).
+func (aw AppWrapper) StartConversation(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	var recipients []string
+	for _, name := range strings.Split(r.FormValue("to"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, err := aw.App.User.GetUserIdByUsername(name)
+		if errors.Is(err, sql.ErrNoRows) {
+			aw.ErrorHandler(w, r, http.StatusBadRequest, "Unknown user: "+name)
+			return
+		} else if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recipients = append(recipients, id)
+	}
+
+	id, err := aw.App.Messages.Start(userId, recipients, r.FormValue("title"), r.FormValue("content"))
+	if err != nil {
+		aw.ErrorHandler(w, r, messageStatus(err), err.Error())
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d", id), http.StatusSeeOther)
+}
+
+// ShowConversation affiche une conversation et la marque comme lue ; un modérateur peut lire
+// une conversation signalée dont il ne fait pas partie.
+func (aw AppWrapper) ShowConversation(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid conversation id")
+		return
+	}
+
+	role, err := aw.App.User.GetRole(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	moderator := role == "moderator" || role == "admin"
+
+	conversation, err := aw.App.Messages.Conversation(id, userId, moderator)
+	if err != nil {
+		aw.ErrorHandler(w, r, messageStatus(err), err.Error())
+		return
+	}
+
+	participant, err := aw.App.Messages.IsParticipant(id, userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if participant {
+		if err := aw.App.Messages.MarkRead(id, userId); err != nil {
+			log.Printf("Erreur lors de la lecture de la conversation %d: %v", id, err)
+		}
+	}
+	username, _ := aw.App.Sessions.GetUsername2(userId)
+
+	aw.renderMessages(w, r, "page.conversation.html", map[string]interface{}{
+		"username":     username,
+		"conversation": conversation,
+		"participant":  participant,
+		"moderator":    moderator,
+	})
+}
+
+// SendMessage ajoute un message à une conversation.
+func (aw AppWrapper) SendMessage(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := aw.conversationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	messageId, err := aw.App.Messages.Send(id, userId, r.FormValue("content"))
+	if err != nil {
+		aw.ErrorHandler(w, r, messageStatus(err), err.Error())
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d#message-%d", id, messageId), http.StatusSeeOther)
+}
+
+// DeleteConversation supprime une conversation pour le visiteur seulement.
+func (aw AppWrapper) DeleteConversation(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := aw.conversationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := aw.App.Messages.Delete(id, userId); err != nil {
+		aw.ErrorHandler(w, r, messageStatus(err), err.Error())
+		return
+	}
+	http.Redirect(w, r, "/messages", http.StatusSeeOther)
+}
+
+// ReportConversation signale une conversation aux modérateurs.
+func (aw AppWrapper) ReportConversation(w http.ResponseWriter, r *http.Request) {
+	userId, id, ok := aw.conversationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := aw.App.Messages.Report(id, userId, r.FormValue("reason")); err != nil {
+		aw.ErrorHandler(w, r, messageStatus(err), err.Error())
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d", id), http.StatusSeeOther)
+}
+
+// ReportedConversations liste les conversations signalées aux modérateurs.
+func (aw AppWrapper) ReportedConversations(w http.ResponseWriter, r *http.Request) {
+	userId, ok := aw.requireRole(w, r, "moderator", "admin")
+	if !ok {
+		return
+	}
+
+	reports, err := aw.App.Messages.Reports()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	username, _ := aw.App.Sessions.GetUsername2(userId)
+
+	aw.renderMessages(w, r, "page.reportedmessages.html", map[string]interface{}{
+		"username": username,
+		"reports":  reports,
+	})
+}
+
+// ResolveConversationReport clôt les signalements d'une conversation.
+func (aw AppWrapper) ResolveConversationReport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "moderator", "admin"); !ok {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid conversation id")
+		return
+	}
+
+	if err := aw.App.Messages.Resolve(id); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/moderation/messages", http.StatusSeeOther)
+}
+
+// BlockUser empêche l'utilisateur {username} d'envoyer des messages au visiteur.
+func (aw AppWrapper) BlockUser(w http.ResponseWriter, r *http.Request) {
+	viewer, blockedID, ok := aw.userTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := aw.App.Messages.Block(viewer, blockedID)
+	if errors.Is(err, services.ErrSelfBlock) {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/profile/"+r.PathValue("username")), http.StatusSeeOther)
+}
+
+// UnblockUser lève le blocage de l'utilisateur {username}.
+func (aw AppWrapper) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	viewer, blockedID, ok := aw.userTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := aw.App.Messages.Unblock(viewer, blockedID); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/profile/"+r.PathValue("username")), http.StatusSeeOther)
+}
+
+// conversationTarget retourne le visiteur connecté et la conversation {id} de l'URL ;
+// en cas d'échec la réponse d'erreur est déjà envoyée et ok vaut false.
+func (aw AppWrapper) conversationTarget(w http.ResponseWriter, r *http.Request) (userId string, id int, ok bool) {
+	userId = aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid conversation id")
+		return "", 0, false
+	}
+	return userId, id, true
+}
+
+// unreadMessages retourne le nombre de conversations non lues du visiteur, affiché près de la cloche.
+func (aw AppWrapper) unreadMessages(r *http.Request) int {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		return 0
+	}
+	count, err := aw.App.Messages.UnreadCount(userId)
+	if err != nil {
+		log.Printf("Erreur lors du comptage des messages non lus: %v", err)
+		return 0
+	}
+	return count
+}
+
+// messageStatus traduit une erreur de messagerie en code HTTP.
+func messageStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrConversationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidMessage), errors.Is(err, services.ErrNoRecipient),
+		errors.Is(err, services.ErrTooManyParticipants), errors.Is(err, services.ErrInvalidReport):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (aw AppWrapper) renderMessages(w http.ResponseWriter, r *http.Request, page string, data map[string]interface{}) {
+	data["unreadMessages"] = aw.unreadMessages(r)
+
+	templatePath := filepath.Join(projectPath, "templates", page)
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := t.Execute(w, data); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,7 +1,65 @@
 package handlers
 
-//    Description : Gestion des routes pour la modération des contenus (validation, suppression).
-//    À faire :
-//        Gérer les actions de modération (approbation ou suppression des posts/commentaires).
-//        Vérifier que seuls les modérateurs ont accès à ces fonctionnalités.
-//        Recevoir et traiter les rapports soumis par les modérateurs.
+//Description : Modération des fils de discussion (épingler, verrouiller, archiver).
+//
+//    Les routes sont réservées aux modérateurs et aux administrateurs. Le champ "value"
+//    vaut 1 pour activer l'état et 0 pour le retirer. L'auteur du post en est notifié.
+
+import (
+	"errors"
+	"fmt"
+	"forum/services"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// PinPost épingle ou désépingle un post en tête de l'accueil et de ses catégories.
+func (aw AppWrapper) PinPost(w http.ResponseWriter, r *http.Request) {
+	aw.setThreadState(w, r, aw.App.Posts.SetPinned, "pinned", "unpinned")
+}
+
+// LockPost verrouille ou déverrouille un post : un fil verrouillé n'accepte plus de commentaires.
+func (aw AppWrapper) LockPost(w http.ResponseWriter, r *http.Request) {
+	aw.setThreadState(w, r, aw.App.Posts.SetLocked, "locked", "unlocked")
+}
+
+// ArchivePost archive ou restaure un post : un fil archivé est en lecture seule et sort des fils par défaut.
+func (aw AppWrapper) ArchivePost(w http.ResponseWriter, r *http.Request) {
+	aw.setThreadState(w, r, aw.App.Posts.SetArchived, "archived", "restored")
+}
+
+// setThreadState applique une action de modération au post de l'URL, prévient son auteur
+// (action on ou off selon "value") puis revient sur le post.
+func (aw AppWrapper) setThreadState(w http.ResponseWriter, r *http.Request, set func(postID int, value bool) error, on, off string) {
+	moderatorId, ok := aw.requireRole(w, r, "moderator", "admin")
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid post id")
+		return
+	}
+
+	value := r.FormValue("value") == "1"
+	err = set(id, value)
+	if errors.Is(err, services.ErrPostNotFound) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	action := off
+	if value {
+		action = on
+	}
+	if err := aw.App.Notification.AddModerationNotification(moderatorId, id, action); err != nil {
+		log.Printf("Erreur lors de la notification de modération du post %d: %v", id, err)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/direct/%d", id), http.StatusSeeOther)
+}
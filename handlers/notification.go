@@ -1,34 +1,67 @@
 package handlers
 
 import (
+	"errors"
+	"forum/models"
+	"forum/services"
 	"html/template"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 )
 
+// notificationsPerPage est le nombre de notifications, ou de groupes de notifications, par page.
+const notificationsPerPage = 20
+
+// Notification affiche les notifications du visiteur : les non lues (par défaut) ou toutes avec ?filter=all.
 func (aw AppWrapper) Notification(w http.ResponseWriter, r *http.Request) {
-	// Vérifie si l'utilisateur est authentifié via un cookie
-	sessionUser, err := r.Cookie("userID")
-	if err != nil {
-		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Missing user cookie")
+	userID := aw.viewerID(r)
+	if userID == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
 		return
 	}
 
-	userID := sessionUser.Value
+	params := r.URL.Query()
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	filter := "unread"
+	if params.Get("filter") == "all" {
+		filter = "all"
+	}
 
 	// Appelle la méthode pour récupérer les notifications
-	notifications, err := aw.App.Notification.GetNotification(userID)
+	notifications, total, err := aw.App.Notification.GetNotification(userID, models.NotificationQuery{
+		UnreadOnly: filter == "unread",
+		Page:       page,
+		PerPage:    notificationsPerPage,
+	})
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, "Failed to fetch notifications: "+err.Error())
 		return
 	}
+	username, _ := aw.App.Sessions.GetUsername2(userID)
+
+	// Liens de pagination conservant le filtre courant
+	pageURL := func(p int) string {
+		return "/notification?" + url.Values{"filter": {filter}, "page": {strconv.Itoa(p)}}.Encode()
+	}
+	pages := (total + notificationsPerPage - 1) / notificationsPerPage
+	var prevURL, nextURL string
+	if page > 1 {
+		prevURL = pageURL(page - 1)
+	}
+	if page < pages {
+		nextURL = pageURL(page + 1)
+	}
 
 	// Chemin du fichier template
 	templatePath := filepath.Join(projectPath, "templates", "page.notification.html")
 
 	// Parse le template
-	t, err := template.ParseFiles(templatePath)
+	t, err := template.New("page.notification.html").Funcs(contentFuncs).ParseFiles(templatePath)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, "Failed to load template: "+err.Error())
 		return
@@ -36,8 +69,15 @@ func (aw AppWrapper) Notification(w http.ResponseWriter, r *http.Request) {
 
 	// Prépare les données pour le template
 	data := map[string]interface{}{
-		"notifications": notifications,
-		"username":      sessionUser.Value, // Exemple : utiliser le cookie pour remplir le nom d'utilisateur si nécessaire
+		"notifications":  notifications,
+		"username":       username,
+		"unreadMessages": aw.unreadMessages(r),
+		"filter":         filter,
+		"page":           page,
+		"pages":          pages,
+		"prevURL":        prevURL,
+		"nextURL":        nextURL,
+		"returnTo":       r.URL.RequestURI(),
 	}
 
 	// Exécute le template avec les données
@@ -47,41 +87,94 @@ func (aw AppWrapper) Notification(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ReadNotification marque une notification (et son groupe) comme lue puis mène à ce qu'elle désigne.
 func (aw AppWrapper) ReadNotification(w http.ResponseWriter, r *http.Request) {
-	// Vérifie si l'utilisateur est authentifié via un cookie
-	sessionUser, err := r.Cookie("userID")
-	if err != nil {
-		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Missing user cookie")
+	userID, notificationID, ok := aw.notificationTarget(w, r)
+	if !ok {
 		return
 	}
 
-	userID := sessionUser.Value
-
-	notificationIDString := r.URL.Path[len("/notification/read/"):]
-	notificationID, err := strconv.Atoi(notificationIDString)
+	target, err := aw.App.Notification.Destination(userID, notificationID)
 	if err != nil {
-		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid notification ID")
+		aw.ErrorHandler(w, r, notificationStatus(err), err.Error())
 		return
 	}
 
 	// Appelle la méthode pour marquer la notification comme lue
 	err = aw.App.Notification.ReadNotification(userID, notificationID)
 	if err != nil {
-		aw.ErrorHandler(w, r, http.StatusInternalServerError, "Failed to mark notification as read: "+err.Error())
+		aw.ErrorHandler(w, r, notificationStatus(err), "Failed to mark notification as read: "+err.Error())
 		return
 	}
 
-	getPostid, err := aw.App.Notification.GetPostId(notificationID)
-	if err != nil {
-		aw.ErrorHandler(w, r, http.StatusInternalServerError, "Failed to get post id: "+err.Error())
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// ReadAllNotifications marque toutes les notifications du visiteur comme lues.
+func (aw AppWrapper) ReadAllNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := aw.viewerID(r)
+	if userID == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
 		return
 	}
 
-	getPostidString := strconv.Itoa(getPostid)
+	if err := aw.App.Notification.ReadAll(userID); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/notification"), http.StatusSeeOther)
+}
 
-	// Redirige l'utilisateur vers la page des notifications
-	http.Redirect(w, r, "/post/direct/"+getPostidString, http.StatusSeeOther)
+// DeleteNotification supprime une notification du visiteur et les notifications regroupées avec elle.
+func (aw AppWrapper) DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	userID, notificationID, ok := aw.notificationTarget(w, r)
+	if !ok {
+		return
+	}
 
+	if err := aw.App.Notification.DeleteNotification(userID, notificationID); err != nil {
+		aw.ErrorHandler(w, r, notificationStatus(err), err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/notification"), http.StatusSeeOther)
 }
 
+// DeleteAllNotifications supprime toutes les notifications du visiteur.
+func (aw AppWrapper) DeleteAllNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := aw.viewerID(r)
+	if userID == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	if err := aw.App.Notification.DeleteAll(userID); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/notification"), http.StatusSeeOther)
+}
 
+// notificationTarget retourne le visiteur et la notification {id} de l'URL ; en cas d'échec
+// la réponse d'erreur est déjà envoyée et ok vaut false.
+func (aw AppWrapper) notificationTarget(w http.ResponseWriter, r *http.Request) (userID string, notificationID int, ok bool) {
+	userID = aw.viewerID(r)
+	if userID == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return "", 0, false
+	}
+
+	notificationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || notificationID <= 0 {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid notification ID")
+		return "", 0, false
+	}
+	return userID, notificationID, true
+}
+
+// notificationStatus traduit une erreur de notification en code HTTP.
+func notificationStatus(err error) int {
+	if errors.Is(err, services.ErrNotificationNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,87 @@
+package handlers
+
+//Description : Préférences de notification : GET /notification/settings affiche, pour chaque événement
+//
+//    (likes, commentaires, réponses, mentions, modération...), les canaux sur lesquels le visiteur veut
+//    être prévenu (in-app, email, résumé) et la fréquence du résumé par email. POST /notification/settings
+//    enregistre le formulaire.
+
+import (
+	"errors"
+	"forum/models"
+	"forum/services"
+	"net/http"
+)
+
+// NotificationSettings affiche les préférences de notification du visiteur.
+func (aw AppWrapper) NotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	prefs, err := aw.App.Notification.Preferences(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	frequency, err := aw.App.Digests.Frequency(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	username, _ := aw.App.Sessions.GetUsername2(userId)
+
+	aw.renderMessages(w, r, "page.notificationsettings.html", map[string]interface{}{
+		"username":    username,
+		"preferences": prefs,
+		"channels":    services.NotificationChannels,
+		"frequency":   frequency,
+		"frequencies": services.DigestFrequencies,
+		"saved":       r.URL.Query().Get("saved") == "1",
+	})
+}
+
+// SaveNotificationSettings enregistre les préférences du formulaire : une case "événement.canal"
+// par couple, une case absente valant désactivé, et la fréquence du résumé ("digest_frequency").
+func (aw AppWrapper) SaveNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid form")
+		return
+	}
+
+	current, err := aw.App.Notification.Preferences(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	prefs := make([]models.NotificationPreference, len(current))
+	for i, pref := range current {
+		prefs[i] = models.NotificationPreference{Event: pref.Event, Channels: map[string]bool{}}
+		for _, channel := range services.NotificationChannels {
+			prefs[i].Channels[channel] = r.PostForm.Get(pref.Event+"."+channel) == "on"
+		}
+	}
+
+	if err := aw.App.Notification.SetPreferences(userId, prefs); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if frequency := r.PostForm.Get("digest_frequency"); frequency != "" {
+		err := aw.App.Digests.SetFrequency(userId, frequency)
+		if errors.Is(err, services.ErrInvalidFrequency) {
+			aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	http.Redirect(w, r, "/notification/settings?saved=1", http.StatusSeeOther)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+//Description : Notifications en temps réel : GET /notification/stream ouvre un flux Server-Sent Events
+//
+//    qui pousse chaque nouvelle notification du visiteur. Le navigateur se reconnecte seul et envoie
+//    Last-Event-ID : les notifications non lues manquées entre-temps sont alors renvoyées.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/models"
+	"forum/services"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamHeartbeat est l'intervalle des commentaires envoyés pour garder la connexion ouverte.
+	streamHeartbeat = 20 * time.Second
+	// streamRetry est le délai de reconnexion conseillé au navigateur, en millisecondes.
+	streamRetry = 5000
+)
+
+// NotificationStream pousse les nouvelles notifications du visiteur en Server-Sent Events.
+// Événements : "unread" (nombre de notifications non lues, à l'ouverture) et "notification".
+func (aw AppWrapper) NotificationStream(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	stream, err := aw.App.Hub.Subscribe(userId)
+	if errors.Is(err, services.ErrTooManyStreams) {
+		aw.ErrorHandler(w, r, http.StatusTooManyRequests, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer aw.App.Hub.Unsubscribe(stream)
+
+	rc := openEventStream(w)
+
+	unread, err := aw.App.Notification.UnreadCount(userId)
+	if err != nil {
+		log.Printf("Erreur lors du comptage des notifications de %s: %v", userId, err)
+	}
+	if err := writeStreamEvent(w, "unread", "", map[string]int{"unread": unread}); err != nil {
+		return
+	}
+
+	// Reconnexion : on renvoie ce qui a été manqué depuis le dernier événement reçu.
+	// Le flux est ouvert avant le rattrapage : lastSent évite d'envoyer deux fois une notification.
+	lastSent := 0
+	if lastId, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		missed, err := aw.App.Notification.Since(userId, lastId)
+		if err != nil {
+			log.Printf("Erreur lors du rattrapage des notifications de %s: %v", userId, err)
+		}
+		for _, event := range missed {
+			if err := writeNotificationEvent(w, event); err != nil {
+				return
+			}
+			lastSent = event.ID
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-stream.Events:
+			if !open {
+				// Flux retiré par le hub (client trop lent) : le navigateur se reconnectera
+				return
+			}
+			if event.ID <= lastSent {
+				continue
+			}
+			if err := writeNotificationEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// openEventStream envoie les en-têtes d'un flux Server-Sent Events et lève le délai d'écriture
+// du serveur, que le flux dépasse forcément.
+func openEventStream(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Erreur lors de l'ouverture d'un flux d'événements: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	return rc
+}
+
+func writeNotificationEvent(w http.ResponseWriter, event models.NotificationEvent) error {
+	return writeStreamEvent(w, "notification", strconv.Itoa(event.ID), event)
+}
+
+// writeStreamEvent écrit un événement Server-Sent Events dont les données sont encodées en JSON.
+func writeStreamEvent(w http.ResponseWriter, name, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+	return err
+}
@@ -7,15 +7,12 @@ import (
 	"fmt"
 	"forum/config"
 	"forum/models"
+	"forum/services"
 	"html/template"
-	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 )
 
 type AppWrapper struct {
@@ -63,14 +60,20 @@ func (aw AppWrapper) GetHome(w http.ResponseWriter, r *http.Request) {
 		username = ""
 	}
 
-	// Retrieve posts from the database using sessionID
-	posts, err := aw.App.Posts.All(sessionID)
+	// Retrieve the posts the session user may see, in the requested order
+	viewer := aw.viewerID(r)
+	sort := feedSortFromRequest(r)
+	if sort.Feed == "following" && viewer == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+	posts, err := aw.App.Posts.All(viewer, sort)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	category, err := aw.App.Category.GetAllCategory()
+	category, err := aw.App.Category.GetAllCategory(viewer)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -78,15 +81,18 @@ func (aw AppWrapper) GetHome(w http.ResponseWriter, r *http.Request) {
 
 	// Prepare data for the template
 	data := map[string]interface{}{
-		"posts":    posts,
-		"username": username,
-		"category": category,
-		"notif":    notification,
+		"posts":          posts,
+		"username":       username,
+		"category":       category,
+		"notif":          notification,
+		"unreadMessages": aw.unreadMessages(r),
+		"sort":           sort,
+		"returnTo":       r.URL.RequestURI(),
 	}
 
 	// Load the HTML template
 	templatePath := filepath.Join(projectPath, "templates", "page.home.html")
-	t, err := template.ParseFiles(templatePath)
+	t, err := template.New("page.home.html").Funcs(contentFuncs).ParseFiles(templatePath)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -116,12 +122,8 @@ func (aw AppWrapper) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = aw.App.Category.InitializeCategories()
-	if err != nil {
-		log.Fatalf("Failed to initialize categories: %v", err)
-	}
-
-	categories, err := aw.App.Category.GetAllCategory()
+	// Only the categories the user may post in are offered
+	categories, err := aw.App.Category.GetPostableCategories(aw.viewerID(r))
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -129,7 +131,9 @@ func (aw AppWrapper) CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	// Prepare data for the template
 	data := map[string]interface{}{
-		"categories": categories,
+		"categories":      categories,
+		"canPostImages":   aw.hasPrivilege(userID, services.PrivilegePostImages),
+		"imageReputation": aw.App.Reputation.Threshold(services.PrivilegePostImages),
 	}
 
 	templatePath := filepath.Join(projectPath, "templates", "page.createpost.html")
@@ -163,13 +167,9 @@ func (aw AppWrapper) StoredPost(w http.ResponseWriter, r *http.Request) {
 	content := r.PostFormValue("content")
 
 	// Retrieve selected categories (can be up to 2)
-	categories := r.PostForm["categories"]
-	if len(categories) == 0 {
-		aw.ErrorHandler(w, r, http.StatusBadRequest, "Please select at least one category")
-		return
-	}
-	if len(categories) > 2 {
-		aw.ErrorHandler(w, r, http.StatusBadRequest, "You can select up to 2 categories")
+	categories, err := categoryIDsFromForm(r.PostForm["categories"])
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -188,11 +188,17 @@ func (aw AppWrapper) StoredPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Initialize imagePath as empty
-	var imagePath string
+	// Refuse the post before its image is stored
+	if err := aw.App.Posts.CheckInsert(categories, userId); err != nil {
+		aw.postError(w, r, err)
+		return
+	}
+
+	// Initialize imageName as empty
+	var imageName string
 
 	// Retrieve the image file (if any)
-	file, handler, err := r.FormFile("image")
+	file, _, err := r.FormFile("image")
 	if err != nil {
 		// If the error is http.ErrMissingFile, no image was provided
 		if !errors.Is(err, http.ErrMissingFile) {
@@ -200,53 +206,43 @@ func (aw AppWrapper) StoredPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else {
-		defer func(file multipart.File) {
-			err := file.Close()
-			if err != nil {
-				aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
-			}
-		}(file) // Always close the file after use
-
-		// Check the file extension
-		validExtensions := map[string]bool{".jpeg": true, ".jpg": true, ".png": true, ".gif": true, ".svg": true, ".webp": true}
-		ext := filepath.Ext(handler.Filename)
-		if !validExtensions[ext] {
-			aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid image type")
-			return
-		}
+		defer file.Close() // Always close the file after use
 
-		// Define the path where the image will be saved
-		imagePath = filepath.Join(projectPath, "static", "images_post", handler.Filename)
-
-		// Create the file in the specified directory
-		dst, err := os.Create(imagePath)
-		if err != nil {
-			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		// Posting images is unlocked by reputation
+		if !aw.requirePrivilege(w, r, userId, services.PrivilegePostImages) {
 			return
 		}
-		defer dst.Close() // Close the destination file after use
 
-		// Copy the uploaded file's content to the destination file
-		_, err = io.Copy(dst, file)
+		// The image is checked from its content and stored under a name derived from it
+		imageName, err = aw.App.Uploads.Save(userId, services.UploadPost, file)
 		if err != nil {
-			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			aw.ErrorHandler(w, r, uploadStatus(err), err.Error())
 			return
 		}
 	}
 
-	// Insert the post with the image (only if imagePath is not empty)
-	var imageName string
-	if imagePath != "" {
-		imageName = handler.Filename
+	// Insert the post into the database
+	postID, err := aw.App.Posts.Insert(title, content, imageName, categories, userId) // Pass the categories slice
+	if err != nil {
+		aw.releaseImage(imageName)
+		aw.postError(w, r, err)
+		return
 	}
 
-	fmt.Println(imageName)
+	// Compute the initial score so the post shows up in the sorted feeds
+	if err := aw.App.Scores.RefreshPost(postID); err != nil {
+		log.Printf("Failed to compute score of post %d: %v", postID, err)
+	}
 
-	// Insert the post into the database
-	err = aw.App.Posts.Insert(title, content, imageName, categories, userId) // Pass the categories slice
+	// Let the author's followers know (never blocks the publication)
+	notified, err := aw.App.Follows.NotifyFollowers(postID, userId)
 	if err != nil {
-		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
-		return
+		log.Printf("Failed to notify followers of post %d: %v", postID, err)
+	}
+
+	// Then the watchers of its categories who were not already notified
+	if _, err := aw.App.Watches.NotifyPost(postID, userId, notified); err != nil {
+		log.Printf("Failed to notify watchers of post %d: %v", postID, err)
 	}
 
 	// Redirect the user to the home page
@@ -312,12 +308,6 @@ func (aw AppWrapper) EditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Assuming you have an instance of CategoryModel in your app
-	err = aw.App.Category.InitializeCategories()
-	if err != nil {
-		log.Fatalf("Failed to initialize categories: %v", err)
-	}
-
 	if r.Method == http.MethodGet {
 		// Retrieve the post by ID
 		post, err := aw.App.Posts.Get(id)
@@ -330,7 +320,7 @@ func (aw AppWrapper) EditPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Retrieve all available categories to display in the form
-		categories, err := aw.App.Category.GetAllCategory()
+		categories, err := aw.App.Category.GetPostableCategories(aw.viewerID(r))
 		if err != nil {
 			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 			return
@@ -338,15 +328,17 @@ func (aw AppWrapper) EditPost(w http.ResponseWriter, r *http.Request) {
 
 		// Prepare data for the template, including the post and categories
 		data := map[string]interface{}{
-			"post":       post,
-			"categories": categories,
+			"post":            post,
+			"categories":      categories,
+			"canPostImages":   aw.hasPrivilege(userID, services.PrivilegePostImages),
+			"imageReputation": aw.App.Reputation.Threshold(services.PrivilegePostImages),
 		}
 
 		// Define the isCategorySelected function for the template
 		funcMap := template.FuncMap{
-			"isCategorySelected": func(categoryName string, postCategories []models.Category) bool {
+			"isCategorySelected": func(categoryID int, postCategories []models.Category) bool {
 				for _, c := range postCategories {
-					if c.Name == categoryName {
+					if c.ID == categoryID {
 						return true
 					}
 				}
@@ -382,13 +374,9 @@ func (aw AppWrapper) EditPost(w http.ResponseWriter, r *http.Request) {
 		content := r.PostFormValue("content")
 
 		// Retrieve selected categories
-		categories := r.PostForm["categories"]
-		if len(categories) == 0 {
-			aw.ErrorHandler(w, r, http.StatusBadRequest, "Please select at least one category")
-			return
-		}
-		if len(categories) > 2 {
-			aw.ErrorHandler(w, r, http.StatusBadRequest, "You can select up to 2 categories")
+		categories, err := categoryIDsFromForm(r.PostForm["categories"])
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -397,11 +385,17 @@ func (aw AppWrapper) EditPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Refuse the update before a new image is stored
+		if err := aw.App.Posts.CheckUpdate(id, categories, aw.viewerID(r)); err != nil {
+			aw.postError(w, r, err)
+			return
+		}
+
 		// Initialize imageName as empty
 		var imageName string
 
 		// Retrieve the image file (if any)
-		file, handler, err := r.FormFile("image")
+		file, _, err := r.FormFile("image")
 		if err != nil {
 			// If no image is provided, continue without updating the image
 			if err == http.ErrMissingFile {
@@ -413,46 +407,42 @@ func (aw AppWrapper) EditPost(w http.ResponseWriter, r *http.Request) {
 		} else {
 			defer file.Close() // Always close the file after use
 
-			// Check the file extension
-			validExtensions := map[string]bool{
-				".jpeg": true, ".jpg": true, ".png": true,
-				".gif": true, ".svg": true, ".webp": true,
-			}
-			ext := strings.ToLower(filepath.Ext(handler.Filename))
-			if !validExtensions[ext] {
-				aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid image type")
-				return
-			}
-
-			// Define the path where the image will be saved
-			imagePath := filepath.Join(projectPath, "static", "images_post", handler.Filename)
-
-			// Create the file in the specified directory
-			dst, err := os.Create(imagePath)
-			if err != nil {
-				aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			// Posting images is unlocked by reputation
+			if !aw.requirePrivilege(w, r, userID, services.PrivilegePostImages) {
 				return
 			}
-			defer dst.Close() // Close the destination file after use
 
-			// Copy the uploaded file's content to the destination file
-			_, err = io.Copy(dst, file)
+			// The image is checked from its content and stored under a name derived from it
+			imageName, err = aw.App.Uploads.Save(userID, services.UploadPost, file)
 			if err != nil {
-				aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+				aw.ErrorHandler(w, r, uploadStatus(err), err.Error())
 				return
 			}
+		}
 
-			// Assign the image name
-			imageName = handler.Filename
+		// Keep the previous image so it can be released once replaced
+		var previousImage string
+		if previous, err := aw.App.Posts.Get(id); err == nil && previous.Image != nil {
+			previousImage = *previous.Image
 		}
 
 		// Update the post with or without a new image, passing the categories
-		err = aw.App.Posts.Update(id, title, content, imageName, categories)
+		err = aw.App.Posts.Update(id, title, content, imageName, categories, aw.viewerID(r))
 		if err != nil {
-			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			if imageName != previousImage {
+				aw.releaseImage(imageName)
+			}
+			aw.postError(w, r, err)
 			return
 		}
 
+		// Delete the previous image if no post uses it anymore
+		if previousImage != imageName {
+			if err := aw.App.Uploads.Release(services.UploadPost, previousImage); err != nil {
+				log.Printf("Failed to release image %s: %v", previousImage, err)
+			}
+		}
+
 		// Redirect to the updated post
 		http.Redirect(w, r, fmt.Sprintf("/post/direct/%s", id), http.StatusSeeOther)
 		return
@@ -504,15 +494,6 @@ func (aw AppWrapper) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete the image from the file system (if it exists)
-	if post.Image != nil {
-		imagePath := filepath.Join(projectPath, "static", "images_post", *post.Image)
-		if err := os.Remove(imagePath); err != nil {
-			// Log or handle the image deletion error if necessary
-			fmt.Printf("Failed to delete image: %v\n", err)
-		}
-	}
-
 	// Delete the post from the database (categories will be handled by the PostModel)
 	err = aw.App.Posts.Delete(id)
 	if err != nil {
@@ -520,6 +501,13 @@ func (aw AppWrapper) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Delete the image from the file system if no other post uses it
+	if post.Image != nil {
+		if err := aw.App.Uploads.Release(services.UploadPost, *post.Image); err != nil {
+			log.Printf("Failed to release image %s: %v", *post.Image, err)
+		}
+	}
+
 	idInt, err := strconv.Atoi(id)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid post ID")
@@ -583,30 +571,165 @@ func (aw AppWrapper) ShowPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Retrieve comments associated with the post
-	comments, err := aw.App.Comment.GetComments(post.ID, userId)
+	// Posts in a category the user cannot see are reported as missing
+	err = aw.App.Permissions.CheckPost(userId, post.ID, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, ErrPostNotFound.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Retrieve the requested page of comments associated with the post
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	comments, err := aw.App.Comment.GetComments(post.ID, userId, commentSortFromRequest(r), page)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	// Moderators and admins get the pin / lock / archive controls
+	canModerate := false
+	if userId != "" {
+		role, err := aw.App.User.GetRole(userId)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		canModerate = role == "moderator" || role == "admin"
+	}
+
 	// Load the template
-	templatePath := filepath.Join(projectPath, "templates", "page.post.html")
-	t, err := template.ParseFiles(templatePath)
+	t, err := postTemplate()
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Execute the template with the post and its comment tree
+	watching, err := aw.App.Watches.IsWatching(userId, services.TargetPost, post.ID)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Execute the template with the post and comments
 	data := map[string]interface{}{
-		"userId":   userId,
-		"username": username,
-		"post":     post,
-		"Comments": comments,
+		"userId":        userId,
+		"username":      username,
+		"post":          post,
+		"Comments":      comments.Comments,
+		"commentPage":   comments,
+		"canModerate":   canModerate,
+		"canReply":      username != "" && !post.Locked && !post.Archived,
+		"maxReplyDepth": aw.App.Comment.MaxDepth,
+		"reactionKinds": aw.App.Reactions.Available(),
+		"returnTo":      r.URL.RequestURI(),
+		"watching":      watching,
 	}
 	if err := t.Execute(w, data); err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
+
+// postTemplate parses the post page, which also defines the "comment" template used on its own
+// to render a single comment (see CommentFragment).
+func postTemplate() (*template.Template, error) {
+	// commentNode pairs a comment with the page data for the recursive "comment" template,
+	// pageNumbers lists the comment pages for the pagination links, mentions links @username to profiles
+	// and srcset lists the sizes of an uploaded image
+	funcMap := template.FuncMap{
+		"commentNode": commentNode,
+		"mentions":    renderMentions,
+		"srcset":      imageSrcset,
+		"pageNumbers": func(pages int) []int {
+			numbers := make([]int, pages)
+			for i := range numbers {
+				numbers[i] = i + 1
+			}
+			return numbers
+		},
+	}
+
+	templatePath := filepath.Join(projectPath, "templates", "page.post.html")
+	return template.New("page.post.html").Funcs(funcMap).ParseFiles(templatePath)
+}
+
+func commentNode(comment models.Comment, page map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"comment": comment, "page": page}
+}
+
+// feedSortFromRequest reads the "sort", "t" and "feed" query parameters of a feed.
+// Unknown values fall back to the chronological order.
+func feedSortFromRequest(r *http.Request) models.FeedSort {
+	sort := models.FeedSort{Mode: "new", Window: "all", Feed: "all"}
+
+	switch mode := r.URL.Query().Get("sort"); mode {
+	case "hot", "top", "controversial", "comments":
+		sort.Mode = mode
+	}
+
+	switch window := r.URL.Query().Get("t"); window {
+	case "day", "week", "month":
+		sort.Window = window
+	}
+
+	if r.URL.Query().Get("feed") == "following" {
+		sort.Feed = "following"
+	}
+
+	return sort
+}
+
+// categoryIDsFromForm convertit les identifiants de catégories envoyés par le formulaire (1 ou 2).
+func categoryIDsFromForm(values []string) ([]int, error) {
+	if len(values) == 0 {
+		return nil, errors.New("Please select at least one category")
+	}
+	if len(values) > 2 {
+		return nil, errors.New("You can select up to 2 categories")
+	}
+
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("Invalid category")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// postError reports why a post could not be created or updated.
+func (aw AppWrapper) postError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownCategory):
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Unknown category")
+	case errors.Is(err, services.ErrForbidden):
+		aw.ErrorHandler(w, r, http.StatusForbidden, "You are not allowed to post in this category")
+	case errors.Is(err, services.ErrPostArchived):
+		aw.ErrorHandler(w, r, http.StatusForbidden, err.Error())
+	default:
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// releaseImage frees an image stored for a post that could not be saved; it is kept if another post uses it.
+func (aw AppWrapper) releaseImage(imageName string) {
+	if err := aw.App.Uploads.Release(services.UploadPost, imageName); err != nil {
+		log.Printf("Failed to release image %s: %v", imageName, err)
+	}
+}
+
+// uploadStatus maps an upload error to an HTTP status code.
+func uploadStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUnsupportedImage):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"forum/config"
+	"forum/internal/testdb"
+	"forum/services"
+	"image"
+	"image/png"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// postForm construit un formulaire de post multipart avec une petite image PNG.
+func postForm(t *testing.T, categories ...string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("title", "Titre")
+	form.WriteField("content", "Contenu")
+	for _, category := range categories {
+		form.WriteField("categories", category)
+	}
+	part, err := form.CreateFormFile("image", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+// TestRefusedPostKeepsNoUpload vérifie qu'un post refusé (catégorie inconnue ou interdite, fil archivé)
+// ne laisse ni ligne Uploads ni fichier dans le stockage.
+func TestRefusedPostKeepsNoUpload(t *testing.T) {
+	previousPath := projectPath
+	projectPath = ".."
+	t.Cleanup(func() { projectPath = previousPath })
+
+	db := testdb.Open(t)
+	userID := testdb.AddUser(t, db, "11111111-1111-1111-1111-111111111111", "alice", "user")
+	if _, err := db.Exec(`INSERT INTO Sessions (session_id, user_id, expires_at) VALUES ('sess', ?, datetime('now', '+1 day'))`, userID); err != nil {
+		t.Fatal(err)
+	}
+	var staffID string
+	db.QueryRow(`SELECT id FROM Categories WHERE name = 'Staff'`).Scan(&staffID)
+	if _, err := db.Exec(`INSERT INTO Post (id, user_id, title, content, archived) VALUES (1, ?, 'Ancien', 'Contenu', 1)`, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	permissions := &services.PermissionModel{DB: db}
+	aw := AppWrapper{App: &config.App{
+		Sessions:    &services.Session{DB: db},
+		Posts:       &services.PostModel{DB: db, Permissions: permissions},
+		Uploads:     &services.UploadModel{DB: db, Storage: &services.LocalStorage{Dir: dir}},
+		Reputation:  &services.ReputationModel{DB: db},
+		Permissions: permissions,
+	}}
+
+	tests := []struct {
+		name     string
+		path     string
+		handler  http.HandlerFunc
+		category string
+		want     int
+	}{
+		{"unknown category", "/post/create", aw.StoredPost, "9999", http.StatusBadRequest},
+		{"forbidden category", "/post/create", aw.StoredPost, staffID, http.StatusForbidden},
+		{"archived thread", "/post/edit/1", aw.EditPost, "1", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, contentType := postForm(t, test.category)
+			req := httptest.NewRequest(http.MethodPost, test.path, body)
+			req.Header.Set("Content-Type", contentType)
+			req.AddCookie(&http.Cookie{Name: "session_token", Value: "sess"})
+			req.AddCookie(&http.Cookie{Name: "userID", Value: userID})
+			rec := httptest.NewRecorder()
+			test.handler(rec, req)
+
+			if rec.Code != test.want {
+				t.Fatalf("status = %d, want %d", rec.Code, test.want)
+			}
+			var uploads int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM Uploads`).Scan(&uploads); err != nil {
+				t.Fatal(err)
+			}
+			if uploads != 0 {
+				t.Errorf("%d Uploads rows left", uploads)
+			}
+			filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					t.Errorf("file left in storage: %s", path)
+				}
+				return nil
+			})
+		})
+	}
+}
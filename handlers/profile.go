@@ -2,10 +2,10 @@ package handlers
 
 import (
 	"errors"
+	"forum/services"
 	"html/template"
-	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 )
 
@@ -21,12 +21,11 @@ func (aw AppWrapper) Profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionUserID, err := r.Cookie("userID")
+	_, err = r.Cookie("userID")
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Missing user cookie")
 		return
 	}
-	sessionUseriD := sessionUserID.Value
 
 	// Récupérer le nom d'utilisateur et l'ID de l'utilisateur connecté
 	var currentUsername string
@@ -39,7 +38,33 @@ func (aw AppWrapper) Profile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer tous les posts de l'utilisateur avec les informations de likes/dislikes
-	posts, err := aw.App.Posts.AllPostByUserProfile(userID, currentUserID, sessionUseriD)
+	// Les droits de lecture sont vérifiés avec l'utilisateur de la session
+	posts, err := aw.App.Posts.AllPostByUserProfile(userID, currentUserID, aw.viewerID(r))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reputation, err := aw.App.Reputation.Get(userID)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	badges, err := aw.App.Badges.ForUser(userID)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	follow, err := aw.App.Follows.Stats(userID, aw.viewerID(r))
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Le visiteur a-t-il bloqué les messages de cet utilisateur
+	blocked, err := aw.App.Messages.IsBlocked(aw.viewerID(r), userID)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -48,19 +73,24 @@ func (aw AppWrapper) Profile(w http.ResponseWriter, r *http.Request) {
 	// Préparer les données pour le template
 	data := map[string]interface{}{
 		"User": map[string]interface{}{
-			"ID":       userID,
-			"Username": user,
-			"Picture":  picture,
-			"Roles":    role,
+			"ID":         userID,
+			"Username":   user,
+			"Picture":    picture,
+			"Roles":      role,
+			"Reputation": reputation,
 		},
+		"Badges":          badges,
+		"Follow":          follow,
+		"Blocked":         blocked,
 		"Posts":           posts,
 		"CurrentUsername": currentUsername,
 		"LoggedIn":        currentUsername != "",
+		"ReturnTo":        r.URL.RequestURI(),
 	}
 
 	// Définir le chemin du template
 	templatePath := filepath.Join("templates", "page.profile.html")
-	t, err := template.ParseFiles(templatePath)
+	t, err := template.New("page.profile.html").Funcs(contentFuncs).ParseFiles(templatePath)
 	if err != nil {
 		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -123,8 +153,15 @@ func (aw AppWrapper) EditProfile(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var avatarPath string
-		file, handler, err := r.FormFile("image")
+		// Photo actuelle, supprimée une fois remplacée si plus personne ne l'utilise
+		_, _, previousPicture, err := aw.App.User.GetAllInfoUser(userID)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, "Error retrieving user")
+			return
+		}
+
+		var avatarName string
+		file, _, err := r.FormFile("image")
 		if err != nil && !errors.Is(err, http.ErrMissingFile) {
 			aw.ErrorHandler(w, r, http.StatusInternalServerError, "Error processing file")
 			return
@@ -133,37 +170,22 @@ func (aw AppWrapper) EditProfile(w http.ResponseWriter, r *http.Request) {
 		if file != nil {
 			defer file.Close()
 
-			validExtensions := map[string]bool{".jpeg": true, ".jpg": true, ".png": true, ".gif": true}
-			ext := filepath.Ext(handler.Filename)
-			if !validExtensions[ext] {
-				aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid image type")
-				return
-			}
-
-			avatarPath = filepath.Join(projectPath, "static", "images_profile", handler.Filename)
-
-			dst, err := os.Create(avatarPath)
+			// L'image est vérifiée d'après son contenu et rangée sous un nom qui en dérive
+			avatarName, err = aw.App.Uploads.Save(userID, services.UploadProfile, file)
 			if err != nil {
-				aw.ErrorHandler(w, r, http.StatusInternalServerError, "Error saving avatar")
-				return
-			}
-			defer dst.Close()
-
-			if _, err := io.Copy(dst, file); err != nil {
-				aw.ErrorHandler(w, r, http.StatusInternalServerError, "Error copying file")
+				aw.ErrorHandler(w, r, uploadStatus(err), err.Error())
 				return
 			}
-
 		}
 
 		imageName := "default.jpg"
-		if avatarPath != "" {
-			imageName = handler.Filename
+		if avatarName != "" {
+			imageName = avatarName
 		}
 
 		// Mise à jour du profil utilisateur
 		usernamePro := r.FormValue("username")
-		if avatarPath != "" {
+		if avatarName != "" {
 			usernamePro, err = aw.App.Sessions.GetUsername2(userID)
 			if err != nil {
 				aw.ErrorHandler(w, r, http.StatusInternalServerError, "Error retrieving user ID")
@@ -177,6 +199,12 @@ func (aw AppWrapper) EditProfile(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if previousPicture != nil && *previousPicture != imageName {
+			if err := aw.App.Uploads.Release(services.UploadProfile, *previousPicture); err != nil {
+				log.Printf("Erreur lors de la suppression de la photo %s : %v", *previousPicture, err)
+			}
+		}
+
 		newUsername, err := aw.App.Sessions.GetUsername2(userID)
 		if err != nil {
 			aw.ErrorHandler(w, r, http.StatusInternalServerError, "Error retrieving user ID")
@@ -0,0 +1,45 @@
+package handlers
+
+//Description : Réputation des utilisateurs : privilèges débloqués par la réputation
+//
+//    et recalcul du journal de réputation par un administrateur.
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// requirePrivilege vérifie que l'utilisateur a la réputation requise pour un privilège,
+// sinon répond 403 et retourne false.
+func (aw AppWrapper) requirePrivilege(w http.ResponseWriter, r *http.Request, userId, privilege string) bool {
+	ok, err := aw.App.Reputation.Has(userId, privilege)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !ok {
+		aw.ErrorHandler(w, r, http.StatusForbidden,
+			fmt.Sprintf("You need %d reputation points to do this", aw.App.Reputation.Threshold(privilege)))
+		return false
+	}
+	return true
+}
+
+// hasPrivilege indique si l'utilisateur a un privilège ; une erreur compte comme un refus.
+func (aw AppWrapper) hasPrivilege(userId, privilege string) bool {
+	ok, err := aw.App.Reputation.Has(userId, privilege)
+	return err == nil && ok
+}
+
+// RecomputeReputation reconstruit le journal de réputation avec les poids et le plafond actuels.
+func (aw AppWrapper) RecomputeReputation(w http.ResponseWriter, r *http.Request) {
+	if _, ok := aw.requireRole(w, r, "admin"); !ok {
+		return
+	}
+
+	if err := aw.App.Reputation.Recompute(); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/admin/permissions", http.StatusSeeOther)
+}
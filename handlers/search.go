@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"forum/models"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Search affiche la page de recherche plein texte avec ses filtres et sa pagination.
+func (aw AppWrapper) Search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		aw.ErrorHandler(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userCookie, err := r.Cookie("userID")
+	var sessionID string
+	if err == nil {
+		sessionID = userCookie.Value
+	}
+
+	var username string
+	if sessionID != "" {
+		username, err = aw.App.Sessions.GetUsername2(sessionID)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	params := r.URL.Query()
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	query := models.SearchQuery{
+		Terms:    strings.TrimSpace(params.Get("q")),
+		Category: params.Get("category"),
+		Author:   strings.TrimSpace(params.Get("author")),
+		From:     params.Get("from"),
+		To:       params.Get("to"),
+		Page:     page,
+		PerPage:  10,
+	}
+
+	viewer := aw.viewerID(r)
+	results, total, err := aw.App.Search.Search(query, viewer)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	categories, err := aw.App.Category.GetAllCategory(viewer)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Liens de pagination conservant les filtres courants
+	pageURL := func(p int) string {
+		values := url.Values{}
+		for key, v := range params {
+			values[key] = v
+		}
+		values.Set("page", strconv.Itoa(p))
+		return "/search?" + values.Encode()
+	}
+
+	pages := (total + query.PerPage - 1) / query.PerPage
+	var prevURL, nextURL string
+	if page > 1 {
+		prevURL = pageURL(page - 1)
+	}
+	if page < pages {
+		nextURL = pageURL(page + 1)
+	}
+
+	data := map[string]interface{}{
+		"username":   username,
+		"query":      query,
+		"results":    results,
+		"total":      total,
+		"page":       page,
+		"pages":      pages,
+		"prevURL":    prevURL,
+		"nextURL":    nextURL,
+		"categories": categories,
+	}
+
+	templatePath := filepath.Join(projectPath, "templates", "page.search.html")
+	t, err := template.New("page.search.html").Funcs(contentFuncs).ParseFiles(templatePath)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = t.Execute(w, data)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -5,3 +5,53 @@ package handlers
 //
 //    Gérer la promotion ou la rétrogradation des utilisateurs (par exemple, promotion en modérateur par un administrateur).
 //    Assurer la gestion des rôles des utilisateurs (invité, utilisateur, modérateur, administrateur).
+
+import (
+	"net/http"
+)
+
+// requireRole vérifie, à partir de la session, que l'utilisateur possède l'un des rôles demandés.
+// En cas d'échec la réponse d'erreur est déjà envoyée et ok vaut false.
+func (aw AppWrapper) requireRole(w http.ResponseWriter, r *http.Request, roles ...string) (userId string, ok bool) {
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil || sessionCookie.Value == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return "", false
+	}
+
+	userId, err = aw.App.Sessions.GetUserID(sessionCookie.Value)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+
+	role, err := aw.App.User.GetRole(userId)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+
+	for _, allowed := range roles {
+		if role == allowed {
+			return userId, true
+		}
+	}
+
+	aw.ErrorHandler(w, r, http.StatusForbidden, "You are not allowed to access this page")
+	return "", false
+}
+
+// viewerID retourne l'identifiant de l'utilisateur connecté d'après sa session, ou une chaîne vide
+// pour un visiteur. C'est cet identifiant qui sert aux vérifications de droits d'accès.
+func (aw AppWrapper) viewerID(r *http.Request) string {
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil || sessionCookie.Value == "" {
+		return ""
+	}
+
+	userId, err := aw.App.Sessions.GetUserID(sessionCookie.Value)
+	if err != nil {
+		return ""
+	}
+	return userId
+}
@@ -0,0 +1,255 @@
+package handlers
+
+// Description : Vote (like, dislike ou réaction emoji) sur un post ou un commentaire.
+//
+//    POST /post/{id}/vote et POST /comment/{id}/vote avec le champ "action".
+//    Sans JavaScript, la réponse redirige vers "return_to" (même origine uniquement) ;
+//    si la requête demande du JSON, elle renvoie les compteurs à jour et la réaction du visiteur.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/services"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// voteResponse est la réponse JSON d'un vote.
+type voteResponse struct {
+	Target   string         `json:"target"`
+	ID       int            `json:"id"`
+	Likes    int            `json:"likes"`
+	Dislikes int            `json:"dislikes"`
+	Counts   map[string]int `json:"counts"`
+	Mine     string         `json:"mine"`
+}
+
+// VotePost enregistre la réaction du visiteur sur un post.
+func (aw AppWrapper) VotePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		aw.voteError(w, r, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.voteError(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	// Un post invisible pour l'utilisateur n'existe pas pour lui
+	if _, err := aw.App.Posts.GetPostByID(id); errors.Is(err, services.ErrPostNotFound) {
+		aw.voteError(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		aw.voteError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = aw.App.Permissions.CheckPost(userId, id, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.voteError(w, r, http.StatusNotFound, services.ErrPostNotFound.Error())
+		return
+	} else if err != nil {
+		aw.voteError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := aw.App.Posts.CheckVotable(id); err != nil {
+		aw.voteError(w, r, voteStatus(err), err.Error())
+		return
+	}
+
+	previous, current, err := aw.vote(services.TargetPost, id, userId, r.FormValue("action"))
+	if err != nil {
+		aw.voteError(w, r, voteStatus(err), err.Error())
+		return
+	}
+
+	// Seuls like et dislike ont une notification et une activité : créées pour le nouveau vote,
+	// supprimées quand il est retiré ou remplacé par une autre réaction
+	if isVote(current) {
+		if err := aw.App.Notification.AddVoteNotification(userId, id, 0, current); err != nil {
+			aw.voteError(w, r, http.StatusInternalServerError, "Erreur lors de l'ajout de la notification")
+			return
+		}
+		if err := aw.App.Activity.SetVoteActivity(userId, current, id, 0); err != nil {
+			aw.voteError(w, r, http.StatusInternalServerError, "Erreur lors de l'ajout de l'activité")
+			return
+		}
+	} else if isVote(previous) {
+		if err := aw.App.Notification.RemoveVoteNotification(userId, id, 0); err != nil {
+			aw.voteError(w, r, http.StatusInternalServerError, "Erreur lors de la suppression de la notification")
+			return
+		}
+		if err := aw.App.Activity.RemoveVoteActivity(userId, id, 0); err != nil {
+			aw.voteError(w, r, http.StatusInternalServerError, "Erreur lors de la suppression de l'activité")
+			return
+		}
+	}
+
+	// Mise à jour du score utilisé pour trier les fils (non bloquant)
+	if err := aw.App.Scores.RefreshPost(id); err != nil {
+		log.Printf("Erreur lors de la mise à jour du score du post %d: %v", id, err)
+	}
+
+	aw.finishVote(w, r, services.TargetPost, id, userId, fmt.Sprintf("/post/direct/%d", id))
+}
+
+// VoteComment enregistre la réaction du visiteur sur un commentaire.
+func (aw AppWrapper) VoteComment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		aw.voteError(w, r, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.voteError(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	// Un commentaire d'un post invisible pour l'utilisateur n'existe pas pour lui
+	postId, err := aw.App.Comment.GetPostIdByCommentId(strconv.Itoa(id))
+	if err != nil {
+		aw.voteError(w, r, http.StatusNotFound, services.ErrCommentNotFound.Error())
+		return
+	}
+	err = aw.App.Permissions.CheckPost(userId, postId, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.voteError(w, r, http.StatusNotFound, services.ErrCommentNotFound.Error())
+		return
+	} else if err != nil {
+		aw.voteError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := aw.App.Posts.CheckVotable(postId); err != nil {
+		aw.voteError(w, r, voteStatus(err), err.Error())
+		return
+	}
+
+	if _, _, err := aw.vote(services.TargetComment, id, userId, r.FormValue("action")); err != nil {
+		aw.voteError(w, r, voteStatus(err), err.Error())
+		return
+	}
+
+	aw.finishVote(w, r, services.TargetComment, id, userId, fmt.Sprintf("/comment/%d", id))
+}
+
+// vote applique l'action : la même réaction une seconde fois l'annule, "none" la retire.
+// Retourne la réaction du visiteur avant et après le vote ("" s'il n'en a pas).
+func (aw AppWrapper) vote(targetType string, targetID int, userId, action string) (string, string, error) {
+	if action == "" {
+		return "", "", fmt.Errorf("%w: aucune action fournie", services.ErrInvalidReaction)
+	}
+	if action != "none" && !aw.App.Reactions.IsValid(action) {
+		return "", "", fmt.Errorf("%w: '%s'", services.ErrInvalidReaction, action)
+	}
+
+	previous, current, err := aw.App.Reactions.Toggle(targetType, targetID, userId, action)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Points de réputation de l'auteur (non bloquant)
+	if err := aw.App.Reputation.Record(targetType, targetID, userId); err != nil {
+		log.Printf("Erreur lors de la mise à jour de la réputation (%s %d): %v", targetType, targetID, err)
+	}
+	return previous, current, nil
+}
+
+// isVote indique si une réaction est un like ou un dislike.
+func isVote(reaction string) bool {
+	return reaction == "like" || reaction == "dislike"
+}
+
+// finishVote renvoie l'état du vote en JSON, ou redirige vers return_to (par défaut fallback).
+func (aw AppWrapper) finishVote(w http.ResponseWriter, r *http.Request, targetType string, targetID int, userId, fallback string) {
+	if !wantsJSON(r) {
+		http.Redirect(w, r, safeReturnTo(r, fallback), http.StatusSeeOther)
+		return
+	}
+
+	summary, err := aw.App.Reactions.Summary(targetType, targetID, userId)
+	if err != nil {
+		aw.voteError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, voteResponse{
+		Target:   targetType,
+		ID:       targetID,
+		Likes:    summary.Counts["like"],
+		Dislikes: summary.Counts["dislike"],
+		Counts:   summary.Counts,
+		Mine:     summary.Mine,
+	})
+}
+
+// voteError renvoie l'erreur en JSON si la requête en demande, sinon la page d'erreur.
+func (aw AppWrapper) voteError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+	aw.ErrorHandler(w, r, status, message)
+}
+
+// voteStatus traduit une erreur de vote en code HTTP.
+func voteStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidReaction) || errors.Is(err, services.ErrInvalidTarget) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrPostArchived) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, services.ErrPostNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// wantsJSON indique si le client attend une réponse JSON (en-tête Accept ou ?format=json).
+func wantsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeJSON écrit v en JSON avec le code donné.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Erreur lors de l'encodage JSON :", err)
+	}
+}
+
+// safeReturnTo valide le paramètre return_to : seul un chemin local (ou une URL du même hôte)
+// est accepté, pour ne jamais rediriger vers un autre site. Sinon on revient sur fallback.
+func safeReturnTo(r *http.Request, fallback string) string {
+	target := r.FormValue("return_to")
+	if target == "" || strings.ContainsAny(target, "\\\r\n") {
+		return fallback
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return fallback
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host != r.Host {
+			return fallback
+		}
+	}
+	// "//autre-site" serait interprété par le navigateur comme une URL absolue
+	if !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return fallback
+	}
+
+	local := &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery, Fragment: u.Fragment}
+	return local.String()
+}
@@ -0,0 +1,95 @@
+package handlers
+
+//Description : Abonnements aux nouveaux commentaires d'un post ou aux nouveaux posts d'une catégorie.
+//
+//    POST /post/watch/{id} et POST /category/watch/{name} avec value=1 pour s'abonner, value=0 pour se désabonner.
+
+import (
+	"errors"
+	"fmt"
+	"forum/services"
+	"net/http"
+	"strconv"
+)
+
+// WatchPost abonne le visiteur aux nouveaux commentaires d'un post, ou l'en désabonne.
+func (aw AppWrapper) WatchPost(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		aw.ErrorHandler(w, r, http.StatusBadRequest, "Invalid post id")
+		return
+	}
+
+	// Un post invisible pour l'utilisateur n'existe pas pour lui
+	if _, err := aw.App.Posts.GetPostByID(id); errors.Is(err, services.ErrPostNotFound) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = aw.App.Permissions.CheckPost(userId, id, services.ActionView)
+	if errors.Is(err, services.ErrForbidden) {
+		aw.ErrorHandler(w, r, http.StatusNotFound, services.ErrPostNotFound.Error())
+		return
+	} else if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := aw.setWatch(userId, services.TargetPost, id, r.FormValue("value") == "1"); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, fmt.Sprintf("/post/direct/%d", id)), http.StatusSeeOther)
+}
+
+// WatchCategory abonne le visiteur aux nouveaux posts d'une catégorie, ou l'en désabonne.
+func (aw AppWrapper) WatchCategory(w http.ResponseWriter, r *http.Request) {
+	userId := aw.viewerID(r)
+	if userId == "" {
+		aw.ErrorHandler(w, r, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	name := r.PathValue("name")
+	category, err := aw.App.Category.GetCategoryByName(name)
+	if err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Une catégorie que l'utilisateur ne peut pas voir est traitée comme inexistante
+	if category != nil {
+		canView, err := aw.App.Permissions.Can(userId, category.ID, services.ActionView)
+		if err != nil {
+			aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !canView {
+			category = nil
+		}
+	}
+	if category == nil {
+		aw.ErrorHandler(w, r, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if err := aw.setWatch(userId, services.TargetCategory, category.ID, r.FormValue("value") == "1"); err != nil {
+		aw.ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, safeReturnTo(r, "/category/"+name), http.StatusSeeOther)
+}
+
+func (aw AppWrapper) setWatch(userId, targetType string, targetID int, watch bool) error {
+	if watch {
+		return aw.App.Watches.Watch(userId, targetType, targetID)
+	}
+	return aw.App.Watches.Unwatch(userId, targetType, targetID)
+}
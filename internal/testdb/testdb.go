@@ -0,0 +1,54 @@
+// Package testdb prépare pour les tests une base SQLite vide avec toutes les migrations appliquées.
+package testdb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open crée une base dans un dossier temporaire du test et y applique, dans l'ordre, la partie
+// "+goose Up" de chaque fichier de migration/. La base est fermée à la fin du test.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, file, _, _ := runtime.Caller(0)
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(file), "..", "..", "migration", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(content), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("migration %s: %v", filepath.Base(name), err)
+		}
+	}
+	return db
+}
+
+// AddUser crée un utilisateur de rôle role et retourne son identifiant.
+func AddUser(t *testing.T, db *sql.DB, id, username, role string) string {
+	t.Helper()
+	_, err := db.Exec(`INSERT INTO Users (id, username, email, password, role) VALUES (?, ?, ?, '', ?)`,
+		id, username, username+"@example.com", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,70 @@
+-- +goose Up
+-- Index plein texte des posts (titre + contenu) et des commentaires.
+-- Les tables FTS5 sont en "external content" : le texte reste dans Post et
+-- Comment, les triggers ci-dessous maintiennent l'index synchronisé.
+CREATE VIRTUAL TABLE IF NOT EXISTS PostSearch USING fts5(
+    title,
+    content,
+    content='Post',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS CommentSearch USING fts5(
+    content,
+    content='Comment',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Post_search_insert AFTER INSERT ON Post BEGIN
+    INSERT INTO PostSearch(rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Post_search_delete AFTER DELETE ON Post BEGIN
+    INSERT INTO PostSearch(PostSearch, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Post_search_update AFTER UPDATE OF title, content ON Post BEGIN
+    INSERT INTO PostSearch(PostSearch, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO PostSearch(rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Comment_search_insert AFTER INSERT ON Comment BEGIN
+    INSERT INTO CommentSearch(rowid, content) VALUES (new.id, new.content);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Comment_search_delete AFTER DELETE ON Comment BEGIN
+    INSERT INTO CommentSearch(CommentSearch, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Comment_search_update AFTER UPDATE OF content ON Comment BEGIN
+    INSERT INTO CommentSearch(CommentSearch, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO CommentSearch(rowid, content) VALUES (new.id, new.content);
+END;
+-- +goose StatementEnd
+
+-- Indexation des données déjà présentes
+INSERT INTO PostSearch(PostSearch) VALUES ('rebuild');
+INSERT INTO CommentSearch(CommentSearch) VALUES ('rebuild');
+
+-- +goose Down
+DROP TRIGGER IF EXISTS Comment_search_update;
+DROP TRIGGER IF EXISTS Comment_search_delete;
+DROP TRIGGER IF EXISTS Comment_search_insert;
+DROP TRIGGER IF EXISTS Post_search_update;
+DROP TRIGGER IF EXISTS Post_search_delete;
+DROP TRIGGER IF EXISTS Post_search_insert;
+DROP TABLE IF EXISTS CommentSearch;
+DROP TABLE IF EXISTS PostSearch;
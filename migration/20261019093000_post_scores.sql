@@ -0,0 +1,29 @@
+-- +goose Up
+-- Scores des posts utilisés pour les tris "hot", "top", "controversial" et
+-- "comments". La table est recalculée périodiquement par ScoreModel et mise à
+-- jour après chaque vote ou commentaire.
+CREATE TABLE IF NOT EXISTS PostScore (
+    post_id INTEGER PRIMARY KEY,
+    like_count INTEGER NOT NULL DEFAULT 0,
+    dislike_count INTEGER NOT NULL DEFAULT 0,
+    comment_count INTEGER NOT NULL DEFAULT 0,
+    score INTEGER NOT NULL DEFAULT 0,       -- likes - dislikes
+    hot REAL NOT NULL DEFAULT 0,
+    controversy REAL NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES Post(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_postscore_hot ON PostScore(hot DESC);
+CREATE INDEX IF NOT EXISTS idx_postscore_score ON PostScore(score DESC);
+CREATE INDEX IF NOT EXISTS idx_postscore_controversy ON PostScore(controversy DESC);
+CREATE INDEX IF NOT EXISTS idx_postscore_comments ON PostScore(comment_count DESC);
+CREATE INDEX IF NOT EXISTS idx_post_created_at ON Post(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_post_created_at;
+DROP INDEX IF EXISTS idx_postscore_comments;
+DROP INDEX IF EXISTS idx_postscore_controversy;
+DROP INDEX IF EXISTS idx_postscore_score;
+DROP INDEX IF EXISTS idx_postscore_hot;
+DROP TABLE IF EXISTS PostScore;
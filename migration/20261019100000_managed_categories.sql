@@ -0,0 +1,23 @@
+-- +goose Up
+-- Les catégories deviennent une ressource gérée par les administrateurs :
+-- description, couleur, icône, ordre d'affichage et archivage.
+ALTER TABLE Categories ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE Categories ADD COLUMN color TEXT NOT NULL DEFAULT '#f0f0f0';
+ALTER TABLE Categories ADD COLUMN icon TEXT NOT NULL DEFAULT '';
+ALTER TABLE Categories ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Categories ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Catégories initiales (remplace CategoryModel.InitializeCategories)
+INSERT OR IGNORE INTO Categories (name) VALUES ('Technology'), ('Science'), ('Art'), ('Sports'), ('Music');
+
+UPDATE Categories SET position = (SELECT COUNT(*) FROM Categories c2 WHERE c2.name < Categories.name);
+
+CREATE INDEX IF NOT EXISTS idx_categories_position ON Categories(archived, position);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_categories_position;
+ALTER TABLE Categories DROP COLUMN archived;
+ALTER TABLE Categories DROP COLUMN position;
+ALTER TABLE Categories DROP COLUMN icon;
+ALTER TABLE Categories DROP COLUMN color;
+ALTER TABLE Categories DROP COLUMN description;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Sous-catégories : chaque catégorie peut avoir une catégorie parente (profondeur illimitée).
+ALTER TABLE Categories ADD COLUMN parent_id INTEGER REFERENCES Categories(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON Categories(parent_id, position);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_categories_parent;
+ALTER TABLE Categories DROP COLUMN parent_id;
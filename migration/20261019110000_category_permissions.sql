@@ -0,0 +1,55 @@
+-- +goose Up
+-- Groupes d'utilisateurs, utilisables dans les règles d'accès aux catégories
+CREATE TABLE IF NOT EXISTS UserGroup (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS UserGroupMember (
+    group_id INTEGER NOT NULL,
+    user_id UUID NOT NULL,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES UserGroup(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE
+);
+
+-- Règles d'accès : sans règle pour une action, la catégorie est ouverte (lecture pour tous,
+-- posts et commentaires pour les utilisateurs connectés). Avec des règles, il faut en satisfaire
+-- au moins une : un rôle minimum (guest < user < moderator < admin) ou l'appartenance à un groupe.
+CREATE TABLE IF NOT EXISTS CategoryPermission (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    cat_id INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('view', 'post', 'comment')),
+    role TEXT CHECK (role IN ('guest', 'user', 'moderator', 'admin')),
+    group_id INTEGER,
+    CHECK ((role IS NULL) <> (group_id IS NULL)),
+    FOREIGN KEY (cat_id) REFERENCES Categories(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES UserGroup(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_permission ON CategoryPermission(cat_id, action);
+CREATE INDEX IF NOT EXISTS idx_user_group_member_user ON UserGroupMember(user_id);
+
+-- Catégorie d'annonces en lecture seule : seuls les administrateurs y publient
+INSERT OR IGNORE INTO Categories (name, description, color, icon, position)
+VALUES ('Announcements', 'Official announcements from the team', '#e53935', '📢', -1);
+
+INSERT INTO CategoryPermission (cat_id, action, role)
+SELECT id, 'post', 'admin' FROM Categories WHERE name = 'Announcements';
+
+-- Catégorie réservée à l'équipe, invisible pour les autres utilisateurs
+INSERT OR IGNORE INTO Categories (name, description, color, icon, position)
+VALUES ('Staff', 'Private discussions between moderators and admins', '#546e7a', '🔒',
+        (SELECT COALESCE(MAX(position), 0) + 1 FROM Categories));
+
+INSERT INTO CategoryPermission (cat_id, action, role)
+SELECT id, 'view', 'moderator' FROM Categories WHERE name = 'Staff';
+
+-- +goose Down
+DELETE FROM Catpostrel WHERE cat_id IN (SELECT id FROM Categories WHERE name IN ('Announcements', 'Staff'));
+DELETE FROM Categories WHERE name IN ('Announcements', 'Staff');
+DROP INDEX IF EXISTS idx_user_group_member_user;
+DROP INDEX IF EXISTS idx_category_permission;
+DROP TABLE IF EXISTS CategoryPermission;
+DROP TABLE IF EXISTS UserGroupMember;
+DROP TABLE IF EXISTS UserGroup;
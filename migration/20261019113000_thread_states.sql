@@ -0,0 +1,41 @@
+-- +goose Up
+-- États d'un fil : épinglé en tête des fils, verrouillé (plus de commentaires)
+-- ou archivé (lecture seule, absent des fils par défaut)
+ALTER TABLE Post ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Post ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Post ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Post ADD COLUMN last_activity_at TIMESTAMP;
+
+-- Dernière activité : le commentaire le plus récent, ou la création du post
+UPDATE Post SET last_activity_at = COALESCE(
+    (SELECT MAX(c.created_at) FROM Comment c WHERE c.post_id = Post.id),
+    created_at
+);
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Post_activity_insert AFTER INSERT ON Post
+WHEN NEW.last_activity_at IS NULL
+BEGIN
+    UPDATE Post SET last_activity_at = COALESCE(NEW.created_at, datetime('now')) WHERE id = NEW.id;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS Post_activity_comment AFTER INSERT ON Comment
+BEGIN
+    UPDATE Post SET last_activity_at = datetime('now') WHERE id = NEW.post_id;
+END;
+-- +goose StatementEnd
+
+CREATE INDEX IF NOT EXISTS idx_post_archived_pinned ON Post(archived, pinned);
+CREATE INDEX IF NOT EXISTS idx_post_last_activity ON Post(archived, last_activity_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_post_last_activity;
+DROP INDEX IF EXISTS idx_post_archived_pinned;
+DROP TRIGGER IF EXISTS Post_activity_comment;
+DROP TRIGGER IF EXISTS Post_activity_insert;
+ALTER TABLE Post DROP COLUMN last_activity_at;
+ALTER TABLE Post DROP COLUMN archived;
+ALTER TABLE Post DROP COLUMN locked;
+ALTER TABLE Post DROP COLUMN pinned;
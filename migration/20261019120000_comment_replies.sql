@@ -0,0 +1,13 @@
+-- +goose Up
+-- Réponses imbriquées : un commentaire peut répondre à un autre commentaire du même post.
+-- Un commentaire supprimé qui a des réponses reste en place (deleted = 1, contenu vidé)
+-- pour ne pas casser le fil.
+ALTER TABLE Comment ADD COLUMN parent_id INTEGER REFERENCES Comment(id);
+ALTER TABLE Comment ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_comment_parent ON Comment(parent_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_comment_parent;
+ALTER TABLE Comment DROP COLUMN deleted;
+ALTER TABLE Comment DROP COLUMN parent_id;
@@ -0,0 +1,69 @@
+-- +goose Up
+-- Réactions génériques : une réaction (like, dislike ou emoji) par utilisateur et par cible,
+-- la cible étant un post ou un commentaire. Remplace LikeDislikePost et LikeDislikeComment.
+CREATE TABLE IF NOT EXISTS Reaction (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    reaction TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    UNIQUE (user_id, target_type, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reaction_target ON Reaction(target_type, target_id, reaction);
+
+INSERT INTO Reaction (user_id, target_type, target_id, reaction, created_at)
+SELECT user_id, 'post', post_id, CASE WHEN like = 1 THEN 'like' ELSE 'dislike' END, created_at
+FROM LikeDislikePost
+WHERE like = 1 OR dislike = 1;
+
+INSERT INTO Reaction (user_id, target_type, target_id, reaction, created_at)
+SELECT user_id, 'comment', comment_id, CASE WHEN like = 1 THEN 'like' ELSE 'dislike' END, created_at
+FROM LikeDislikeComment
+WHERE like = 1 OR dislike = 1;
+
+DROP TABLE LikeDislikePost;
+DROP TABLE LikeDislikeComment;
+
+-- +goose Down
+CREATE TABLE LikeDislikePost (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,
+    post_id INTEGER NOT NULL,
+    like INTEGER DEFAULT 0,
+    dislike INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    FOREIGN KEY (post_id) REFERENCES Post(id),
+    UNIQUE (user_id, post_id),
+    CHECK (like + dislike <= 1)
+);
+
+CREATE TABLE LikeDislikeComment (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,
+    comment_id INTEGER NOT NULL,
+    like INTEGER DEFAULT 0,
+    dislike INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    FOREIGN KEY (comment_id) REFERENCES Comment(id),
+    UNIQUE (user_id, comment_id),
+    CHECK (like + dislike <= 1)
+);
+
+-- Les réactions emoji n'ont pas d'équivalent et sont perdues
+INSERT INTO LikeDislikePost (user_id, post_id, like, dislike, created_at)
+SELECT user_id, target_id, reaction = 'like', reaction = 'dislike', created_at
+FROM Reaction
+WHERE target_type = 'post' AND reaction IN ('like', 'dislike');
+
+INSERT INTO LikeDislikeComment (user_id, comment_id, like, dislike, created_at)
+SELECT user_id, target_id, reaction = 'like', reaction = 'dislike', created_at
+FROM Reaction
+WHERE target_type = 'comment' AND reaction IN ('like', 'dislike');
+
+DROP INDEX IF EXISTS idx_reaction_target;
+DROP TABLE IF EXISTS Reaction;
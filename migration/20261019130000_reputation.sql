@@ -0,0 +1,28 @@
+-- +goose Up
+-- Journal de réputation : une ligne par like ou dislike reçu sur un post ou un commentaire,
+-- avec le poids de la réaction et les points réellement comptés après le plafond quotidien.
+-- La réputation d'un utilisateur est la somme de ses points ; le journal peut être recalculé
+-- à partir de la table Reaction. Les votes antérieurs au journal y sont reportés au premier
+-- démarrage du forum (ReputationModel.Backfill).
+CREATE TABLE IF NOT EXISTS ReputationLedger (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,        -- auteur du contenu, qui reçoit les points
+    voter_id UUID NOT NULL,       -- auteur de la réaction
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    reaction TEXT NOT NULL,
+    weight INTEGER NOT NULL,      -- points prévus par la configuration
+    points INTEGER NOT NULL,      -- points comptés (weight réduit par le plafond quotidien)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    FOREIGN KEY (voter_id) REFERENCES Users(id),
+    UNIQUE (voter_id, target_type, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reputation_user ON ReputationLedger(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_reputation_target ON ReputationLedger(target_type, target_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_reputation_target;
+DROP INDEX IF EXISTS idx_reputation_user;
+DROP TABLE IF EXISTS ReputationLedger;
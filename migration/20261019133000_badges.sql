@@ -0,0 +1,61 @@
+-- +goose Up
+-- Badges obtenus par les utilisateurs ; le nom et la description viennent des règles de badges.
+CREATE TABLE IF NOT EXISTS UserBadge (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,
+    badge TEXT NOT NULL,          -- identifiant de la règle (slug)
+    awarded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    UNIQUE (user_id, badge)
+);
+
+-- Une notification de badge ne désigne ni post ni commentaire : la contrainte devient
+-- "au plus un des deux", et la colonne data porte le détail (nom du badge).
+CREATE TABLE Notification_new (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,
+    user_id2 UUID NOT NULL,
+    post_id INTEGER,
+    comment_id INTEGER,
+    type TEXT NOT NULL,
+    data TEXT,
+    read BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    FOREIGN KEY (post_id) REFERENCES Post(id),
+    FOREIGN KEY (comment_id) REFERENCES Comment(id),
+    CHECK (post_id IS NULL OR comment_id IS NULL)
+);
+
+INSERT INTO Notification_new (id, user_id, user_id2, post_id, comment_id, type, read, created_at)
+SELECT id, user_id, user_id2, post_id, comment_id, type, read, created_at FROM Notification;
+
+DROP TABLE Notification;
+ALTER TABLE Notification_new RENAME TO Notification;
+
+-- +goose Down
+CREATE TABLE Notification_old (
+    id INTEGER PRIMARY KEY,
+    user_id UUID NOT NULL,
+    user_id2 UUID NOT NULL,
+    post_id INTEGER,
+    comment_id INTEGER,
+    type TEXT NOT NULL,
+    read BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    FOREIGN KEY (post_id) REFERENCES Post(id),
+    FOREIGN KEY (comment_id) REFERENCES Comment(id),
+    CHECK ((post_id IS NOT NULL AND comment_id IS NULL) 
+           OR (post_id IS NULL AND comment_id IS NOT NULL))
+);
+
+-- Les notifications sans post ni commentaire (badges) ne respectent pas l'ancienne contrainte
+INSERT INTO Notification_old (id, user_id, user_id2, post_id, comment_id, type, read, created_at)
+SELECT id, user_id, user_id2, post_id, comment_id, type, read, created_at FROM Notification
+WHERE post_id IS NOT NULL OR comment_id IS NOT NULL;
+
+DROP TABLE Notification;
+ALTER TABLE Notification_old RENAME TO Notification;
+
+DROP TABLE IF EXISTS UserBadge;
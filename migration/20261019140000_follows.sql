@@ -0,0 +1,19 @@
+-- +goose Up
+-- Abonnements entre utilisateurs : follower_id suit followed_id.
+-- notify permet de suivre quelqu'un sans être notifié de chacun de ses posts.
+CREATE TABLE IF NOT EXISTS Follow (
+    follower_id UUID NOT NULL,
+    followed_id UUID NOT NULL,
+    notify BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followed_id),
+    FOREIGN KEY (follower_id) REFERENCES Users(id),
+    FOREIGN KEY (followed_id) REFERENCES Users(id),
+    CHECK (follower_id != followed_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_followed ON Follow(followed_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_follow_followed;
+DROP TABLE IF EXISTS Follow;
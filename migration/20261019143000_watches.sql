@@ -0,0 +1,19 @@
+-- +goose Up
+-- Abonnements aux nouveaux commentaires d'un post ou aux nouveaux posts d'une catégorie.
+-- Se désabonner garde la ligne avec active = 0, pour qu'un nouveau commentaire
+-- ne réabonne pas automatiquement l'utilisateur au post.
+CREATE TABLE IF NOT EXISTS Watch (
+    user_id UUID NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'category')),
+    target_id INTEGER NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_watch_target ON Watch(target_type, target_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_watch_target;
+DROP TABLE IF EXISTS Watch;
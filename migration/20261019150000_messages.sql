@@ -0,0 +1,72 @@
+-- +goose Up
+-- Conversations privées à deux ou en petit groupe.
+CREATE TABLE IF NOT EXISTS Conversation (
+    id INTEGER PRIMARY KEY,
+    title TEXT,                   -- titre facultatif d'une conversation de groupe
+    created_by UUID NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES Users(id)
+);
+
+-- Participants : last_read_id est le dernier message lu ; supprimer la conversation pour soi
+-- la masque (hidden) et ne garde que les messages postérieurs à cleared_id.
+CREATE TABLE IF NOT EXISTS ConversationParticipant (
+    conversation_id INTEGER NOT NULL,
+    user_id UUID NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    cleared_id INTEGER NOT NULL DEFAULT 0,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES Conversation(id),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_participant_user ON ConversationParticipant(user_id);
+
+CREATE TABLE IF NOT EXISTS Message (
+    id INTEGER PRIMARY KEY,
+    conversation_id INTEGER NOT NULL,
+    sender_id UUID NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES Conversation(id),
+    FOREIGN KEY (sender_id) REFERENCES Users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_conversation ON Message(conversation_id, id);
+
+-- Utilisateurs qui refusent les messages d'un autre utilisateur
+CREATE TABLE IF NOT EXISTS UserBlock (
+    blocker_id UUID NOT NULL,
+    blocked_id UUID NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES Users(id),
+    FOREIGN KEY (blocked_id) REFERENCES Users(id),
+    CHECK (blocker_id != blocked_id)
+);
+
+-- Signalements de conversations : tant qu'un signalement est ouvert, les modérateurs peuvent lire la conversation
+CREATE TABLE IF NOT EXISTS ConversationReport (
+    id INTEGER PRIMARY KEY,
+    conversation_id INTEGER NOT NULL,
+    user_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES Conversation(id),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_report_open ON ConversationReport(resolved, conversation_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_conversation_report_open;
+DROP TABLE IF EXISTS ConversationReport;
+DROP TABLE IF EXISTS UserBlock;
+DROP INDEX IF EXISTS idx_message_conversation;
+DROP TABLE IF EXISTS Message;
+DROP INDEX IF EXISTS idx_conversation_participant_user;
+DROP TABLE IF EXISTS ConversationParticipant;
+DROP TABLE IF EXISTS Conversation;
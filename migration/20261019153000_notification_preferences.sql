@@ -0,0 +1,18 @@
+-- +goose Up
+-- Préférences de notification : un réglage par utilisateur, événement (likes, replies...) et canal.
+-- Un couple absent garde la valeur par défaut définie dans le code.
+CREATE TABLE IF NOT EXISTS NotificationPreference (
+    user_id UUID NOT NULL,
+    event TEXT NOT NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('in_app', 'email', 'digest')),
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, event, channel),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- Une notification coupée sur le site mais gardée pour l'email ou le résumé n'apparaît pas dans la cloche.
+ALTER TABLE Notification ADD COLUMN in_app BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE Notification DROP COLUMN in_app;
+DROP TABLE IF EXISTS NotificationPreference;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Fréquence du résumé par email choisie par chaque utilisateur ; sans ligne, le résumé est hebdomadaire.
+CREATE TABLE IF NOT EXISTS DigestSubscription (
+    user_id UUID PRIMARY KEY,
+    frequency TEXT NOT NULL CHECK (frequency IN ('off', 'daily', 'weekly')),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- Résumés envoyés : une ligne par utilisateur et par période (jour "2026-10-19" ou semaine "2026-W42"),
+-- réservée avant l'envoi pour qu'un résumé ne parte qu'une fois.
+CREATE TABLE IF NOT EXISTS DigestLog (
+    user_id UUID NOT NULL,
+    period TEXT NOT NULL,
+    frequency TEXT NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, period),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS DigestLog;
+DROP TABLE IF EXISTS DigestSubscription;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Utilisateurs mentionnés (@username) dans un post ou un commentaire : chacun n'est prévenu
+-- qu'une fois par post ou commentaire, même si son texte est modifié ensuite.
+CREATE TABLE IF NOT EXISTS Mention (
+    source_type TEXT NOT NULL CHECK (source_type IN ('post', 'comment')),
+    source_id INTEGER NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source_type, source_id, user_id),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS Mention;
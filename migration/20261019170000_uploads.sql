@@ -0,0 +1,21 @@
+-- +goose Up
+-- Images envoyées par les utilisateurs. Le fichier est nommé d'après l'empreinte SHA-256 de son contenu :
+-- une même image envoyée plusieurs fois n'est stockée qu'une fois, avec une ligne par utilisateur.
+CREATE TABLE IF NOT EXISTS Uploads (
+    kind TEXT NOT NULL CHECK (kind IN ('post', 'profile')),
+    name TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, name, user_id),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_user ON Uploads(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_uploads_user;
+DROP TABLE IF EXISTS Uploads;
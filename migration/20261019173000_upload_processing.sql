@@ -0,0 +1,10 @@
+-- +goose Up
+-- État du traitement des images envoyées : ré-encodage sans métadonnées et tailles dérivées.
+-- Les images déjà envoyées sont remises en attente pour être traitées au démarrage.
+ALTER TABLE Uploads ADD COLUMN status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed'));
+
+CREATE INDEX IF NOT EXISTS idx_uploads_status ON Uploads(status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_uploads_status;
+ALTER TABLE Uploads DROP COLUMN status;
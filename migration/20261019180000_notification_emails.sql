@@ -0,0 +1,10 @@
+-- +goose Up
+-- Notifications à envoyer par email : elles partent en arrière-plan, et celles qui n'ont pas pu partir
+-- (file pleine, serveur SMTP injoignable, redémarrage) sont reprises régulièrement.
+ALTER TABLE Notification ADD COLUMN email_pending BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_notification_email_pending ON Notification(email_pending) WHERE email_pending = 1;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_notification_email_pending;
+ALTER TABLE Notification DROP COLUMN email_pending;
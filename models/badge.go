@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// BadgeRule décrit un badge de façon déclarative : il est attribué aux utilisateurs
+// dont la valeur de Metric atteint Threshold.
+type BadgeRule struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Metric      string `json:"metric"`
+	Threshold   int    `json:"threshold"`
+}
+
+// Badge est un badge obtenu par un utilisateur.
+type Badge struct {
+	BadgeRule
+	AwardedAt time.Time
+}
@@ -1,7 +1,14 @@
 package models
 
 type Category struct {
-	ID        int
-	Name      string
-	PostCount int
+	ID          int
+	Name        string
+	PostCount   int // Posts de la catégorie et de ses sous-catégories
+	Description string
+	Color       string
+	Icon        string
+	Position    int
+	Archived    bool
+	ParentID    int // 0 pour une catégorie racine
+	Depth       int // Profondeur dans l'arbre, 0 pour une catégorie racine
 }
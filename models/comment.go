@@ -9,11 +9,24 @@ type Comment struct {
 	UserID              User
 	PostID              int
 	Content             string
-	LikeDislikeComment  []LikeDislikeComment
+	Reactions           ReactionSummary
 	CreatedAt           time.Time
 	LikeCountComment    int
 	DislikeCountComment int
 	UserAction          string
+	ParentID            int       // 0 pour un commentaire de premier niveau
+	Depth               int       // 0 pour un commentaire de premier niveau
+	Deleted             bool      // supprimé mais conservé car il a des réponses
+	Replies             []Comment // réponses, dans l'ordre du tri des commentaires
+}
+
+// CommentPage est une page de commentaires de premier niveau d'un post, avec leurs réponses.
+type CommentPage struct {
+	Comments []Comment
+	Sort     string // "newest", "oldest" ou "best"
+	Page     int    // numéro de la page, à partir de 1
+	Pages    int    // nombre total de pages (au moins 1)
+	Total    int    // nombre de commentaires de premier niveau
 }
 
 type CommentActivity struct {
@@ -21,7 +34,7 @@ type CommentActivity struct {
 	UserID              User
 	PostID              Post
 	Content             string
-	LikeDislikeComment  []LikeDislikeComment
+	Reactions           ReactionSummary
 	CreatedAt           time.Time
 	LikeCountComment    int
 	DislikeCountComment int
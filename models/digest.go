@@ -0,0 +1,43 @@
+package models
+
+// Email est un message prêt à partir, en texte brut et en HTML.
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // en-têtes supplémentaires, par exemple List-Unsubscribe
+}
+
+// Digest est le résumé par email envoyé à un utilisateur pour une période.
+type Digest struct {
+	Username       string
+	Frequency      string // "daily" ou "weekly"
+	Notifications  []DigestNotification
+	WatchedPosts   []DigestPost // nouveaux posts des catégories suivies
+	TopPosts       []DigestPost
+	SiteURL        string
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+// DigestNotification est une notification non lue reprise dans un résumé.
+type DigestNotification struct {
+	Text string
+	URL  string
+}
+
+// DigestPost est un post cité dans un résumé.
+type DigestPost struct {
+	Title    string
+	Author   string
+	URL      string
+	Score    int
+	Comments int
+}
+
+// Empty indique si le résumé n'apporte rien de propre à l'utilisateur : les meilleurs posts seuls
+// ne justifient pas un email.
+func (d Digest) Empty() bool {
+	return len(d.Notifications) == 0 && len(d.WatchedPosts) == 0
+}
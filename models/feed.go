@@ -0,0 +1,8 @@
+package models
+
+// FeedSort décrit l'ordre d'affichage d'un fil de posts et les posts qu'il contient.
+type FeedSort struct {
+	Mode   string // "new", "hot", "top", "controversial" ou "comments"
+	Window string // fenêtre du tri "top" : "day", "week", "month" ou "all"
+	Feed   string // "all", ou "following" pour les seuls posts des utilisateurs suivis
+}
@@ -0,0 +1,15 @@
+package models
+
+// PostFilter regroupe les critères combinables du filtre de posts.
+type PostFilter struct {
+	Categories  []string
+	MatchAll    bool // true : le post doit avoir toutes les catégories (AND), sinon au moins une (OR)
+	Author      string
+	LikedByMe   bool   // réservé aux utilisateurs connectés
+	CreatedByMe bool   // réservé aux utilisateurs connectés
+	From        string // date au format AAAA-MM-JJ (incluse)
+	To          string // date au format AAAA-MM-JJ (incluse)
+	MinScore    *int   // solde likes - dislikes minimum, nil pour ne pas filtrer
+	Sort        FeedSort
+	Archived    bool // Inclure les fils archivés
+}
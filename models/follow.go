@@ -0,0 +1,9 @@
+package models
+
+// FollowStats résume les abonnements d'un utilisateur vus par le visiteur.
+type FollowStats struct {
+	Followers  int  // nombre d'abonnés
+	Following  int  // nombre d'utilisateurs suivis
+	IsFollowed bool // le visiteur suit cet utilisateur
+	Notify     bool // le visiteur est notifié des nouveaux posts de cet utilisateur
+}
@@ -0,0 +1,26 @@
+package models
+
+// Types des événements poussés aux visiteurs d'un post.
+const (
+	LiveComment        = "comment"         // nouveau commentaire (ID, ParentID)
+	LiveCommentEdited  = "comment_edited"  // commentaire modifié (ID, Content)
+	LiveCommentDeleted = "comment_deleted" // commentaire supprimé (ID ; Removed s'il a disparu du fil)
+	LiveVotes          = "votes"           // compteurs de réactions (Target, ID, Counts)
+	LivePresence       = "presence"        // nombre de visiteurs (Viewers)
+	LiveTyping         = "typing"          // un utilisateur écrit un commentaire (User)
+	LiveStale          = "stale"           // des événements ont été perdus : la page doit être rechargée
+)
+
+// LiveEvent est un événement poussé en temps réel aux visiteurs d'un post.
+type LiveEvent struct {
+	Seq      int            `json:"-"` // numéro d'ordre, identifiant de l'événement pour Last-Event-ID ; 0 : éphémère
+	Type     string         `json:"type"`
+	ID       int            `json:"id,omitempty"`
+	ParentID int            `json:"parent_id,omitempty"`
+	Target   string         `json:"target,omitempty"`
+	Content  string         `json:"content,omitempty"`
+	Removed  bool           `json:"removed,omitempty"`
+	Counts   map[string]int `json:"counts,omitempty"`
+	Viewers  int            `json:"viewers,omitempty"`
+	User     string         `json:"user,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Conversation est une conversation privée vue par l'un de ses participants ou par un modérateur.
+type Conversation struct {
+	ID           int
+	Title        string
+	Participants []User
+	Messages     []Message
+	Reported     bool // un signalement est en attente
+	CreatedAt    time.Time
+}
+
+// Message est un message d'une conversation privée.
+type Message struct {
+	ID        int
+	Sender    User
+	Content   string
+	CreatedAt time.Time
+}
+
+// ConversationSummary est une ligne de la boîte de réception.
+type ConversationSummary struct {
+	ID           int
+	Title        string
+	Participants []User // participants autres que l'utilisateur
+	LastMessage  Message
+	Unread       int // messages non lus
+}
+
+// ConversationReport est un signalement de conversation en attente de modération.
+type ConversationReport struct {
+	ID             int
+	ConversationID int
+	Title          string
+	Reporter       User
+	Reason         string
+	CreatedAt      time.Time
+}
@@ -1,5 +1,7 @@
 package models
 
+import "fmt"
+
 type Notification struct {
 	Id         int
 	UserId     User
@@ -7,6 +9,85 @@ type Notification struct {
 	Post_Id    *Post
 	Comment_Id *Comment
 	Type       string
+	Data       string // détail propre au type (nom du badge, action de modération)
 	IsRead     bool
 	CreatedAt  string
+	Count      int // notifications non lues regroupées sous celle-ci, elle comprise
+	Others     int // auteurs du groupe autres que UserId2
+}
+
+// NotificationQuery décrit une page de la liste des notifications.
+type NotificationQuery struct {
+	UnreadOnly bool
+	Page       int
+	PerPage    int
+}
+
+// Who retourne l'auteur d'une notification et, pour un groupe, le nombre des autres : "alice et 12 autres".
+func (n Notification) Who() string {
+	switch n.Others {
+	case 0:
+		return n.UserId2.Username
+	case 1:
+		return n.UserId2.Username + " et 1 autre"
+	}
+	return fmt.Sprintf("%s et %d autres", n.UserId2.Username, n.Others)
+}
+
+// Verb accorde le verbe avec les auteurs de la notification : {{ .Verb "a aimé" "ont aimé" }}.
+func (n Notification) Verb(singular, plural string) string {
+	if n.Others > 0 {
+		return plural
+	}
+	return singular
+}
+
+// NotificationEvent est une notification poussée en temps réel sur /notification/stream.
+type NotificationEvent struct {
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Actor  string `json:"actor"`
+	Text   string `json:"text"`
+	Link   string `json:"link"`
+	Unread int    `json:"unread"` // notifications non lues du destinataire, celle-ci comprise
+}
+
+// NotificationDraft est une notification à envoyer, avant le choix des canaux par son destinataire.
+type NotificationDraft struct {
+	UserID    string // destinataire
+	ActorID   string // auteur de l'action
+	PostID    int    // 0 : aucun
+	CommentID int    // 0 : aucun
+	Type      string
+	Data      string
+}
+
+// NotificationPreference est le réglage d'un événement sur chaque canal.
+type NotificationPreference struct {
+	Event    string
+	Label    string
+	Channels map[string]bool // canal -> activé
+}
+
+// moderationVerbs sont les actions de modération annoncées à l'auteur d'un post.
+var moderationVerbs = map[string]string{
+	"pinned":   "a épinglé",
+	"unpinned": "a désépinglé",
+	"locked":   "a verrouillé",
+	"unlocked": "a déverrouillé",
+	"archived": "a archivé",
+	"restored": "a restauré",
+}
+
+// ModerationVerb retourne l'action d'une notification de modération, par exemple "a verrouillé".
+func (n Notification) ModerationVerb() string {
+	return ModerationVerb(n.Data)
+}
+
+// ModerationVerb retourne le verbe d'une action de modération ("locked" : "a verrouillé").
+func ModerationVerb(action string) string {
+	if verb, ok := moderationVerbs[action]; ok {
+		return verb
+	}
+	return "a modéré"
 }
@@ -0,0 +1,20 @@
+package models
+
+// CategoryPermission est une règle d'accès à une catégorie pour une action
+// ("view", "post" ou "comment"), accordée à un rôle minimum ou à un groupe.
+type CategoryPermission struct {
+	ID           int
+	CategoryID   int
+	CategoryName string
+	Action       string
+	Role         string // vide si la règle porte sur un groupe
+	GroupID      int    // 0 si la règle porte sur un rôle
+	GroupName    string
+}
+
+// UserGroup regroupe des utilisateurs auxquels on peut ouvrir des catégories.
+type UserGroup struct {
+	ID      int
+	Name    string
+	Members []User
+}
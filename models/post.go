@@ -15,5 +15,9 @@ type Post struct {
 	LikeCount    int
 	DislikeCount int
 	UserAction   string
+	Reactions    ReactionSummary
 	CreatedAt    time.Time
+	Pinned       bool // Affiché en tête des fils
+	Locked       bool // Plus de nouveaux commentaires
+	Archived     bool // Lecture seule, absent des fils par défaut
 }
@@ -0,0 +1,13 @@
+package models
+
+// ReactionKind est une réaction proposée aux utilisateurs : like, dislike ou emoji.
+type ReactionKind struct {
+	Name  string `json:"name"`  // identifiant enregistré en base, ex. "like" ou "laugh"
+	Emoji string `json:"emoji"` // symbole affiché
+}
+
+// ReactionSummary résume les réactions sur un post ou un commentaire.
+type ReactionSummary struct {
+	Counts map[string]int // nombre de réactions par nom
+	Mine   string         // réaction de l'utilisateur courant, vide s'il n'a pas réagi
+}
@@ -0,0 +1,12 @@
+package models
+
+// ReputationRules règle le calcul de la réputation : points par like ou dislike reçu,
+// plafond quotidien des points gagnés et seuils de réputation des privilèges.
+type ReputationRules struct {
+	PostLike       int            `json:"post_like"`
+	PostDislike    int            `json:"post_dislike"`
+	CommentLike    int            `json:"comment_like"`
+	CommentDislike int            `json:"comment_dislike"`
+	DailyCap       int            `json:"daily_cap"`  // points gagnés au plus par jour ; 0 ou négatif : pas de plafond
+	Privileges     map[string]int `json:"privileges"` // réputation minimale par privilège
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"html/template"
+	"time"
+)
+
+// SearchQuery regroupe les paramètres d'une recherche plein texte.
+type SearchQuery struct {
+	Terms    string
+	Category string
+	Author   string
+	From     string // date au format AAAA-MM-JJ (incluse)
+	To       string // date au format AAAA-MM-JJ (incluse)
+	Page     int
+	PerPage  int
+}
+
+// SearchResult représente un post ou un commentaire correspondant à une recherche.
+type SearchResult struct {
+	Kind      string // "post" ou "comment"
+	PostID    int
+	CommentID int
+	Title     string
+	Snippet   template.HTML // extrait échappé, termes trouvés entourés de <mark>
+	Author    User
+	CreatedAt time.Time
+}
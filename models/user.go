@@ -7,11 +7,12 @@ import (
 )
 
 type User struct {
-	Id        uuid.UUID
-	Username  string
-	Email     string
-	Password  string
-	Picture   string
-	Roles     string
-	CreatedAt time.Time
+	Id         uuid.UUID
+	Username   string
+	Email      string
+	Password   string
+	Picture    string
+	Roles      string
+	CreatedAt  time.Time
+	Reputation int // somme des points du journal de réputation
 }
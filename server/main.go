@@ -25,40 +25,161 @@ func main() {
 
 	handlers.LoadConfig()
 
+	// Règles d'accès par catégorie, partagées par les services qui lisent ou écrivent des posts
+	permissions := &services.PermissionModel{
+		DB: db,
+	}
+
+	// Diffusion en direct des commentaires et des réactions aux visiteurs d'un post
+	live := &services.LiveHub{}
+
+	// Réactions (like, dislike et emoji) sur les posts et les commentaires
+	reactions := &services.ReactionModel{
+		DB:    db,
+		Kinds: handlers.AppConfig.Reactions,
+		Live:  live,
+	}
+
+	// Réputation gagnée par les votes reçus, qui débloque des privilèges
+	reputation := &services.ReputationModel{
+		DB:    db,
+		Rules: handlers.AppConfig.Reputation,
+	}
+	if err := reputation.Backfill(); err != nil {
+		log.Printf("Erreur lors du calcul initial de la réputation : %v", err)
+	}
+
+	// Diffusion des nouvelles notifications aux pages ouvertes
+	hub := &services.NotificationHub{
+		MaxPerUser: handlers.AppConfig.NotificationStreamLimit(),
+	}
+
+	notifications := &services.Notification{
+		DB:  db,
+		Hub: hub,
+	}
+
+	// Résumés par email et notifications du canal email
+	digests := &services.DigestModel{
+		DB:            db,
+		Notifications: notifications,
+		Permissions:   permissions,
+		Mailer:        handlers.AppConfig.Mailer(),
+		Templates:     filepath.Join(ProjectPath, "templates"),
+		BaseURL:       handlers.AppConfig.SiteURL(),
+		Secret:        handlers.AppConfig.MailSecret(),
+	}
+	notifications.Email = digests
+
+	// Notifications des utilisateurs mentionnés (@username) dans les posts et les commentaires
+	mentions := &services.MentionModel{
+		DB:            db,
+		Permissions:   permissions,
+		Notifications: notifications,
+	}
+
+	// Stockage des images envoyées, partagé par les instances du forum avec un service compatible S3
+	storage, err := handlers.AppConfig.MediaStorage()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	app := &config.App{
 		Posts: &services.PostModel{
-			DB: db,
-			LikeModel: &services.LikeModel{
-				DB: db,
-			},
+			DB:          db,
+			Reactions:   reactions,
+			Permissions: permissions,
+			Mentions:    mentions,
 		},
 		Comment: &services.CommentModel{
-			DB: db,
-			LikeModelComment: &services.LikeModelComment{
-				DB: db,
-			},
+			DB:          db,
+			Reactions:   reactions,
+			Permissions: permissions,
+			MaxDepth:    handlers.AppConfig.ReplyDepth(),
+			Live:        live,
+			Mentions:    mentions,
 		},
 		Sessions: &services.Session{
 			DB: db,
 		},
-		Likes: &services.LikeModel{
-			DB: db,
-		},
+		Reactions: reactions,
 		Category: &services.CategoryModel{
-			DB: db,
+			DB:          db,
+			Permissions: permissions,
+			Reactions:   reactions,
 		},
 		User: &services.UserModel{
 			DB: db,
 		},
-		CommentLikes: &services.LikeModelComment{
-			DB: db,
+		Notification: notifications,
+		Digests:      digests,
+		Hub:          hub,
+		Live:         live,
+		Activity: &services.Activity{
+			DB:          db,
+			Permissions: permissions,
 		},
-		Notification: &services.Notification{
-			DB: db,
+		Search: &services.SearchModel{
+			DB:          db,
+			Permissions: permissions,
 		},
-		Activity: &services.Activity{
+		Scores: &services.ScoreModel{
 			DB: db,
 		},
+		Permissions: permissions,
+		Reputation:  reputation,
+		Badges: &services.BadgeModel{
+			DB:            db,
+			Rules:         handlers.AppConfig.Badges,
+			Notifications: notifications,
+		},
+		Follows: &services.FollowModel{
+			DB:            db,
+			Permissions:   permissions,
+			Notifications: notifications,
+			DailyLimit:    handlers.AppConfig.FollowNotificationLimit(),
+		},
+		Watches: &services.WatchModel{
+			DB:            db,
+			Permissions:   permissions,
+			Notifications: notifications,
+		},
+		Messages: &services.MessageModel{
+			DB:            db,
+			Notifications: notifications,
+		},
+		Uploads: &services.UploadModel{
+			DB:      db,
+			Storage: storage,
+			Legacy:  &services.LocalStorage{Dir: filepath.Join(ProjectPath, "static")},
+		},
+	}
+
+	// Recalcul périodique des scores utilisés pour trier les fils
+	go app.Scores.RunRefresher(15 * time.Minute)
+
+	// Attribution des badges
+	go app.Badges.RunEvaluator(time.Hour)
+
+	// Archivage automatique des fils inactifs
+	if days := handlers.AppConfig.ArchiveDays(); days > 0 {
+		go app.Posts.RunArchiver(days, time.Hour)
+	}
+
+	// Envoi des résumés quotidiens et hebdomadaires
+	go app.Digests.RunScheduler(time.Hour)
+
+	// Envoi en arrière-plan des notifications du canal email et reprise de celles qui ne sont pas parties
+	app.Notification.StartEmails(2)
+	go app.Notification.RunEmailSweeper(5 * time.Minute)
+
+	// Traitement des images envoyées (tailles dérivées, métadonnées retirées) et reprise de celles en attente
+	app.Uploads.Start(handlers.AppConfig.ImageWorkerCount())
+	go app.Uploads.RunSweeper(5 * time.Minute)
+
+	// Suppression des anciennes notifications lues
+	if days := handlers.AppConfig.NotificationRetention(); days > 0 {
+		go app.Notification.RunPruner(days, time.Hour)
 	}
 
 	imagePath := filepath.Join(ProjectPath, "static", "images_post")
@@ -73,37 +194,97 @@ func main() {
 	mux.HandleFunc("/post/create", appWrapper.CreatePost)
 	mux.HandleFunc("POST /post/create", appWrapper.StoredPost)
 	mux.Handle(imagePath, http.StripPrefix(imagePath, http.FileServer(http.Dir(imagePath))))
-	mux.HandleFunc("/post/", appWrapper.ShowAllPost)
+	// "/post/{id}/vote" chevauche "/post/edit/{id}" et les autres routes du même niveau, ce que le mux refuse :
+	// on la sert depuis un mux dédié, monté sur le préfixe, qui ne reçoit que les chemins non revendiqués.
+	postRoutes := http.NewServeMux()
+	postRoutes.HandleFunc("POST /post/{id}/vote", appWrapper.VotePost)
+	postRoutes.HandleFunc("/post/", appWrapper.ShowAllPost)
+	mux.Handle("/post/", postRoutes)
 	mux.HandleFunc("/post/edit/{id}", appWrapper.EditPost)
 	mux.HandleFunc("/post/delete/{id}", appWrapper.DeletePost)
 	mux.HandleFunc("/post/direct/{id}", appWrapper.ShowPost)
 	mux.HandleFunc("/post/comment/{id}", appWrapper.HandlerCommentStore)
+	mux.HandleFunc("POST /post/pin/{id}", appWrapper.PinPost)
+	mux.HandleFunc("POST /post/lock/{id}", appWrapper.LockPost)
+	mux.HandleFunc("POST /post/archive/{id}", appWrapper.ArchivePost)
+	mux.HandleFunc("POST /post/watch/{id}", appWrapper.WatchPost)
+	mux.HandleFunc("GET /post/stream/{id}", appWrapper.PostStream)
+	mux.HandleFunc("POST /post/typing/{id}", appWrapper.PostTyping)
 	mux.HandleFunc("/register", handlers.RegisterHandler)
 	mux.HandleFunc("/login", handlers.LoginHandler)
 	mux.HandleFunc("/logout", handlers.LogoutHandler)
-	mux.HandleFunc("/post/like/{id}", appWrapper.LikePost)
-	mux.HandleFunc("/post/likehome/{id}", appWrapper.LikePostHome)
-	mux.HandleFunc("/post/likeprofile/{id}", appWrapper.LikeProfile)
-	mux.HandleFunc("/post/likepostlike/{id}", appWrapper.LikePostLike)
-	mux.HandleFunc("/post/likepostcategory/{id}", appWrapper.LikePostCategory)
 	mux.HandleFunc("/profile/{username}", appWrapper.Profile)
 	mux.HandleFunc("/profile/edit/{username}", appWrapper.EditProfile)
+	mux.HandleFunc("GET /users/suggest", appWrapper.SuggestUsers)
 	mux.Handle(imageProf, http.StripPrefix(imageProf, http.FileServer(http.Dir(imageProf)))) // Handler pour les images de profil
+	mux.HandleFunc("GET /static/images_post/{file}", appWrapper.ServeUpload)
+	mux.HandleFunc("GET /static/images_profile/{file}", appWrapper.ServeUpload)
+	mux.HandleFunc("GET /media/{key...}", appWrapper.ServeMedia)
 	mux.HandleFunc("/category/{name}", appWrapper.GetAllPostByCat)
+	mux.HandleFunc("POST /category/watch/{name}", appWrapper.WatchCategory)
 	mux.HandleFunc("/like/{username}", appWrapper.LikedPagePost)
+	mux.HandleFunc("POST /follow/{username}", appWrapper.FollowUser)
+	mux.HandleFunc("POST /unfollow/{username}", appWrapper.UnfollowUser)
+	mux.HandleFunc("POST /follow/{username}/notify", appWrapper.FollowNotify)
+	mux.HandleFunc("GET /followers/{username}", appWrapper.Followers)
+	mux.HandleFunc("GET /following/{username}", appWrapper.Following)
+	mux.HandleFunc("POST /block/{username}", appWrapper.BlockUser)
+	mux.HandleFunc("POST /unblock/{username}", appWrapper.UnblockUser)
 
 	mux.HandleFunc("/comment/delete/{id}", appWrapper.DeleteComment)
 	mux.HandleFunc("/comment/edit/{id}", appWrapper.EditComment)
-	mux.HandleFunc("/comment/like/{id}", appWrapper.LikeComment)
+	commentRoutes := http.NewServeMux()
+	commentRoutes.HandleFunc("POST /comment/{id}/vote", appWrapper.VoteComment)
+	commentRoutes.HandleFunc("GET /comment/{id}/fragment", appWrapper.CommentFragment)
+	commentRoutes.HandleFunc("/comment/", func(w http.ResponseWriter, r *http.Request) {
+		appWrapper.ErrorHandler(w, r, http.StatusNotFound, "Page non trouvée")
+	})
+	mux.Handle("/comment/", commentRoutes)
+	mux.HandleFunc("GET /comment/{id}", appWrapper.CommentPermalink)
 
 	mux.HandleFunc("/notification", appWrapper.Notification)
 	mux.HandleFunc("/notification/read/{id}", appWrapper.ReadNotification)
+	mux.HandleFunc("POST /notification/read-all", appWrapper.ReadAllNotifications)
+	mux.HandleFunc("POST /notification/delete/{id}", appWrapper.DeleteNotification)
+	mux.HandleFunc("POST /notification/delete-all", appWrapper.DeleteAllNotifications)
+	mux.HandleFunc("GET /notification/stream", appWrapper.NotificationStream)
+	mux.HandleFunc("GET /notification/settings", appWrapper.NotificationSettings)
+	mux.HandleFunc("POST /notification/settings", appWrapper.SaveNotificationSettings)
+	mux.HandleFunc("GET /digest/unsubscribe", appWrapper.DigestUnsubscribe)
+	mux.HandleFunc("POST /digest/unsubscribe", appWrapper.ConfirmDigestUnsubscribe)
+	mux.HandleFunc("GET /messages", appWrapper.Inbox)
+	mux.HandleFunc("POST /messages", appWrapper.StartConversation)
+	mux.HandleFunc("GET /messages/{id}", appWrapper.ShowConversation)
+	mux.HandleFunc("POST /messages/{id}", appWrapper.SendMessage)
+	mux.HandleFunc("POST /messages/{id}/delete", appWrapper.DeleteConversation)
+	mux.HandleFunc("POST /messages/{id}/report", appWrapper.ReportConversation)
+	mux.HandleFunc("POST /messages/{id}/resolve", appWrapper.ResolveConversationReport)
+	mux.HandleFunc("GET /moderation/messages", appWrapper.ReportedConversations)
 	mux.HandleFunc("/activity", appWrapper.ActivityPageHandler)
+	mux.HandleFunc("/search", appWrapper.Search)
+	mux.HandleFunc("/filter", appWrapper.FilterPosts)
+	mux.HandleFunc("GET /admin/categories", appWrapper.AdminCategories)
+	mux.HandleFunc("POST /admin/categories/create", appWrapper.CreateCategory)
+	mux.HandleFunc("POST /admin/categories/{id}/update", appWrapper.UpdateCategory)
+	mux.HandleFunc("POST /admin/categories/{id}/move", appWrapper.MoveCategory)
+	mux.HandleFunc("POST /admin/categories/{id}/archive", appWrapper.ArchiveCategory)
+	mux.HandleFunc("POST /admin/categories/{id}/merge", appWrapper.MergeCategory)
+	mux.HandleFunc("POST /admin/categories/{id}/parent", appWrapper.SetCategoryParent)
+	mux.HandleFunc("GET /admin/permissions", appWrapper.AdminPermissions)
+	mux.HandleFunc("POST /admin/permissions/add", appWrapper.AddPermission)
+	mux.HandleFunc("POST /admin/permissions/{id}/delete", appWrapper.DeletePermission)
+	mux.HandleFunc("POST /admin/groups/create", appWrapper.CreateGroup)
+	mux.HandleFunc("POST /admin/groups/{id}/delete", appWrapper.DeleteGroup)
+	mux.HandleFunc("POST /admin/groups/{id}/members", appWrapper.AddGroupMember)
+	mux.HandleFunc("POST /admin/groups/{id}/members/remove", appWrapper.RemoveGroupMember)
+	mux.HandleFunc("POST /admin/reputation/recompute", appWrapper.RecomputeReputation)
 
 	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, ".css") {
 			w.Header().Set("Content-Type", "text/css")
 		}
+		// Les fichiers envoyés par les utilisateurs ne doivent jamais être interprétés autrement que leur type
+		w.Header().Set("X-Content-Type-Options", "nosniff")
 		http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))).ServeHTTP(w, r)
 	})
 
@@ -10,7 +10,8 @@ import (
 )
 
 type Activity struct {
-	DB *sql.DB
+	DB          *sql.DB
+	Permissions *PermissionModel // exclut les activités sur des posts devenus invisibles ; nil : pas de restriction
 }
 
 func (a *Activity) CreateActivity(userID string, activityType string, postID int, commentID int) error {
@@ -43,54 +44,22 @@ func (a *Activity) DeleteActivity(userID string, activityType string, postID int
 	return nil
 }
 
-func (a *Activity) LikeDislikeActivity(userID string, activityType string, postID int, commentID int) error {
-	var existingActivityType string
-	query := `
-		SELECT activity_type 
-		FROM Activity
-		WHERE user_id = ? AND post_id = ? AND comment_id = ?;
-	`
-	err := a.DB.QueryRow(query, userID, postID, commentID).Scan(&existingActivityType)
-	if err != nil && err != sql.ErrNoRows {
+// SetVoteActivity enregistre le like ou le dislike (activityType) de userID, en remplaçant son vote précédent.
+func (a *Activity) SetVoteActivity(userID string, activityType string, postID int, commentID int) error {
+	if err := a.RemoveVoteActivity(userID, postID, commentID); err != nil {
 		return err
 	}
+	return a.CreateActivity(userID, activityType, postID, commentID)
+}
 
-	if err == sql.ErrNoRows {
-		// Aucune interaction existante, insérer un nouveau like/dislike
-		stmt := `
-			INSERT INTO 
-				Activity (user_id, activity_type, post_id, comment_id)
-			VALUES 
-				(?, ?, ?, ?);
-		`
-		_, err := a.DB.Exec(stmt, userID, activityType, postID, commentID)
-		if err != nil {
-			return err
-		}
-	} else if existingActivityType == activityType {
-		// L'utilisateur a cliqué sur la même interaction (like ou dislike), donc on la supprime
-		stmt := `
-			DELETE FROM Activity
-			WHERE user_id = ? AND post_id = ? AND comment_id = ?;
-		`
-		_, err := a.DB.Exec(stmt, userID, postID, commentID)
-		if err != nil {
-			return err
-		}
-	} else {
-		// L'utilisateur change d'interaction (de like à dislike ou vice versa), mettre à jour
-		stmt := `
-			UPDATE Activity
-			SET activity_type = ?
-			WHERE user_id = ? AND post_id = ? AND comment_id = ?;
-		`
-		_, err := a.DB.Exec(stmt, activityType, userID, postID, commentID)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+// RemoveVoteActivity supprime le like ou le dislike de userID, quand il retire ou change son vote.
+func (a *Activity) RemoveVoteActivity(userID string, postID int, commentID int) error {
+	stmt := `
+		DELETE FROM Activity
+		WHERE user_id = ? AND post_id = ? AND comment_id = ? AND activity_type IN ('like', 'dislike');
+	`
+	_, err := a.DB.Exec(stmt, userID, postID, commentID)
+	return err
 }
 
 func (a *Activity) DeleteActivityByPostID(postID int) error {
@@ -176,6 +145,12 @@ func (a *Activity) GetPostbyUserId(userid string) error {
 func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, error) {
 	fmt.Printf("UserID: %s\n", userid)
 
+	// Le post d'une activité sur un commentaire est celui du commentaire
+	hidden, hiddenArgs, err := hiddenPostFilter(a.Permissions, userid, "COALESCE(PostForComment.id, Activity.post_id)")
+	if err != nil {
+		return nil, err
+	}
+
 	stmt := `
         SELECT 
             Activity.id AS activity_id, 
@@ -200,8 +175,8 @@ func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, e
             Post.user_id AS post_user_id,
             PostUser.username AS post_user_username,
             PostUser.picture AS post_user_picture,
-            (SELECT COUNT(*) FROM LikeDislikePost WHERE LikeDislikePost.post_id = Post.id AND LikeDislikePost.like = 1) AS post_like_count,
-            (SELECT COUNT(*) FROM LikeDislikePost WHERE LikeDislikePost.post_id = Post.id AND LikeDislikePost.dislike = 1) AS post_dislike_count,
+            (SELECT COUNT(*) FROM Reaction WHERE Reaction.target_type = 'post' AND Reaction.target_id = Post.id AND Reaction.reaction = 'like') AS post_like_count,
+            (SELECT COUNT(*) FROM Reaction WHERE Reaction.target_type = 'post' AND Reaction.target_id = Post.id AND Reaction.reaction = 'dislike') AS post_dislike_count,
 
             -- Comment Info
             Comment.id AS comment_id,
@@ -210,8 +185,8 @@ func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, e
             Comment.user_id AS comment_user_id,
             CommentUser.username AS comment_user_username,
             CommentUser.picture AS comment_user_picture,
-            (SELECT COUNT(*) FROM LikeDislikeComment WHERE LikeDislikeComment.comment_id = Comment.id AND LikeDislikeComment.like = 1) AS comment_like_count,
-            (SELECT COUNT(*) FROM LikeDislikeComment WHERE LikeDislikeComment.comment_id = Comment.id AND LikeDislikeComment.dislike = 1) AS comment_dislike_count,
+            (SELECT COUNT(*) FROM Reaction WHERE Reaction.target_type = 'comment' AND Reaction.target_id = Comment.id AND Reaction.reaction = 'like') AS comment_like_count,
+            (SELECT COUNT(*) FROM Reaction WHERE Reaction.target_type = 'comment' AND Reaction.target_id = Comment.id AND Reaction.reaction = 'dislike') AS comment_dislike_count,
 
             -- Post Info for Comment's Post
             PostForComment.id AS comment_post_id,
@@ -221,8 +196,8 @@ func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, e
             PostForComment.user_id AS comment_post_user_id,
             PostForCommentUser.username AS comment_post_user_username,
             PostForCommentUser.picture AS comment_post_user_picture,
-            (SELECT COUNT(*) FROM LikeDislikePost WHERE LikeDislikePost.post_id = PostForComment.id AND LikeDislikePost.like = 1) AS comment_post_like_count,
-            (SELECT COUNT(*) FROM LikeDislikePost WHERE LikeDislikePost.post_id = PostForComment.id AND LikeDislikePost.dislike = 1) AS comment_post_dislike_count
+            (SELECT COUNT(*) FROM Reaction WHERE Reaction.target_type = 'post' AND Reaction.target_id = PostForComment.id AND Reaction.reaction = 'like') AS comment_post_like_count,
+            (SELECT COUNT(*) FROM Reaction WHERE Reaction.target_type = 'post' AND Reaction.target_id = PostForComment.id AND Reaction.reaction = 'dislike') AS comment_post_dislike_count
 
         FROM 
             Activity
@@ -241,20 +216,19 @@ func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, e
         LEFT JOIN
             Users AS PostForCommentUser ON PostForComment.user_id = PostForCommentUser.id
         WHERE 
-            Activity.user_id = ?
+            Activity.user_id = ?` + hidden + `
         ORDER BY 
             Activity.created_at DESC;
     `
 
-	rows, err := a.DB.Query(stmt, userid)
+	rows, err := a.DB.Query(stmt, append([]interface{}{userid}, hiddenArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %v", err)
 	}
 	defer rows.Close()
 
 	var activities []models.ActivityPage
-	likeModel := LikeModel{DB: a.DB}
-	likeModelComment := LikeModelComment{DB: a.DB}
+	reactions := ReactionModel{DB: a.DB}
 
 	for rows.Next() {
 		var activity models.ActivityPage
@@ -386,7 +360,7 @@ func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, e
 			}
 
 			// Get user action on the post
-			userAction, err := likeModel.VerifyAction(fmt.Sprintf("%d", postID.Int64), userid)
+			userAction, err := reactions.Mine(TargetPost, int(postID.Int64), userid)
 			if err != nil {
 				return nil, fmt.Errorf("error getting user action on post: %v", err)
 			}
@@ -419,7 +393,7 @@ func (a *Activity) GetAllActivityByUser(userid string) ([]models.ActivityPage, e
 				return nil, fmt.Errorf("invalid UUID in commentUserID: %v", err)
 			}
 			// Get user action on the comment
-			commentAction, err := likeModelComment.VerifyActionComment(fmt.Sprintf("%d", commentID.Int64), userid)
+			commentAction, err := reactions.Mine(TargetComment, int(commentID.Int64), userid)
 			if err != nil {
 				return nil, fmt.Errorf("error getting user action on comment: %v", err)
 			}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/models"
+	"log"
+	"time"
+)
+
+// badgeMetrics associe chaque compteur utilisable dans une règle de badge à la requête
+// qui le calcule ; chaque requête retourne des lignes (user_id, value).
+var badgeMetrics = map[string]string{
+	// Posts publiés
+	"posts": `SELECT user_id, COUNT(*) AS value FROM Post GROUP BY user_id`,
+	// Commentaires publiés (hors commentaires supprimés)
+	"comments": `SELECT user_id, COUNT(*) AS value FROM Comment WHERE deleted = 0 GROUP BY user_id`,
+	// Posts aimés au moins 10 fois
+	"well_liked_posts": `
+		SELECT p.user_id, COUNT(*) AS value
+		FROM Post p
+		WHERE (SELECT COUNT(*) FROM Reaction r
+		       WHERE r.target_type = 'post' AND r.target_id = p.id AND r.reaction = 'like') >= 10
+		GROUP BY p.user_id`,
+	// Commentaires aimés au moins 3 fois
+	"liked_comments": `
+		SELECT c.user_id, COUNT(*) AS value
+		FROM Comment c
+		WHERE c.deleted = 0
+		  AND (SELECT COUNT(*) FROM Reaction r
+		       WHERE r.target_type = 'comment' AND r.target_id = c.id AND r.reaction = 'like') >= 3
+		GROUP BY c.user_id`,
+	// Jours depuis l'inscription
+	"membership_days": `SELECT id AS user_id, CAST(julianday('now') - julianday(created_at) AS INTEGER) AS value FROM Users`,
+	// Jours distincts avec au moins une activité
+	"active_days": `SELECT user_id, COUNT(DISTINCT date(created_at)) AS value FROM Activity GROUP BY user_id`,
+}
+
+// DefaultBadges sont les badges proposés quand la configuration n'en fournit pas.
+var DefaultBadges = []models.BadgeRule{
+	{Slug: "first-post", Name: "First post", Description: "Published a first post", Icon: "✍️", Metric: "posts", Threshold: 1},
+	{Slug: "popular-author", Name: "Popular author", Description: "10 posts liked 10 times or more", Icon: "⭐", Metric: "well_liked_posts", Threshold: 10},
+	{Slug: "helpful-commenter", Name: "Helpful commenter", Description: "10 comments liked 3 times or more", Icon: "💡", Metric: "liked_comments", Threshold: 10},
+	{Slug: "one-year", Name: "One year member", Description: "Member for a year", Icon: "🎂", Metric: "membership_days", Threshold: 365},
+	{Slug: "regular", Name: "Regular", Description: "Active on 30 different days", Icon: "📅", Metric: "active_days", Threshold: 30},
+}
+
+// BadgeModel attribue les badges d'après leurs règles et prévient les utilisateurs qui en obtiennent un.
+type BadgeModel struct {
+	DB            *sql.DB
+	Rules         []models.BadgeRule // règles des badges ; DefaultBadges si vide
+	Notifications *Notification
+}
+
+// Available retourne les règles des badges.
+func (m *BadgeModel) Available() []models.BadgeRule {
+	if len(m.Rules) == 0 {
+		return DefaultBadges
+	}
+	return m.Rules
+}
+
+// Evaluate parcourt les règles et attribue les badges mérités ; retourne le nombre de badges attribués.
+// Une règle en erreur est journalisée sans empêcher l'évaluation des autres.
+func (m *BadgeModel) Evaluate() int {
+	awarded := 0
+	for _, rule := range m.Available() {
+		n, err := m.evaluateRule(rule)
+		if err != nil {
+			log.Printf("Erreur lors de l'évaluation du badge %q: %v", rule.Slug, err)
+			continue
+		}
+		awarded += n
+	}
+	return awarded
+}
+
+// evaluateRule attribue un badge à ceux qui le méritent et ne l'ont pas encore.
+func (m *BadgeModel) evaluateRule(rule models.BadgeRule) (int, error) {
+	metric, ok := badgeMetrics[rule.Metric]
+	if !ok {
+		return 0, fmt.Errorf("unknown badge metric %q", rule.Metric)
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT user_id FROM (`+metric+`)
+		WHERE value >= ?
+		  AND user_id NOT IN (SELECT user_id FROM UserBadge WHERE badge = ?)`,
+		rule.Threshold, rule.Slug)
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	awarded := 0
+	for _, id := range userIDs {
+		res, err := m.DB.Exec(`INSERT OR IGNORE INTO UserBadge (user_id, badge) VALUES (?, ?)`, id, rule.Slug)
+		if err != nil {
+			return awarded, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		awarded++
+
+		if m.Notifications != nil {
+			if err := m.Notifications.AddBadgeNotification(id, rule.Name); err != nil {
+				log.Printf("Erreur lors de la notification du badge %q: %v", rule.Slug, err)
+			}
+		}
+	}
+	return awarded, nil
+}
+
+// RunEvaluator attribue les badges à intervalle régulier ; à lancer dans une goroutine.
+func (m *BadgeModel) RunEvaluator(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if awarded := m.Evaluate(); awarded > 0 {
+			log.Printf("%d badge(s) attribué(s)", awarded)
+		}
+		<-ticker.C
+	}
+}
+
+// ForUser retourne les badges obtenus par un utilisateur, du plus ancien au plus récent.
+// Les badges dont la règle n'existe plus ne sont pas retournés.
+func (m *BadgeModel) ForUser(userID string) ([]models.Badge, error) {
+	rules := make(map[string]models.BadgeRule)
+	for _, rule := range m.Available() {
+		rules[rule.Slug] = rule
+	}
+
+	rows, err := m.DB.Query(`SELECT badge, awarded_at FROM UserBadge WHERE user_id = ? ORDER BY awarded_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var badges []models.Badge
+	for rows.Next() {
+		var slug string
+		var awardedAt time.Time
+		if err := rows.Scan(&slug, &awardedAt); err != nil {
+			return nil, err
+		}
+		if rule, ok := rules[slug]; ok {
+			badges = append(badges, models.Badge{BadgeRule: rule, AwardedAt: awardedAt})
+		}
+	}
+	return badges, rows.Err()
+}
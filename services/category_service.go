@@ -2,20 +2,36 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"forum/models"
 	"log"
-	"strconv"
+	"regexp"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
 // CategoryModel gère les opérations liées aux catégories
 type CategoryModel struct {
-	DB        *sql.DB
-	PostModel *PostModel
+	DB          *sql.DB
+	PostModel   *PostModel
+	Permissions *PermissionModel
+	Reactions   *ReactionModel
 }
 
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrUnknownCategory  = errors.New("unknown or archived category")
+	ErrCategoryExists   = errors.New("a category with this name already exists")
+	ErrInvalidCategory  = errors.New("invalid category name or colour")
+	ErrCategoryCycle    = errors.New("a category cannot be placed under itself or one of its subcategories")
+	ErrCategoryRules    = errors.New("categories with different access rules cannot be merged, align their permissions first")
+)
+
+// Couleur d'une catégorie au format #rrggbb
+var categoryColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 // NewCategoryModel est un constructeur pour CategoryModel
 func NewCategoryModel(db *sql.DB, postModel *PostModel) *CategoryModel {
 	return &CategoryModel{
@@ -24,26 +40,68 @@ func NewCategoryModel(db *sql.DB, postModel *PostModel) *CategoryModel {
 	}
 }
 
-// GetAllCategory récupère toutes les catégories avec le nombre de posts associés
-func (c *CategoryModel) GetAllCategory() ([]models.Category, error) {
+// GetAllCategory récupère les catégories actives visibles par l'utilisateur, avec le nombre de posts associés,
+// dans l'ordre défini par les administrateurs
+func (c *CategoryModel) GetAllCategory(userId string) ([]models.Category, error) {
+	return c.listCategories(false, userId, ActionView)
+}
+
+// GetPostableCategories récupère les catégories actives dans lesquelles l'utilisateur peut publier
+func (c *CategoryModel) GetPostableCategories(userId string) ([]models.Category, error) {
+	return c.listCategories(false, userId, ActionPost)
+}
+
+// GetAllCategoryForAdmin récupère toutes les catégories, archivées comprises
+func (c *CategoryModel) GetAllCategoryForAdmin() ([]models.Category, error) {
+	return c.listCategories(true, "", "")
+}
+
+// listCategories parcourt l'arbre des catégories en profondeur : chaque catégorie est suivie de ses
+// sous-catégories, triées par position. Le nombre de posts inclut ceux des sous-catégories.
+// Si action n'est pas vide, seules les catégories où l'utilisateur peut l'effectuer sont retournées.
+func (c *CategoryModel) listCategories(withArchived bool, userId, action string) ([]models.Category, error) {
+	var hiddenPosts string
+	var hiddenArgs []interface{}
+	if action != "" {
+		var err error
+		hiddenPosts, hiddenArgs, err = hiddenPostFilter(c.Permissions, userId, "cp.post_id")
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	stmt := `
-        SELECT 
-            Categories.id,
-            Categories.name, 
-            COUNT(Catpostrel.post_id) AS post_count
-        FROM 
-            Categories
-        LEFT JOIN 
-            Catpostrel 
-        ON 
-            Categories.id = Catpostrel.cat_id
-        GROUP BY 
-            Categories.id, Categories.name
-        ORDER BY 
-            Categories.name;
-    `
-
-	rows, err := c.DB.Query(stmt)
+		WITH RECURSIVE
+		tree(id, depth, path) AS (
+			SELECT id, 0, printf('%06d-%06d', position, id)
+			FROM Categories
+			WHERE (parent_id IS NULL OR parent_id NOT IN (SELECT id FROM Categories))
+			  AND (? OR archived = 0)
+			UNION ALL
+			SELECT child.id, tree.depth + 1, tree.path || '/' || printf('%06d-%06d', child.position, child.id)
+			FROM Categories child
+			JOIN tree ON child.parent_id = tree.id
+			WHERE ? OR child.archived = 0
+		),
+		descendants(root, id) AS (
+			SELECT id, id FROM Categories
+			UNION
+			SELECT descendants.root, child.id
+			FROM Categories child
+			JOIN descendants ON child.parent_id = descendants.id
+		)
+		SELECT c.id, c.name, c.description, c.color, c.icon, c.position, c.archived,
+		       COALESCE(c.parent_id, 0), tree.depth,
+		       (SELECT COUNT(DISTINCT cp.post_id)
+		        FROM descendants d
+		        JOIN Catpostrel cp ON cp.cat_id = d.id
+		        WHERE d.root = c.id` + hiddenPosts + `) AS post_count
+		FROM tree
+		JOIN Categories c ON c.id = tree.id
+		ORDER BY tree.path`
+
+	args := append([]interface{}{withArchived, withArchived}, hiddenArgs...)
+	rows, err := c.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +110,9 @@ func (c *CategoryModel) GetAllCategory() ([]models.Category, error) {
 	var categories []models.Category
 	for rows.Next() {
 		var cat models.Category
-		if err := rows.Scan(&cat.ID, &cat.Name, &cat.PostCount); err != nil {
+		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.Color, &cat.Icon,
+			&cat.Position, &cat.Archived, &cat.ParentID, &cat.Depth, &cat.PostCount)
+		if err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
@@ -62,40 +122,57 @@ func (c *CategoryModel) GetAllCategory() ([]models.Category, error) {
 		return nil, err
 	}
 
-	return categories, nil
+	if action == "" || c.Permissions == nil {
+		return categories, nil
+	}
+	return c.filterAllowed(categories, userId, action)
 }
 
-// InitializeCategories insère des catégories prédéfinies dans la base de données
-func (c *CategoryModel) InitializeCategories() error {
-	predefinedCategories := []string{"Technology", "Science", "Art", "Sports", "Music"}
+// filterAllowed ne garde que les catégories où l'utilisateur peut effectuer l'action
+func (c *CategoryModel) filterAllowed(categories []models.Category, userId, action string) ([]models.Category, error) {
+	allowedIDs, err := c.Permissions.AllowedCategories(userId, action)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, categoryName := range predefinedCategories {
-		// Utiliser INSERT IGNORE pour éviter les doublons
-		_, err := c.DB.Exec("INSERT OR IGNORE INTO Categories (name) VALUES (?)", categoryName)
-		if err != nil {
-			return err
+	var allowed []models.Category
+	for _, cat := range categories {
+		if allowedIDs[cat.ID] {
+			allowed = append(allowed, cat)
 		}
 	}
-	return nil
+	return allowed, nil
 }
 
-// GetPostsByCategoryName récupère les posts associés à une catégorie donnée
-func (c *CategoryModel) GetPostsByCategoryName(name string, userid string) ([]models.Post, error) {
-	// Utiliser ? au lieu de $1 pour MySQL
+// GetPostsByCategoryName récupère les posts associés à une catégorie donnée, dans l'ordre de tri demandé.
+// Avec includeSub, les posts des sous-catégories (à toute profondeur) sont inclus.
+func (c *CategoryModel) GetPostsByCategoryName(name string, userid string, sort models.FeedSort, includeSub bool) ([]models.Post, error) {
+	where, orderBy, sortArgs := feedOrder(sort)
+	hidden, hiddenArgs, err := hiddenPostFilter(c.Permissions, userid, "p.id")
+	if err != nil {
+		return nil, err
+	}
 	query := `
+		WITH RECURSIVE sub(id) AS (
+			SELECT id FROM Categories WHERE name = ?
+			UNION
+			SELECT child.id FROM Categories child
+			JOIN sub ON child.parent_id = sub.id
+			WHERE ?
+		)
 		SELECT p.id, p.title, p.content, p.image, p.created_at,
 			   u.id, u.username, u.picture,
-			   (SELECT COUNT(*) FROM LikeDislikePost WHERE post_id = p.id AND like = 1) AS like_count,
-			   (SELECT COUNT(*) FROM LikeDislikePost WHERE post_id = p.id AND dislike = 1) AS dislike_count
+			   p.pinned, p.locked
 		FROM Post p
-		INNER JOIN Catpostrel cp ON p.id = cp.post_id
-		INNER JOIN Categories c ON cp.cat_id = c.id
 		INNER JOIN Users u ON p.user_id = u.id
-		WHERE c.name = ?
-		ORDER BY p.created_at DESC
-	`
-
-	rows, err := c.DB.Query(query, name)
+		LEFT JOIN PostScore s ON s.post_id = p.id
+		WHERE p.id IN (SELECT cp.post_id FROM Catpostrel cp WHERE cp.cat_id IN (SELECT id FROM sub))
+		  AND p.archived = 0` + hidden + where + `
+		ORDER BY p.pinned DESC, ` + orderBy
+
+	args := append([]interface{}{name, includeSub}, hiddenArgs...)
+	args = append(args, sortArgs...)
+	rows, err := c.DB.Query(query, args...)
 	if err != nil {
 		log.Printf("Erreur lors de l'exécution de la requête SQL: %v\n", err)
 		return nil, err
@@ -110,8 +187,6 @@ func (c *CategoryModel) GetPostsByCategoryName(name string, userid string) ([]mo
 		var username string
 		var userPicture string
 		var image sql.NullString
-		var likeCount int
-		var dislikeCount int
 
 		err := rows.Scan(
 			&post.ID,
@@ -122,8 +197,8 @@ func (c *CategoryModel) GetPostsByCategoryName(name string, userid string) ([]mo
 			&userID,
 			&username,
 			&userPicture,
-			&likeCount,
-			&dislikeCount,
+			&post.Pinned,
+			&post.Locked,
 		)
 		if err != nil {
 			log.Printf("Erreur lors du scan des données: %v\n", err)
@@ -135,8 +210,6 @@ func (c *CategoryModel) GetPostsByCategoryName(name string, userid string) ([]mo
 			Username: username,
 			Picture:  userPicture,
 		}
-		post.LikeCount = likeCount
-		post.DislikeCount = dislikeCount
 
 		if image.Valid {
 			post.Image = &image.String
@@ -150,19 +223,6 @@ func (c *CategoryModel) GetPostsByCategoryName(name string, userid string) ([]mo
 			return nil, err
 		}
 
-		if userid != "" {
-			if c.PostModel != nil && c.PostModel.LikeModel != nil {
-				post.UserAction, err = c.PostModel.LikeModel.VerifyAction(strconv.Itoa(post.ID), userid)
-				if err != nil {
-					log.Printf("Erreur lors de la récupération de l'action de l'utilisateur pour le post ID %d: %v\n", post.ID, err)
-					return nil, err
-				}
-				fmt.Println(post.UserAction)
-			}
-		} else {
-			post.UserAction = ""
-		}
-
 		posts = append(posts, post)
 	}
 
@@ -171,6 +231,16 @@ func (c *CategoryModel) GetPostsByCategoryName(name string, userid string) ([]mo
 		return nil, err
 	}
 
+	// Réactions de tous les posts en une seule requête
+	if c.Reactions != nil {
+		if err := applyPostReactions(c.Reactions, posts, userid); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyPostReputation(c.DB, posts); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -208,7 +278,7 @@ func (c *CategoryModel) GetCategoriesByPostID(postID int) ([]models.Category, er
 // GetCategoryByName récupère une catégorie par son nom
 func (c *CategoryModel) GetCategoryByName(nameCat string) (*models.Category, error) {
 	query := `
-		SELECT id, name
+		SELECT id, name, description, color, icon, position, archived, COALESCE(parent_id, 0)
 		FROM Categories
 		WHERE name = ?
 	`
@@ -216,7 +286,9 @@ func (c *CategoryModel) GetCategoryByName(nameCat string) (*models.Category, err
 	row := c.DB.QueryRow(query, nameCat)
 
 	var category models.Category
-	if err := row.Scan(&category.ID, &category.Name); err != nil {
+	err := row.Scan(&category.ID, &category.Name, &category.Description, &category.Color,
+		&category.Icon, &category.Position, &category.Archived, &category.ParentID)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Aucune catégorie trouvée avec le nom donné
 		}
@@ -225,3 +297,338 @@ func (c *CategoryModel) GetCategoryByName(nameCat string) (*models.Category, err
 
 	return &category, nil
 }
+
+// GetBreadcrumbs retourne les ancêtres d'une catégorie, de la racine jusqu'à la catégorie elle-même
+func (c *CategoryModel) GetBreadcrumbs(id int) ([]models.Category, error) {
+	query := `
+		WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+			SELECT id, parent_id, 0 FROM Categories WHERE id = ?
+			UNION
+			SELECT parent.id, parent.parent_id, ancestors.depth + 1
+			FROM Categories parent
+			JOIN ancestors ON parent.id = ancestors.parent_id
+		)
+		SELECT c.id, c.name, c.color, c.icon
+		FROM ancestors
+		JOIN Categories c ON c.id = ancestors.id
+		ORDER BY ancestors.depth DESC`
+
+	rows, err := c.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breadcrumbs []models.Category
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(&category.ID, &category.Name, &category.Color, &category.Icon); err != nil {
+			return nil, err
+		}
+		breadcrumbs = append(breadcrumbs, category)
+	}
+
+	return breadcrumbs, rows.Err()
+}
+
+// GetSubcategories retourne les sous-catégories directes et actives d'une catégorie, visibles par l'utilisateur
+func (c *CategoryModel) GetSubcategories(id int, userId string) ([]models.Category, error) {
+	all, err := c.GetAllCategory(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var children []models.Category
+	for _, category := range all {
+		if category.ParentID == id {
+			children = append(children, category)
+		}
+	}
+	return children, nil
+}
+
+// CreateCategory ajoute une catégorie à la fin de la liste, sous parentID (0 pour une catégorie racine)
+func (c *CategoryModel) CreateCategory(name, description, color, icon string, parentID int) (int, error) {
+	name, color, err := validateCategory(name, color)
+	if err != nil {
+		return 0, err
+	}
+	if parentID != 0 {
+		if err := c.checkExists(parentID); err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := c.DB.Exec(`
+		INSERT INTO Categories (name, description, color, icon, parent_id, position)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0), (SELECT COALESCE(MAX(position), 0) + 1 FROM Categories))`,
+		name, strings.TrimSpace(description), color, strings.TrimSpace(icon), parentID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, ErrCategoryExists
+		}
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// UpdateCategory renomme une catégorie et modifie sa description, sa couleur et son icône
+func (c *CategoryModel) UpdateCategory(id int, name, description, color, icon string) error {
+	name, color, err := validateCategory(name, color)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.DB.Exec(`
+		UPDATE Categories SET name = ?, description = ?, color = ?, icon = ?
+		WHERE id = ?`,
+		name, strings.TrimSpace(description), color, strings.TrimSpace(icon), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrCategoryExists
+		}
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// SetArchived archive ou restaure une catégorie ; une catégorie archivée n'est plus proposée à la création de posts
+func (c *CategoryModel) SetArchived(id int, archived bool) error {
+	res, err := c.DB.Exec("UPDATE Categories SET archived = ? WHERE id = ?", archived, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// SetParent déplace une catégorie sous une autre (0 pour en faire une catégorie racine).
+// Une catégorie ne peut pas être placée sous elle-même ni sous l'une de ses sous-catégories.
+func (c *CategoryModel) SetParent(id, parentID int) error {
+	if err := c.checkExists(id); err != nil {
+		return err
+	}
+	if parentID != 0 {
+		if err := c.checkExists(parentID); err != nil {
+			return err
+		}
+		descendant, err := c.isDescendant(parentID, id)
+		if err != nil {
+			return err
+		}
+		if descendant {
+			return ErrCategoryCycle
+		}
+	}
+
+	_, err := c.DB.Exec(`
+		UPDATE Categories
+		SET position = CASE WHEN parent_id IS NULLIF(?, 0) THEN position
+		                    ELSE (SELECT COALESCE(MAX(position), 0) + 1 FROM Categories) END,
+		    parent_id = NULLIF(?, 0)
+		WHERE id = ?`, parentID, parentID, id)
+	return err
+}
+
+// isDescendant indique si id est ancestorID lui-même ou l'une de ses sous-catégories
+func (c *CategoryModel) isDescendant(id, ancestorID int) (bool, error) {
+	var found bool
+	err := c.DB.QueryRow(`
+		WITH RECURSIVE sub(id) AS (
+			SELECT ?
+			UNION
+			SELECT child.id FROM Categories child JOIN sub ON child.parent_id = sub.id
+		)
+		SELECT EXISTS (SELECT 1 FROM sub WHERE id = ?)`, ancestorID, id).Scan(&found)
+	return found, err
+}
+
+// checkExists renvoie ErrCategoryNotFound si la catégorie n'existe pas
+func (c *CategoryModel) checkExists(id int) error {
+	var exists bool
+	err := c.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM Categories WHERE id = ?)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// MoveCategory échange la position d'une catégorie avec sa voisine du dessus (up) ou du dessous, parmi les catégories de même parent
+func (c *CategoryModel) MoveCategory(id int, up bool) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Renuméroter d'abord pour que chaque catégorie sœur ait une position distincte
+	rows, err := tx.Query(`
+		SELECT id FROM Categories
+		WHERE parent_id IS (SELECT parent_id FROM Categories WHERE id = ?)
+		ORDER BY position, name`, id)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var catID int
+		if err := rows.Scan(&catID); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, catID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	index := -1
+	for i, catID := range ids {
+		if catID == id {
+			index = i
+		}
+	}
+	if index == -1 {
+		return ErrCategoryNotFound
+	}
+
+	neighbour := index + 1
+	if up {
+		neighbour = index - 1
+	}
+	if neighbour >= 0 && neighbour < len(ids) {
+		ids[index], ids[neighbour] = ids[neighbour], ids[index]
+	}
+
+	for position, catID := range ids {
+		if _, err := tx.Exec("UPDATE Categories SET position = ? WHERE id = ?", position+1, catID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MergeCategories rattache les posts et les sous-catégories de la catégorie source à la catégorie cible puis supprime la source
+func (c *CategoryModel) MergeCategories(sourceID, targetID int) error {
+	if sourceID == targetID {
+		return fmt.Errorf("cannot merge a category into itself")
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM Categories WHERE id IN (?, ?)", sourceID, targetID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != 2 {
+		return ErrCategoryNotFound
+	}
+
+	// Les posts de la source passent sous les règles de la cible : une catégorie restreinte
+	// ne doit pas être fusionnée dans une catégorie plus ouverte
+	var differences int
+	err = tx.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM (
+				SELECT action, role, group_id FROM CategoryPermission WHERE cat_id = ?
+				EXCEPT SELECT action, role, group_id FROM CategoryPermission WHERE cat_id = ?))
+			+ (SELECT COUNT(*) FROM (
+				SELECT action, role, group_id FROM CategoryPermission WHERE cat_id = ?
+				EXCEPT SELECT action, role, group_id FROM CategoryPermission WHERE cat_id = ?))`, sourceID, targetID, targetID, sourceID).Scan(&differences)
+	if err != nil {
+		return err
+	}
+	if differences > 0 {
+		return ErrCategoryRules
+	}
+
+	// Si la cible est une sous-catégorie de la source, la remonter d'abord au niveau de la source
+	// pour ne pas créer de cycle en lui rattachant les sous-catégories de la source
+	_, err = tx.Exec(`
+		WITH RECURSIVE sub(id) AS (
+			SELECT ?
+			UNION
+			SELECT child.id FROM Categories child JOIN sub ON child.parent_id = sub.id
+		)
+		UPDATE Categories
+		SET parent_id = (SELECT parent_id FROM Categories WHERE id = ?)
+		WHERE id = ? AND id IN (SELECT id FROM sub)`, sourceID, sourceID, targetID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE Categories SET parent_id = ? WHERE parent_id = ?", targetID, sourceID); err != nil {
+		return err
+	}
+
+	// Un post présent dans les deux catégories ne doit être rattaché qu'une fois à la cible
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO Catpostrel (cat_id, post_id)
+		SELECT ?, post_id FROM Catpostrel WHERE cat_id = ?`, targetID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM Catpostrel WHERE cat_id = ?", sourceID); err != nil {
+		return err
+	}
+
+	// Les abonnés de la source suivent désormais la cible
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO Watch (user_id, target_type, target_id, active, created_at)
+		SELECT user_id, 'category', ?, active, created_at FROM Watch WHERE target_type = 'category' AND target_id = ?`,
+		targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM Watch WHERE target_type = 'category' AND target_id = ?", sourceID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM CategoryPermission WHERE cat_id = ?", sourceID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM Categories WHERE id = ?", sourceID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// validateCategory nettoie le nom et la couleur saisis par l'administrateur
+func validateCategory(name, color string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	color = strings.TrimSpace(color)
+	if color == "" {
+		color = "#f0f0f0"
+	}
+	if name == "" || len(name) > 50 || !categoryColorPattern.MatchString(color) {
+		return "", "", ErrInvalidCategory
+	}
+	return name, strings.ToLower(color), nil
+}
+
+// expectOneRow renvoie ErrCategoryNotFound si la requête n'a modifié aucune ligne
+func expectOneRow(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
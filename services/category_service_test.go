@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"forum/internal/testdb"
+	"testing"
+)
+
+// TestMergeCategories vérifie qu'une fusion déplace posts, sous-catégories et abonnés vers la cible,
+// supprime la source et ses règles, et qu'elle est refusée entre catégories aux règles différentes.
+func TestMergeCategories(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.AddUser(t, db, "11111111-1111-1111-1111-111111111111", "user", "user")
+	perms := &PermissionModel{DB: db}
+	categories := &CategoryModel{DB: db, Permissions: perms}
+
+	create := func(name string, parentID int) int {
+		t.Helper()
+		id, err := categories.CreateCategory(name, "", "", "", parentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	source, target := create("Source", 0), create("Target", 0)
+	child := create("Child", source)
+	for _, id := range []int{source, target} {
+		if err := perms.AddRule(id, ActionPost, "moderator", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO Post (id, user_id, title, content) VALUES (1, ?, 'a', 'c'), (2, ?, 'b', 'c')`, user, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO Catpostrel (cat_id, post_id) VALUES (?, 1), (?, 2), (?, 2)`, source, source, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO Watch (user_id, target_type, target_id) VALUES (?, 'category', ?)`, user, source); err != nil {
+		t.Fatal(err)
+	}
+
+	// Règles différentes : la fusion est refusée et rien ne change
+	restricted := create("Restricted", 0)
+	if err := perms.AddRule(restricted, ActionView, "moderator", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := categories.MergeCategories(restricted, target); !errors.Is(err, ErrCategoryRules) {
+		t.Fatalf("merging categories with different rules = %v, want ErrCategoryRules", err)
+	}
+	if n := count(`SELECT COUNT(*) FROM CategoryPermission WHERE cat_id = ?`, restricted); n != 1 {
+		t.Fatalf("refused merge changed the rules: %d left", n)
+	}
+
+	// Règles identiques : tout passe à la cible
+	if err := categories.MergeCategories(source, target); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(`SELECT COUNT(*) FROM Categories WHERE id = ?`, source); n != 0 {
+		t.Error("source category still exists")
+	}
+	if n := count(`SELECT COUNT(*) FROM CategoryPermission WHERE cat_id = ?`, source); n != 0 {
+		t.Errorf("%d rules of the source left", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM Catpostrel WHERE cat_id = ?`, target); n != 2 {
+		t.Errorf("target has %d posts, want 2 (the shared post once)", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM Categories WHERE id = ? AND parent_id = ?`, child, target); n != 1 {
+		t.Error("child category not moved under the target")
+	}
+	if n := count(`SELECT COUNT(*) FROM Watch WHERE target_type = 'category' AND target_id = ? AND user_id = ?`, target, user); n != 1 {
+		t.Error("watcher of the source does not watch the target")
+	}
+
+	// Fusion dans sa propre sous-catégorie : la cible remonte d'un niveau, sans créer de cycle
+	parent := create("Parent", 0)
+	sub := create("Sub", parent)
+	if err := categories.MergeCategories(parent, sub); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(`SELECT COUNT(*) FROM Categories WHERE id = ? AND parent_id IS NULL`, sub); n != 1 {
+		t.Error("sub-category not moved to the root after merging its parent into it")
+	}
+}
@@ -5,24 +5,57 @@ import (
 	"errors"
 	"fmt"
 	"forum/models"
+	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid" // Assurez-vous d'importer le package UUID
 )
 
+var (
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrReplyTooDeep    = errors.New("this conversation is nested too deeply to reply")
+)
+
+// DeletedCommentContent remplace le contenu d'un commentaire supprimé qui a des réponses.
+const DeletedCommentContent = "[deleted]"
+
 type CommentModel struct {
-	LikeModelComment *LikeModelComment
-	DB               *sql.DB
+	Reactions   *ReactionModel
+	DB          *sql.DB
+	Permissions *PermissionModel
+	MaxDepth    int           // profondeur maximale d'une réponse (1 : réponses directes uniquement, 0 : pas de réponses)
+	Live        *LiveHub      // visiteurs du post prévenus des changements de commentaires ; nil : pas de diffusion
+	Mentions    *MentionModel // utilisateurs mentionnés prévenus ; nil : pas de notification
 }
 
-// Insère un commentaire dans la base de données pour un post spécifique
-func (m *CommentModel) CommentInsert(postId int, content, userId string) (int, error) {
+// Insère un commentaire dans la base de données pour un post spécifique, en réponse au commentaire
+// parentId (0 pour un commentaire de premier niveau), si le fil n'est ni verrouillé ni archivé
+// et si l'utilisateur a le droit de commenter dans toutes les catégories du post
+func (m *CommentModel) CommentInsert(postId int, parentId int, content, userId string) (int, error) {
 	if m.DB == nil {
 		return 0, errors.New("database connection is not initialized")
 	}
-	query := `INSERT INTO Comment (post_id, content, user_id) VALUES (?, ?, ?)`
-	result, err := m.DB.Exec(query, postId, content, userId)
+	if err := checkThreadWritable(m.DB, postId); err != nil {
+		return 0, err
+	}
+	if m.Permissions != nil {
+		if err := m.Permissions.CheckPost(userId, postId, ActionComment); err != nil {
+			return 0, err
+		}
+	}
+
+	var parent interface{}
+	if parentId != 0 {
+		if err := m.checkParent(postId, parentId); err != nil {
+			return 0, err
+		}
+		parent = parentId
+	}
+
+	query := `INSERT INTO Comment (post_id, content, user_id, parent_id) VALUES (?, ?, ?, ?)`
+	result, err := m.DB.Exec(query, postId, content, userId, parent)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert comment: %w", err)
 	}
@@ -30,28 +63,141 @@ func (m *CommentModel) CommentInsert(postId int, content, userId string) (int, e
 	if err != nil {
 		return 0, fmt.Errorf("failed to retrieve last insert ID: %w", err)
 	}
+	m.Live.Publish(postId, models.LiveEvent{Type: models.LiveComment, ID: int(commentId), ParentID: parentId})
+	if _, err := m.Mentions.Notify(userId, postId, int(commentId), content); err != nil {
+		log.Printf("Erreur lors des notifications de mention du commentaire %d: %v", commentId, err)
+	}
 	return int(commentId), nil
 }
 
-// Récupère les commentaires pour un post spécifique
-func (m *CommentModel) GetComments(postId int, userId string) ([]models.Comment, error) {
+// checkParent vérifie qu'on peut répondre au commentaire parentId : il appartient au post,
+// n'est pas supprimé et la réponse ne dépasse pas la profondeur maximale.
+func (m *CommentModel) checkParent(postId, parentId int) error {
+	var parentPostId int
+	var deleted bool
+	err := m.DB.QueryRow(`SELECT post_id, deleted FROM Comment WHERE id = ?`, parentId).Scan(&parentPostId, &deleted)
+	if err == sql.ErrNoRows {
+		return ErrCommentNotFound
+	} else if err != nil {
+		return err
+	}
+	if parentPostId != postId || deleted {
+		return ErrCommentNotFound
+	}
+
+	// Profondeur de la réponse : nombre d'ancêtres, parent compris
+	var depth int
+	err = m.DB.QueryRow(`
+		WITH RECURSIVE ancestors(id, parent_id) AS (
+			SELECT id, parent_id FROM Comment WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id FROM Comment c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT COUNT(*) FROM ancestors`, parentId).Scan(&depth)
+	if err != nil {
+		return err
+	}
+	if depth > m.MaxDepth {
+		return ErrReplyTooDeep
+	}
+	return nil
+}
+
+// CommentsPerPage est le nombre de commentaires de premier niveau affichés par page.
+const CommentsPerPage = 20
+
+// commentScore est le score d'un commentaire pour le tri "best" : likes moins dislikes.
+const commentScore = `((SELECT COUNT(*) FROM Reaction l WHERE l.target_type = 'comment' AND l.target_id = c.id AND l.reaction = 'like')
+	- (SELECT COUNT(*) FROM Reaction l WHERE l.target_type = 'comment' AND l.target_id = c.id AND l.reaction = 'dislike'))`
+
+// commentOrder retourne la clause ORDER BY d'un tri de commentaires ; "newest" par défaut.
+func commentOrder(sort string) string {
+	switch sort {
+	case "oldest":
+		return "c.created_at ASC, c.id ASC"
+	case "best":
+		return commentScore + " DESC, c.created_at ASC, c.id ASC"
+	}
+	return "c.created_at DESC, c.id DESC"
+}
+
+// rootCommentIDs retourne les identifiants des commentaires de premier niveau d'un post, dans l'ordre du tri.
+func (m *CommentModel) rootCommentIDs(postId int, sort string) ([]int, error) {
+	rows, err := m.DB.Query(`SELECT c.id FROM Comment c WHERE c.post_id = ? AND c.parent_id IS NULL ORDER BY `+commentOrder(sort), postId)
+	if err != nil {
+		return nil, fmt.Errorf("échec de la récupération des commentaires : %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Récupère une page de commentaires d'un post sous forme d'arbre : les commentaires de premier niveau
+// de la page portent leurs réponses dans Replies. Chaque niveau suit le même tri ("newest", "oldest"
+// ou "best") ; une page hors limites est ramenée à la première ou à la dernière page.
+func (m *CommentModel) GetComments(postId int, userId string, sort string, page int) (models.CommentPage, error) {
 	if m.DB == nil {
-		return nil, errors.New("la connexion à la base de données n'est pas initialisée")
+		return models.CommentPage{}, errors.New("la connexion à la base de données n'est pas initialisée")
+	}
+
+	switch sort {
+	case "oldest", "best":
+	default:
+		sort = "newest"
+	}
+	result := models.CommentPage{Sort: sort}
+
+	roots, err := m.rootCommentIDs(postId, sort)
+	if err != nil {
+		return result, err
+	}
+	result.Total = len(roots)
+	result.Pages = (len(roots) + CommentsPerPage - 1) / CommentsPerPage
+	if result.Pages < 1 {
+		result.Pages = 1
+	}
+	result.Page = min(max(page, 1), result.Pages)
+
+	first := (result.Page - 1) * CommentsPerPage
+	roots = roots[first:min(first+CommentsPerPage, len(roots))]
+	if len(roots) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(roots)), ",")
+	args := make([]interface{}, len(roots))
+	for i, id := range roots {
+		args[i] = id
 	}
 
-	stmt := `SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.picture
+	// Les commentaires de premier niveau de la page et toutes leurs réponses
+	stmt := `WITH RECURSIVE thread(id) AS (
+                 SELECT id FROM Comment WHERE id IN (` + placeholders + `)
+                 UNION ALL
+                 SELECT r.id FROM Comment r JOIN thread t ON r.parent_id = t.id
+             )
+             SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.picture,
+                    COALESCE(c.parent_id, 0), c.deleted
              FROM Comment c
              JOIN Users u ON c.user_id = u.id
-             WHERE c.post_id = ?
-             ORDER BY c.created_at DESC`
+             WHERE c.id IN (SELECT id FROM thread)
+             ORDER BY ` + commentOrder(sort)
 
-	rows, err := m.DB.Query(stmt, postId)
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
-		return nil, fmt.Errorf("échec de la récupération des commentaires : %v", err)
+		return result, fmt.Errorf("échec de la récupération des commentaires : %v", err)
 	}
 	defer rows.Close()
 
-	var comments []models.Comment
+	var flat []models.Comment
 	for rows.Next() {
 		var c models.Comment
 		var createdAt time.Time
@@ -59,59 +205,266 @@ func (m *CommentModel) GetComments(postId int, userId string) ([]models.Comment,
 		var username string
 		var userPicture string
 
-		err := rows.Scan(&c.ID, &c.PostID, &commentUserId, &c.Content, &createdAt, &username, &userPicture)
+		err := rows.Scan(&c.ID, &c.PostID, &commentUserId, &c.Content, &createdAt, &username, &userPicture,
+			&c.ParentID, &c.Deleted)
 		if err != nil {
-			return nil, fmt.Errorf("échec de la lecture d'une ligne de commentaire : %v", err)
+			return result, fmt.Errorf("échec de la lecture d'une ligne de commentaire : %v", err)
+		}
+		c.CreatedAt = createdAt
+
+		// Un commentaire supprimé ne garde que sa place dans le fil
+		if c.Deleted {
+			c.Content = DeletedCommentContent
+			flat = append(flat, c)
+			continue
 		}
 
 		// Conversion de l'ID utilisateur en UUID
 		c.UserID.Id, err = uuid.Parse(commentUserId)
 		if err != nil {
-			return nil, fmt.Errorf("ID utilisateur invalide : %v", err)
+			return result, fmt.Errorf("ID utilisateur invalide : %v", err)
 		}
 		c.UserID.Username = username
 		c.UserID.Picture = userPicture
-		c.CreatedAt = createdAt
 
-		// Utiliser le LikeModel pour obtenir les likes et dislikes
-		likeCountComment, DislikeCountComment, err := m.LikeModelComment.CountLikesDislikesComment(c.ID)
-		if err != nil {
-			return nil, err
+		flat = append(flat, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return result, fmt.Errorf("erreur lors de l'itération des lignes : %v", err)
+	}
+
+	// Réactions de tous les commentaires de la page en une seule requête
+	ids := make([]int, len(flat))
+	for i, c := range flat {
+		ids[i] = c.ID
+	}
+	summaries, err := m.Reactions.Summaries(TargetComment, ids, userId)
+	if err != nil {
+		return result, err
+	}
+	for i := range flat {
+		if flat[i].Deleted {
+			continue
 		}
-		c.LikeCountComment, c.DislikeCountComment = likeCountComment, DislikeCountComment
+		summary := summaries[flat[i].ID]
+		flat[i].Reactions = summary
+		flat[i].LikeCountComment = summary.Counts["like"]
+		flat[i].DislikeCountComment = summary.Counts["dislike"]
+		flat[i].UserAction = summary.Mine
+	}
 
-		if userId != "" {
-			UserAction, err := m.LikeModelComment.VerifyActionComment(strconv.Itoa(c.ID), userId)
-			if err != nil {
-				return nil, err
-			}
-			c.UserAction = UserAction
-		} else {
-			c.UserAction = ""
+	if err := applyCommentReputation(m.DB, flat); err != nil {
+		return result, err
+	}
+
+	result.Comments = buildCommentTree(flat)
+	return result, nil
+}
+
+// buildCommentTree range les commentaires sous leur parent en conservant leur ordre.
+func buildCommentTree(flat []models.Comment) []models.Comment {
+	known := make(map[int]bool, len(flat))
+	children := make(map[int][]models.Comment)
+	for _, c := range flat {
+		known[c.ID] = true
+	}
+	for _, c := range flat {
+		parent := c.ParentID
+		if !known[parent] {
+			parent = 0
 		}
+		children[parent] = append(children[parent], c)
+	}
 
-		comments = append(comments, c)
+	var attach func(parent int, depth int) []models.Comment
+	attach = func(parent int, depth int) []models.Comment {
+		nodes := children[parent]
+		for i := range nodes {
+			nodes[i].Depth = depth
+			nodes[i].Replies = attach(nodes[i].ID, depth+1)
+		}
+		return nodes
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("erreur lors de l'itération des lignes : %v", err)
+	return attach(0, 0)
+}
+
+// GetComment retourne un commentaire seul, sans ses réponses, avec ses réactions vues par userId
+// et sa profondeur dans le fil : ce qu'il faut pour l'afficher à sa place dans une page déjà chargée.
+func (m *CommentModel) GetComment(commentId int, userId string) (models.Comment, error) {
+	var c models.Comment
+	var commentUserId, username, userPicture string
+	err := m.DB.QueryRow(`
+		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.picture,
+		       COALESCE(c.parent_id, 0), c.deleted
+		FROM Comment c
+		JOIN Users u ON c.user_id = u.id
+		WHERE c.id = ?`, commentId).Scan(&c.ID, &c.PostID, &commentUserId, &c.Content, &c.CreatedAt,
+		&username, &userPicture, &c.ParentID, &c.Deleted)
+	if err == sql.ErrNoRows {
+		return c, ErrCommentNotFound
+	} else if err != nil {
+		return c, err
+	}
+
+	err = m.DB.QueryRow(`
+		WITH RECURSIVE ancestors(id, parent_id) AS (
+			SELECT id, parent_id FROM Comment WHERE id = ?
+			UNION ALL
+			SELECT p.id, p.parent_id FROM Comment p JOIN ancestors a ON p.id = a.parent_id
+		)
+		SELECT COUNT(*) - 1 FROM ancestors`, commentId).Scan(&c.Depth)
+	if err != nil {
+		return c, err
+	}
+
+	if c.Deleted {
+		c.Content = DeletedCommentContent
+		return c, nil
+	}
+	if c.UserID.Id, err = uuid.Parse(commentUserId); err != nil {
+		return c, fmt.Errorf("ID utilisateur invalide : %v", err)
+	}
+	c.UserID.Username = username
+	c.UserID.Picture = userPicture
+
+	summary, err := m.Reactions.Summary(TargetComment, c.ID, userId)
+	if err != nil {
+		return c, err
+	}
+	c.Reactions = summary
+	c.LikeCountComment = summary.Counts["like"]
+	c.DislikeCountComment = summary.Counts["dislike"]
+	c.UserAction = summary.Mine
+
+	comments := []models.Comment{c}
+	if err := applyCommentReputation(m.DB, comments); err != nil {
+		return c, err
+	}
+	return comments[0], nil
+}
+
+// Locate retourne le post d'un commentaire et la page où il apparaît pour le tri donné.
+func (m *CommentModel) Locate(commentId int, sort string) (postId int, page int, err error) {
+	var rootId int
+	err = m.DB.QueryRow(`
+		WITH RECURSIVE ancestors(id, parent_id, post_id) AS (
+			SELECT id, parent_id, post_id FROM Comment WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, c.post_id FROM Comment c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id, post_id FROM ancestors WHERE parent_id IS NULL`, commentId).Scan(&rootId, &postId)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrCommentNotFound
+	} else if err != nil {
+		return 0, 0, err
 	}
 
-	return comments, nil
+	roots, err := m.rootCommentIDs(postId, sort)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, id := range roots {
+		if id == rootId {
+			return postId, i/CommentsPerPage + 1, nil
+		}
+	}
+	return postId, 1, nil
 }
 
-// Supprime un commentaire en fonction de son ID
+// Supprime un commentaire en fonction de son ID. Un commentaire qui a des réponses est seulement
+// vidé et marqué supprimé ; un parent déjà supprimé qui n'a plus de réponses disparaît à son tour.
 func (m *CommentModel) Delete(id string) error {
 	if m.DB == nil {
 		return errors.New("database connection is not initialized")
 	}
 
-	stmt := `DELETE FROM Comment WHERE id = ?`
-	_, err := m.DB.Exec(stmt, id)
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return errors.New("failed to delete comment: " + err.Error())
 	}
+	defer tx.Rollback()
+
+	var parentId sql.NullInt64
+	var postId int
+	err = tx.QueryRow(`SELECT parent_id, post_id FROM Comment WHERE id = ?`, id).Scan(&parentId, &postId)
+	if err == sql.ErrNoRows {
+		return ErrCommentNotFound
+	} else if err != nil {
+		return errors.New("failed to delete comment: " + err.Error())
+	}
 
+	var hasReplies bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM Comment WHERE parent_id = ?)`, id).Scan(&hasReplies)
+	if err != nil {
+		return errors.New("failed to delete comment: " + err.Error())
+	}
+
+	commentId, _ := strconv.Atoi(id)
+	if hasReplies {
+		_, err = tx.Exec(`UPDATE Comment SET deleted = 1, content = '' WHERE id = ?`, id)
+		if err != nil {
+			return errors.New("failed to delete comment: " + err.Error())
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		m.Live.Publish(postId, models.LiveEvent{Type: models.LiveCommentDeleted, ID: commentId})
+		return nil
+	}
+
+	if err = deleteCommentRow(tx, id); err != nil {
+		return errors.New("failed to delete comment: " + err.Error())
+	}
+	removed := []int{commentId}
+
+	// Nettoyage des parents supprimés devenus sans réponse
+	for parentId.Valid {
+		var grandParentId sql.NullInt64
+		var deleted, stillReplied bool
+		err = tx.QueryRow(`
+			SELECT c.parent_id, c.deleted, EXISTS(SELECT 1 FROM Comment r WHERE r.parent_id = c.id)
+			FROM Comment c WHERE c.id = ?`, parentId.Int64).Scan(&grandParentId, &deleted, &stillReplied)
+		if err == sql.ErrNoRows {
+			break
+		} else if err != nil {
+			return errors.New("failed to delete comment: " + err.Error())
+		}
+		if !deleted || stillReplied {
+			break
+		}
+
+		if err = deleteCommentRow(tx, parentId.Int64); err != nil {
+			return errors.New("failed to delete comment: " + err.Error())
+		}
+		removed = append(removed, int(parentId.Int64))
+		parentId = grandParentId
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for _, removedId := range removed {
+		m.Live.Publish(postId, models.LiveEvent{Type: models.LiveCommentDeleted, ID: removedId, Removed: true})
+	}
+	return nil
+}
+
+// deleteCommentRow supprime un commentaire avec ses réactions, les points de réputation
+// qu'elles ont rapportés, ses mentions et les notifications qui le désignent.
+func deleteCommentRow(tx *sql.Tx, id interface{}) error {
+	for _, stmt := range []string{
+		`DELETE FROM Notification WHERE comment_id = ?`,
+		`DELETE FROM Reaction WHERE target_type = 'comment' AND target_id = ?`,
+		`DELETE FROM ReputationLedger WHERE target_type = 'comment' AND target_id = ?`,
+		`DELETE FROM Mention WHERE source_type = 'comment' AND source_id = ?`,
+		`DELETE FROM Comment WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -121,12 +474,32 @@ func (m *CommentModel) Update(id, content string) error {
 		return errors.New("database connection is not initialized")
 	}
 
-	stmt := `UPDATE Comment SET content = ? WHERE id = ?`
-	_, err := m.DB.Exec(stmt, content, id)
+	// Les commentaires d'un fil archivé ne sont plus modifiables
+	var archived bool
+	var postId int
+	var authorId string
+	err := m.DB.QueryRow(`SELECT p.archived, p.id, c.user_id FROM Comment c JOIN Post p ON p.id = c.post_id WHERE c.id = ?`, id).Scan(&archived, &postId, &authorId)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if archived {
+		return ErrPostArchived
+	}
+
+	stmt := `UPDATE Comment SET content = ? WHERE id = ? AND deleted = 0`
+	result, err := m.DB.Exec(stmt, content, id)
 	if err != nil {
 		return errors.New("failed to update comment: " + err.Error())
 	}
 
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		commentId, _ := strconv.Atoi(id)
+		m.Live.Publish(postId, models.LiveEvent{Type: models.LiveCommentEdited, ID: commentId, Content: content})
+		// Seuls les utilisateurs nouvellement mentionnés sont prévenus
+		if _, err := m.Mentions.Notify(authorId, postId, commentId, content); err != nil {
+			log.Printf("Erreur lors des notifications de mention du commentaire %d: %v", commentId, err)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/models"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Fréquences du résumé par email.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestFrequencies liste les fréquences dans l'ordre de la page des préférences.
+var DigestFrequencies = []string{DigestOff, DigestDaily, DigestWeekly}
+
+// defaultDigestFrequency est la fréquence d'un utilisateur qui ne l'a pas choisie.
+const defaultDigestFrequency = DigestWeekly
+
+const (
+	digestNotifications = 30 // notifications reprises au plus dans un résumé
+	digestWatchedPosts  = 10 // nouveaux posts des catégories suivies
+	digestTopPosts      = 5  // meilleurs posts de la période
+)
+
+// sqliteTime est le format des dates écrites par CURRENT_TIMESTAMP et datetime('now').
+const sqliteTime = "2006-01-02 15:04:05"
+
+var (
+	ErrInvalidFrequency   = errors.New("invalid digest frequency")
+	ErrInvalidUnsubscribe = errors.New("invalid unsubscribe link")
+)
+
+// DigestModel envoie les résumés quotidiens ou hebdomadaires par email : notifications non lues
+// (selon le canal "digest" des préférences), nouveaux posts des catégories suivies et meilleurs posts.
+// Il envoie aussi les notifications du canal "email".
+type DigestModel struct {
+	DB            *sql.DB
+	Notifications *Notification
+	Permissions   *PermissionModel
+	Mailer        Mailer
+	Templates     string // dossier contenant email.digest.html et email.digest.txt
+	BaseURL       string // adresse publique du forum, sans "/" final, pour les liens des emails
+	Secret        []byte // clé de signature des liens de désabonnement
+}
+
+// digestUser est un destinataire de résumé.
+type digestUser struct {
+	id, username, email string
+	lastSent            string // date du dernier résumé envoyé, "" s'il n'y en a pas eu
+}
+
+// Frequency retourne la fréquence du résumé d'un utilisateur.
+func (m *DigestModel) Frequency(userId string) (string, error) {
+	var frequency string
+	err := m.DB.QueryRow(`SELECT frequency FROM DigestSubscription WHERE user_id = ?`, userId).Scan(&frequency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultDigestFrequency, nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get digest frequency: %w", err)
+	}
+	return frequency, nil
+}
+
+// SetFrequency change la fréquence du résumé d'un utilisateur ("off" le désactive).
+func (m *DigestModel) SetFrequency(userId, frequency string) error {
+	if frequency != DigestOff && frequency != DigestDaily && frequency != DigestWeekly {
+		return ErrInvalidFrequency
+	}
+	_, err := m.DB.Exec(`
+		INSERT INTO DigestSubscription (user_id, frequency) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET frequency = excluded.frequency, updated_at = CURRENT_TIMESTAMP`,
+		userId, frequency)
+	if err != nil {
+		return fmt.Errorf("failed to set digest frequency: %w", err)
+	}
+	return nil
+}
+
+// UnsubscribeURL retourne le lien signé qui désactive le résumé d'un utilisateur sans connexion.
+func (m *DigestModel) UnsubscribeURL(userId string) string {
+	return m.BaseURL + "/digest/unsubscribe?" + url.Values{"user": {userId}, "token": {m.unsubscribeToken(userId)}}.Encode()
+}
+
+// CheckUnsubscribe renvoie ErrInvalidUnsubscribe si token n'est pas la signature du lien de userId.
+func (m *DigestModel) CheckUnsubscribe(userId, token string) error {
+	given, err := hex.DecodeString(token)
+	if err != nil || userId == "" {
+		return ErrInvalidUnsubscribe
+	}
+	expected, _ := hex.DecodeString(m.unsubscribeToken(userId))
+	if !hmac.Equal(given, expected) {
+		return ErrInvalidUnsubscribe
+	}
+	return nil
+}
+
+// Unsubscribe désactive le résumé de l'utilisateur d'un lien de désabonnement valide.
+func (m *DigestModel) Unsubscribe(userId, token string) error {
+	if err := m.CheckUnsubscribe(userId, token); err != nil {
+		return err
+	}
+	return m.SetFrequency(userId, DigestOff)
+}
+
+func (m *DigestModel) unsubscribeToken(userId string) string {
+	mac := hmac.New(sha256.New, m.Secret)
+	mac.Write([]byte("digest-unsubscribe:" + userId))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RunScheduler envoie à intervalle régulier les résumés de la période en cours qui ne sont pas
+// encore partis ; à lancer dans une goroutine.
+func (m *DigestModel) RunScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := m.SendDue(time.Now())
+		if err != nil {
+			log.Printf("Erreur lors de l'envoi des résumés: %v", err)
+		} else if sent > 0 {
+			log.Printf("%d résumé(s) envoyé(s) par email", sent)
+		}
+		<-ticker.C
+	}
+}
+
+// SendDue envoie les résumés quotidiens du jour et hebdomadaires de la semaine de now (en UTC)
+// aux utilisateurs qui ne les ont pas encore reçus ; retourne le nombre d'emails envoyés.
+// Un résumé sans rien de nouveau pour l'utilisateur compte comme envoyé mais ne part pas.
+func (m *DigestModel) SendDue(now time.Time) (int, error) {
+	sent := 0
+	for _, frequency := range []string{DigestDaily, DigestWeekly} {
+		period, length := digestPeriod(frequency, now)
+		users, err := m.dueUsers(frequency, period)
+		if err != nil {
+			return sent, err
+		}
+
+		for _, user := range users {
+			ok, err := m.send(user, frequency, period, now.Add(-length), now)
+			if err != nil {
+				log.Printf("Erreur lors de l'envoi du résumé de %s: %v", user.id, err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// digestPeriod retourne la période d'un résumé à la date now ("2026-10-19" ou "2026-W42") et sa durée.
+func digestPeriod(frequency string, now time.Time) (string, time.Duration) {
+	now = now.UTC()
+	if frequency == DigestDaily {
+		return now.Format("2006-01-02"), 24 * time.Hour
+	}
+	year, week := now.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week), 7 * 24 * time.Hour
+}
+
+// dueUsers retourne les utilisateurs au résumé de cette fréquence qui ne l'ont pas reçu pour la période.
+func (m *DigestModel) dueUsers(frequency, period string) ([]digestUser, error) {
+	rows, err := m.DB.Query(`
+		SELECT u.id, u.username, u.email,
+			COALESCE((SELECT MAX(l.sent_at) FROM DigestLog l WHERE l.user_id = u.id), '')
+		FROM Users u
+		LEFT JOIN DigestSubscription s ON s.user_id = u.id
+		WHERE COALESCE(s.frequency, ?) = ?
+		  AND NOT EXISTS (SELECT 1 FROM DigestLog l WHERE l.user_id = u.id AND l.period = ?)`,
+		defaultDigestFrequency, frequency, period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var users []digestUser
+	for rows.Next() {
+		var user digestUser
+		if err := rows.Scan(&user.id, &user.username, &user.email, &user.lastSent); err != nil {
+			return nil, fmt.Errorf("failed to scan digest recipient: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// send réserve le résumé de la période puis l'envoie ; la réservation garantit qu'il ne part qu'une fois,
+// même si deux planificateurs tournent. Elle est annulée si l'envoi échoue, pour réessayer plus tard.
+// Le résumé couvre ce qui s'est passé depuis le précédent, sans remonter avant start.
+func (m *DigestModel) send(user digestUser, frequency, period string, start, now time.Time) (bool, error) {
+	result, err := m.DB.Exec(`INSERT OR IGNORE INTO DigestLog (user_id, period, frequency, sent_at) VALUES (?, ?, ?, ?)`,
+		user.id, period, frequency, now.UTC().Format(sqliteTime))
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve digest: %w", err)
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return false, err
+	}
+
+	since := start.UTC().Format(sqliteTime)
+	if user.lastSent > since {
+		since = user.lastSent
+	}
+
+	err = m.deliver(user, frequency, since)
+	if errors.Is(err, errEmptyDigest) {
+		return false, nil
+	} else if err != nil {
+		if _, cancelErr := m.DB.Exec(`DELETE FROM DigestLog WHERE user_id = ? AND period = ?`, user.id, period); cancelErr != nil {
+			log.Printf("Erreur lors de l'annulation du résumé de %s: %v", user.id, cancelErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// errEmptyDigest signale un résumé sans rien de nouveau pour son destinataire.
+var errEmptyDigest = errors.New("empty digest")
+
+// deliver construit, met en forme et envoie le résumé d'un utilisateur.
+func (m *DigestModel) deliver(user digestUser, frequency, since string) error {
+	digest, err := m.Build(user.id, since)
+	if err != nil {
+		return err
+	}
+	if digest.Empty() {
+		return errEmptyDigest
+	}
+	digest.Username = user.username
+	digest.Frequency = frequency
+
+	html, text, err := m.render(digest)
+	if err != nil {
+		return err
+	}
+	subject := "Votre résumé de la semaine"
+	if frequency == DigestDaily {
+		subject = "Votre résumé du jour"
+	}
+	return m.Mailer.Send(models.Email{
+		To:      user.email,
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + digest.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// Build rassemble le contenu du résumé d'un utilisateur depuis since (date au format SQLite).
+// Les nouveaux posts des catégories suivies remplacent leurs notifications "watch_post".
+func (m *DigestModel) Build(userId, since string) (models.Digest, error) {
+	digest := models.Digest{
+		SiteURL:        m.BaseURL + "/home",
+		SettingsURL:    m.BaseURL + "/notification/settings",
+		UnsubscribeURL: m.UnsubscribeURL(userId),
+	}
+
+	types, err := m.Notifications.TypesOn(userId, ChannelDigest)
+	if err != nil {
+		return digest, err
+	}
+	var notifTypes []string
+	watched := false
+	for _, t := range types {
+		if t == "watch_post" {
+			watched = true
+			continue
+		}
+		notifTypes = append(notifTypes, t)
+	}
+
+	hidden, hiddenArgs, err := hiddenPostFilter(m.Permissions, userId, "p.id")
+	if err != nil {
+		return digest, err
+	}
+
+	if digest.Notifications, err = m.notifications(userId, since, notifTypes); err != nil {
+		return digest, err
+	}
+	if watched {
+		args := append([]interface{}{since, userId, userId}, hiddenArgs...)
+		digest.WatchedPosts, err = m.posts(`
+			WHERE p.created_at > ? AND p.user_id != ?
+			  AND p.id IN (
+				SELECT cp.post_id FROM Catpostrel cp
+				JOIN Watch w ON w.target_type = 'category' AND w.target_id = cp.cat_id AND w.active = 1
+				WHERE w.user_id = ?)`+hidden+`
+			ORDER BY p.created_at DESC, p.id DESC
+			LIMIT `+fmt.Sprint(digestWatchedPosts), args...)
+		if err != nil {
+			return digest, err
+		}
+	}
+	args := append([]interface{}{since}, hiddenArgs...)
+	digest.TopPosts, err = m.posts(`
+		WHERE p.created_at > ? AND COALESCE(s.score, 0) > 0`+hidden+`
+		ORDER BY s.score DESC, s.comment_count DESC, p.id DESC
+		LIMIT `+fmt.Sprint(digestTopPosts), args...)
+	if err != nil {
+		return digest, err
+	}
+	return digest, nil
+}
+
+// notifications retourne les notifications non lues d'un utilisateur, de ces types, reçues depuis since.
+func (m *DigestModel) notifications(userId, since string, types []string) ([]models.DigestNotification, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(types)), ", ")
+	args := []interface{}{userId, since}
+	for _, t := range types {
+		args = append(args, t)
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT n.type, COALESCE(n.data, ''), COALESCE(u2.username, ''), COALESCE(p.title, cp.title, ''),
+			COALESCE(c.content, ''), n.post_id, n.comment_id, u.username
+		FROM Notification n
+		JOIN Users u ON u.id = n.user_id
+		LEFT JOIN Users u2 ON u2.id = n.user_id2
+		LEFT JOIN Post p ON p.id = n.post_id
+		LEFT JOIN Comment c ON c.id = n.comment_id
+		LEFT JOIN Post cp ON cp.id = c.post_id
+		WHERE n.user_id = ? AND n.read = 0 AND n.created_at > ? AND n.type IN (`+placeholders+`)
+		ORDER BY n.id DESC
+		LIMIT `+fmt.Sprint(digestNotifications), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []models.DigestNotification
+	for rows.Next() {
+		var notifType, data, actor, title, comment, username string
+		var postId, commentId sql.NullInt64
+		if err := rows.Scan(&notifType, &data, &actor, &title, &comment, &postId, &commentId, &username); err != nil {
+			return nil, fmt.Errorf("failed to scan digest notification: %w", err)
+		}
+		notifications = append(notifications, models.DigestNotification{
+			Text: notificationText(notifType, actor, title, comment, data),
+			URL:  m.BaseURL + notificationLink(notifType, data, username, postId, commentId),
+		})
+	}
+	return notifications, rows.Err()
+}
+
+// posts retourne les posts choisis par la fin de requête tail (conditions, tri et limite).
+func (m *DigestModel) posts(tail string, args ...interface{}) ([]models.DigestPost, error) {
+	rows, err := m.DB.Query(`
+		SELECT p.id, p.title, u.username, COALESCE(s.score, 0), COALESCE(s.comment_count, 0)
+		FROM Post p
+		JOIN Users u ON u.id = p.user_id
+		LEFT JOIN PostScore s ON s.post_id = p.id
+		`+tail, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.DigestPost
+	for rows.Next() {
+		var post models.DigestPost
+		var id int
+		if err := rows.Scan(&id, &post.Title, &post.Author, &post.Score, &post.Comments); err != nil {
+			return nil, fmt.Errorf("failed to scan digest post: %w", err)
+		}
+		post.URL = fmt.Sprintf("%s/post/direct/%d", m.BaseURL, id)
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// render met en forme un résumé avec les templates email.digest.html et email.digest.txt.
+func (m *DigestModel) render(digest models.Digest) (string, string, error) {
+	htmlTmpl, err := htmltemplate.ParseFiles(filepath.Join(m.Templates, "email.digest.html"))
+	if err != nil {
+		return "", "", err
+	}
+	textTmpl, err := texttemplate.ParseFiles(filepath.Join(m.Templates, "email.digest.txt"))
+	if err != nil {
+		return "", "", err
+	}
+
+	var html, text bytes.Buffer
+	if err := htmlTmpl.Execute(&html, digest); err != nil {
+		return "", "", err
+	}
+	if err := textTmpl.Execute(&text, digest); err != nil {
+		return "", "", err
+	}
+	return html.String(), text.String(), nil
+}
+
+// SendNotification envoie une notification du canal email ; DigestModel satisfait NotificationSender.
+func (m *DigestModel) SendNotification(userId string, event models.NotificationEvent) error {
+	var email, username, notifType, data string
+	var postId, commentId sql.NullInt64
+	err := m.DB.QueryRow(`
+		SELECT u.email, u.username, n.type, COALESCE(n.data, ''), n.post_id, n.comment_id
+		FROM Notification n
+		JOIN Users u ON u.id = n.user_id
+		WHERE n.id = ? AND n.user_id = ?`, event.ID, userId).Scan(&email, &username, &notifType, &data, &postId, &commentId)
+	if err != nil {
+		return fmt.Errorf("failed to get notification recipient: %w", err)
+	}
+
+	link := m.BaseURL + notificationLink(notifType, data, username, postId, commentId)
+	settings := m.BaseURL + "/notification/settings"
+	escape := htmltemplate.HTMLEscapeString
+	return m.Mailer.Send(models.Email{
+		To:      email,
+		Subject: event.Text,
+		Text:    fmt.Sprintf("%s\n\n%s\n\n--\nRégler vos notifications : %s\n", event.Text, link, settings),
+		HTML: fmt.Sprintf(`<p>%s</p><p><a href="%s">Voir sur le forum</a></p><p style="color:#888">Régler vos notifications : <a href="%s">%s</a></p>`,
+			escape(event.Text), escape(link), escape(settings), escape(settings)),
+	})
+}
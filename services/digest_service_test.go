@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"forum/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMailer garde les emails au lieu de les envoyer ; fail simule un serveur SMTP injoignable.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []models.Email
+	fail error
+}
+
+func (m *fakeMailer) Send(msg models.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail != nil {
+		return m.fail
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+// TestDigestSentOnce vérifie qu'un résumé ne part qu'une fois par période, même avec deux planificateurs
+// en même temps, et qu'un envoi raté est retenté au passage suivant.
+func TestDigestSentOnce(t *testing.T) {
+	db := reputationDB(t)
+	mailer := &fakeMailer{fail: errors.New("smtp unreachable")}
+	perms := &PermissionModel{DB: db}
+	m := &DigestModel{
+		DB:            db,
+		Notifications: &Notification{DB: db},
+		Permissions:   perms,
+		Mailer:        mailer,
+		Templates:     "../templates",
+		BaseURL:       "http://localhost:8080",
+		Secret:        []byte("secret"),
+	}
+	if err := m.SetFrequency(testAuthor, DigestDaily); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO Notification (user_id, user_id2, post_id, type) VALUES (?, ?, 1, 'like')`, testAuthor, testVoter); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// Envoi raté : la période n'est pas marquée comme envoyée
+	if sent, err := m.SendDue(now); err != nil || sent != 0 {
+		t.Fatalf("SendDue with a failing mailer = %d, %v", sent, err)
+	}
+
+	mailer.mu.Lock()
+	mailer.fail = nil
+	mailer.mu.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.SendDue(now); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if sent := mailer.count(); sent != 1 {
+		t.Fatalf("%d digests sent by two schedulers, want 1", sent)
+	}
+	if mailer.sent[0].To != "author@example.com" {
+		t.Fatalf("digest sent to %s", mailer.sent[0].To)
+	}
+
+	// Plus tard dans la même journée : rien de plus
+	if sent, err := m.SendDue(now.Add(time.Hour)); err != nil || sent != 0 {
+		t.Fatalf("SendDue later the same day = %d, %v", sent, err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"forum/models"
+	"strings"
+)
+
+// ErrLoginRequired est renvoyée quand un filtre réservé aux utilisateurs connectés est demandé par un visiteur
+var ErrLoginRequired = errors.New("this filter requires a logged-in user")
+
+// Filter récupère les posts correspondant à tous les critères du filtre, en une seule requête paramétrée.
+// Les critères "aimés par moi" et "créés par moi" exigent un utilisateur connecté.
+func (m *PostModel) Filter(f models.PostFilter, viewerId string) ([]models.Post, error) {
+	if (f.LikedByMe || f.CreatedByMe) && viewerId == "" {
+		return nil, ErrLoginRequired
+	}
+
+	var where strings.Builder
+	var args []interface{}
+
+	categories := uniqueNonEmpty(f.Categories)
+	if len(categories) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(categories)), ",")
+		for _, name := range categories {
+			args = append(args, name)
+		}
+		if f.MatchAll {
+			where.WriteString(` AND (SELECT COUNT(DISTINCT fc.id)
+				FROM Catpostrel fcp
+				JOIN Categories fc ON fc.id = fcp.cat_id
+				WHERE fcp.post_id = p.id AND fc.name IN (` + placeholders + `)) = ?`)
+			args = append(args, len(categories))
+		} else {
+			where.WriteString(` AND EXISTS (SELECT 1
+				FROM Catpostrel fcp
+				JOIN Categories fc ON fc.id = fcp.cat_id
+				WHERE fcp.post_id = p.id AND fc.name IN (` + placeholders + `))`)
+		}
+	}
+	if f.Author != "" {
+		where.WriteString(" AND u.username = ?")
+		args = append(args, f.Author)
+	}
+	if f.LikedByMe {
+		where.WriteString(" AND EXISTS (SELECT 1 FROM Reaction l WHERE l.target_type = 'post' AND l.target_id = p.id AND l.user_id = ? AND l.reaction = 'like')")
+		args = append(args, viewerId)
+	}
+	if f.CreatedByMe {
+		where.WriteString(" AND p.user_id = ?")
+		args = append(args, viewerId)
+	}
+	if f.From != "" {
+		where.WriteString(" AND date(p.created_at) >= date(?)")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where.WriteString(" AND date(p.created_at) <= date(?)")
+		args = append(args, f.To)
+	}
+	if f.MinScore != nil {
+		where.WriteString(" AND COALESCE(s.score, 0) >= ?")
+		args = append(args, *f.MinScore)
+	}
+
+	hidden, hiddenArgs, err := hiddenPostFilter(m.Permissions, viewerId, "p.id")
+	if err != nil {
+		return nil, err
+	}
+	where.WriteString(hidden)
+	if !f.Archived {
+		where.WriteString(" AND p.archived = 0")
+	}
+	args = append(args, hiddenArgs...)
+
+	sortWhere, orderBy, sortArgs := feedOrder(f.Sort)
+	where.WriteString(sortWhere)
+	args = append(args, sortArgs...)
+
+	stmt := `SELECT
+                p.id,
+                p.title,
+                p.content,
+                p.image,
+                p.created_at,
+                u.id AS user_id,
+                u.username,
+                u.picture,
+                GROUP_CONCAT(c.name, ',') AS categories,
+                p.pinned, p.locked, p.archived
+             FROM Post p
+             JOIN users u ON p.user_id = u.id
+             LEFT JOIN Catpostrel cp ON p.id = cp.post_id
+             LEFT JOIN Categories c ON cp.cat_id = c.id
+             LEFT JOIN PostScore s ON s.post_id = p.id
+             WHERE 1 = 1` + where.String() + `
+             GROUP BY p.id
+             ORDER BY ` + orderBy
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return m.scanFeedPosts(rows, viewerId)
+}
+
+// uniqueNonEmpty supprime les doublons et les valeurs vides d'une liste.
+func uniqueNonEmpty(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
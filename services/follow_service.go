@@ -0,0 +1,161 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"forum/models"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// ErrSelfFollow est retournée quand un utilisateur essaie de se suivre lui-même.
+var ErrSelfFollow = errors.New("you cannot follow yourself")
+
+// FollowModel gère les abonnements entre utilisateurs et les notifications de nouveaux posts.
+type FollowModel struct {
+	DB            *sql.DB
+	Permissions   *PermissionModel
+	Notifications *Notification
+	DailyLimit    int // notifications de nouveaux posts reçues au plus par jour et par abonné ; 0 : aucune
+}
+
+// Follow abonne followerID aux posts de followedID ; suivre deux fois la même personne est sans effet.
+func (m *FollowModel) Follow(followerID, followedID string) error {
+	if followerID == followedID {
+		return ErrSelfFollow
+	}
+	_, err := m.DB.Exec(`INSERT OR IGNORE INTO Follow (follower_id, followed_id) VALUES (?, ?)`, followerID, followedID)
+	return err
+}
+
+// Unfollow désabonne followerID de followedID.
+func (m *FollowModel) Unfollow(followerID, followedID string) error {
+	_, err := m.DB.Exec(`DELETE FROM Follow WHERE follower_id = ? AND followed_id = ?`, followerID, followedID)
+	return err
+}
+
+// SetNotify active ou coupe les notifications de nouveaux posts pour un abonnement existant.
+func (m *FollowModel) SetNotify(followerID, followedID string, notify bool) error {
+	_, err := m.DB.Exec(`UPDATE Follow SET notify = ? WHERE follower_id = ? AND followed_id = ?`, notify, followerID, followedID)
+	return err
+}
+
+// Stats retourne les compteurs d'abonnements de userID et la relation du visiteur avec lui.
+func (m *FollowModel) Stats(userID, viewerID string) (models.FollowStats, error) {
+	var stats models.FollowStats
+	err := m.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM Follow WHERE followed_id = ?),
+			(SELECT COUNT(*) FROM Follow WHERE follower_id = ?)`,
+		userID, userID).Scan(&stats.Followers, &stats.Following)
+	if err != nil {
+		return stats, err
+	}
+
+	if viewerID == "" || viewerID == userID {
+		return stats, nil
+	}
+	err = m.DB.QueryRow(`SELECT notify FROM Follow WHERE follower_id = ? AND followed_id = ?`, viewerID, userID).Scan(&stats.Notify)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+	stats.IsFollowed = true
+	return stats, nil
+}
+
+// Followers retourne les abonnés de userID, du plus récent au plus ancien.
+func (m *FollowModel) Followers(userID string) ([]models.User, error) {
+	return m.users(`
+		SELECT u.id, u.username, COALESCE(u.picture, ''), u.role, u.created_at
+		FROM Follow f
+		JOIN Users u ON u.id = f.follower_id
+		WHERE f.followed_id = ?
+		ORDER BY f.created_at DESC`, userID)
+}
+
+// Following retourne les utilisateurs suivis par userID, du plus récent au plus ancien.
+func (m *FollowModel) Following(userID string) ([]models.User, error) {
+	return m.users(`
+		SELECT u.id, u.username, COALESCE(u.picture, ''), u.role, u.created_at
+		FROM Follow f
+		JOIN Users u ON u.id = f.followed_id
+		WHERE f.follower_id = ?
+		ORDER BY f.created_at DESC`, userID)
+}
+
+// users lit une liste d'utilisateurs (id, username, picture, role, created_at).
+func (m *FollowModel) users(query string, args ...interface{}) ([]models.User, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		var id string
+		if err := rows.Scan(&id, &u.Username, &u.Picture, &u.Roles, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		if u.Id, err = uuid.Parse(id); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// NotifyFollowers prévient les abonnés de authorID qu'il a publié le post postID ; retourne ceux qui
+// ont été notifiés. Sont ignorés les abonnés qui ont coupé les notifications de cet auteur,
+// ceux qui ont atteint la limite quotidienne et ceux qui ne peuvent pas voir le post.
+func (m *FollowModel) NotifyFollowers(postID int, authorID string) ([]string, error) {
+	if m.DailyLimit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT f.follower_id
+		FROM Follow f
+		WHERE f.followed_id = ? AND f.notify = 1
+		  AND (SELECT COUNT(*) FROM Notification n
+		       WHERE n.user_id = f.follower_id AND n.type = 'new_post'
+		         AND n.created_at >= datetime('now', 'start of day')) < ?`,
+		authorID, m.DailyLimit)
+	if err != nil {
+		return nil, err
+	}
+	var followers []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		followers = append(followers, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var notified []string
+	for _, followerID := range followers {
+		// Un post d'une catégorie que l'abonné ne peut pas voir ne lui est pas signalé
+		if err := m.Permissions.CheckPost(followerID, postID, ActionView); errors.Is(err, ErrForbidden) {
+			continue
+		} else if err != nil {
+			return notified, err
+		}
+
+		if err := m.Notifications.AddNewPostNotification(followerID, authorID, postID); err != nil {
+			log.Printf("Erreur lors de la notification du post %d à %s: %v", postID, followerID, err)
+			continue
+		}
+		notified = append(notified, followerID)
+	}
+	return notified, nil
+}
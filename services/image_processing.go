@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// imageVariant est une taille dérivée d'une image envoyée, enregistrée sous son nom suivi de Suffix.
+type imageVariant struct {
+	Suffix string // vide : l'image principale, dont le nom est celui conservé en base
+	Width  int    // largeur maximale, ou côté du carré
+	Height int    // hauteur maximale
+	Square bool   // recadrée au centre en carré de Width pixels, agrandie si besoin
+}
+
+// imageVariants sont les tailles produites pour chaque type d'upload, la plus grande d'abord :
+// chacune est calculée à partir de la précédente.
+var imageVariants = map[string][]imageVariant{
+	UploadPost: {
+		{Suffix: "", Width: 1600, Height: 1600},    // affichage en grand
+		{Suffix: "-480", Width: 480, Height: 1440}, // miniature du fil
+	},
+	UploadProfile: {
+		{Suffix: "", Width: 256, Height: 256, Square: true},
+		{Suffix: "-128", Width: 128, Height: 128, Square: true},
+		{Suffix: "-64", Width: 64, Height: 64, Square: true},
+	},
+}
+
+// jpegQuality est la qualité des images JPEG ré-encodées.
+const jpegQuality = 85
+
+// uploadNamePattern reconnaît le nom d'une image envoyée ou de l'une de ses tailles : l'empreinte
+// du contenu, le suffixe éventuel de la taille et l'extension.
+var uploadNamePattern = regexp.MustCompile(`^([0-9a-f]{64})(-[0-9]+)?(\.(?:jpg|png|gif))$`)
+
+// variantName retourne le nom d'une taille d'une image envoyée : abc.jpg et -480 donnent abc-480.jpg.
+func variantName(name, suffix string) string {
+	ext := name[strings.LastIndex(name, "."):]
+	return strings.TrimSuffix(name, ext) + suffix + ext
+}
+
+// UploadBaseName retourne le nom de l'image envoyée dont file est l'une des tailles (abc-480.jpg : abc.jpg),
+// ou "" si file n'est pas une image envoyée.
+func UploadBaseName(file string) string {
+	match := uploadNamePattern.FindStringSubmatch(file)
+	if match == nil {
+		return ""
+	}
+	return match[1] + match[3]
+}
+
+// ImageSrcset retourne l'attribut srcset d'une image envoyée (post ou photo de profil), avec la largeur
+// de chacune de ses tailles ; "" pour les images qui n'ont pas de tailles dérivées (image par défaut, anciens fichiers).
+func ImageSrcset(kind, name string) string {
+	dir, ok := uploadDirs[kind]
+	if !ok || UploadBaseName(name) != name {
+		return ""
+	}
+	variants := imageVariants[kind]
+	candidates := make([]string, 0, len(variants))
+	for i := len(variants) - 1; i >= 0; i-- {
+		candidates = append(candidates, fmt.Sprintf("/static/%s/%s %dw", dir, variantName(name, variants[i].Suffix), variants[i].Width))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// processImage décode une image envoyée et la ré-encode dans chacune des tailles de kind. Les métadonnées
+// (EXIF, position GPS, commentaires) ne sont pas recopiées ; l'orientation EXIF d'une photo est appliquée
+// avant d'être perdue. Retourne le contenu de chaque fichier par nom.
+func processImage(kind, name string, data []byte) (map[string][]byte, error) {
+	variants, ok := imageVariants[kind]
+	if !ok {
+		return nil, ErrInvalidUpload
+	}
+	ext := name[strings.LastIndex(name, "."):]
+
+	var src image.Image
+	var animation *gif.GIF
+	switch ext {
+	case ".gif":
+		frames, pixels, ok := gifFrames(data)
+		if !ok || frames > maxGIFFrames || pixels > maxImagePixels {
+			return nil, ErrUnsupportedImage
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(g.Image) == 0 {
+			return nil, ErrUnsupportedImage
+		}
+		animation = g
+		src = firstFrame(g)
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupportedImage
+		}
+		src = img
+		if ext == ".jpg" {
+			src = orient(src, exifOrientation(data))
+		}
+	}
+
+	files := make(map[string][]byte, len(variants))
+	for i, variant := range variants {
+		var buf bytes.Buffer
+		var err error
+		if i == 0 && animation != nil && !variant.Square && fits(animation.Config.Width, animation.Config.Height, variant) {
+			// Une animation assez petite est gardée telle quelle, sans ses extensions (commentaires, XMP)
+			err = gif.EncodeAll(&buf, animation)
+		} else {
+			src = resize(src, variant)
+			err = encodeImage(&buf, ext, src)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode image: %w", err)
+		}
+		files[variantName(name, variant.Suffix)] = buf.Bytes()
+	}
+	return files, nil
+}
+
+// encodeImage encode img au format de l'extension ext.
+func encodeImage(w io.Writer, ext string, img image.Image) error {
+	switch ext {
+	case ".jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case ".png":
+		return png.Encode(w, img)
+	case ".gif":
+		return gif.Encode(w, img, nil)
+	}
+	return ErrUnsupportedImage
+}
+
+// firstFrame retourne la première image d'un GIF à la taille de l'animation.
+func firstFrame(g *gif.GIF) image.Image {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	return canvas
+}
+
+// gifFrames parcourt les blocs d'un GIF sans les décoder et retourne le nombre d'images et la somme de
+// leurs pixels, pour refuser une animation trop lourde avant gif.DecodeAll ; ok est faux si le fichier
+// est mal formé.
+func gifFrames(data []byte) (frames, pixels int, ok bool) {
+	if len(data) < 13 {
+		return 0, 0, false
+	}
+	i := 13 // en-tête et descripteur d'écran
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1) // table de couleurs globale
+	}
+
+	// skipSubBlocks avance i après une suite de sous-blocs terminée par un bloc vide
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension : type puis sous-blocs
+			i += 2
+			if !skipSubBlocks() {
+				return 0, 0, false
+			}
+		case 0x2C: // descripteur d'image, table de couleurs locale, taille de code LZW puis sous-blocs
+			if i+10 > len(data) {
+				return 0, 0, false
+			}
+			w := int(binary.LittleEndian.Uint16(data[i+5:]))
+			h := int(binary.LittleEndian.Uint16(data[i+7:]))
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++
+			if !skipSubBlocks() {
+				return 0, 0, false
+			}
+			frames++
+			pixels += w * h
+		case 0x3B: // fin du fichier
+			return frames, pixels, true
+		default:
+			return 0, 0, false
+		}
+	}
+	return 0, 0, false
+}
+
+// fits indique si une image de w×h pixels tient dans la taille variant sans être réduite.
+func fits(w, h int, variant imageVariant) bool {
+	return w <= variant.Width && h <= variant.Height
+}
+
+// resize réduit src pour qu'elle tienne dans la taille variant, ou la recadre au centre et la met
+// à l'échelle du carré pour une taille carrée. Une image assez petite est seulement recopiée.
+func resize(src image.Image, variant imageVariant) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if variant.Square {
+		side := min(w, h)
+		crop := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((w-side)/2, (h-side)/2))
+		return scale(src, crop, variant.Width, variant.Width)
+	}
+
+	if fits(w, h, variant) {
+		return scale(src, bounds, w, h)
+	}
+	dw, dh := variant.Width, h*variant.Width/w
+	if dh > variant.Height {
+		dw, dh = w*variant.Height/h, variant.Height
+	}
+	return scale(src, bounds, max(dw, 1), max(dh, 1))
+}
+
+// scale met la zone area de src à la taille dw×dh : chaque pixel est la moyenne des pixels de la zone
+// qu'il recouvre (ou le pixel le plus proche en cas d'agrandissement), en couleurs prémultipliées
+// pour que les bords transparents ne noircissent pas.
+func scale(src image.Image, area image.Rectangle, dw, dh int) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, area.Min, draw.Src)
+	if area.Dx() == dw && area.Dy() == dh {
+		return rgba
+	}
+
+	sw, sh := area.Dx(), area.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					a += int(row[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient applique à src l'orientation EXIF (1 à 8) d'une photo, pour qu'elle s'affiche à l'endroit
+// une fois ses métadonnées retirées.
+func orient(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // miroir horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotation de 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // miroir vertical
+				dx, dy = x, h-1-y
+			case 5: // transposition
+				dx, dy = y, x
+			case 6: // rotation de 90° dans le sens horaire
+				dx, dy = h-1-y, x
+			case 7: // transposition inverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotation de 90° dans le sens antihoraire
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], rgba.Pix[rgba.PixOffset(x, y):])
+		}
+	}
+	return dst
+}
+
+// exifOrientation lit l'orientation (tag 0x0112) du segment EXIF d'un JPEG, ou retourne 1 (à l'endroit)
+// si elle est absente ou illisible.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			break // début des données de l'image ou segment tronqué
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation lit l'orientation dans le premier répertoire d'un en-tête TIFF.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"forum/models"
+	"sync"
+	"time"
+)
+
+const (
+	// liveBuffer est le nombre d'événements qu'un flux peut avoir en attente avant d'être fermé.
+	liveBuffer = 32
+	// liveHistory est le nombre d'événements gardés par post pour les flux qui se reconnectent.
+	liveHistory = 64
+	// liveIdleTTL est la durée pendant laquelle un post sans visiteur garde son historique.
+	liveIdleTTL = 2 * time.Minute
+	// typingInterval est l'intervalle minimal entre deux indications "en train d'écrire" d'un utilisateur.
+	typingInterval = 3 * time.Second
+)
+
+// LiveHub diffuse aux visiteurs d'un post les nouveaux commentaires, les modifications, les suppressions
+// et les compteurs de réactions, ainsi que le nombre de visiteurs et qui est en train d'écrire.
+//
+// Un visiteur trop lent est déconnecté plutôt que de bloquer les autres : à sa reconnexion il reçoit
+// les événements manqués depuis Last-Event-ID, ou un événement "stale" s'ils ne sont plus en mémoire.
+type LiveHub struct {
+	mu       sync.Mutex
+	seq      int
+	channels map[int]*liveChannel
+}
+
+// liveChannel regroupe les flux ouverts sur un post.
+type liveChannel struct {
+	streams map[*LiveStream]struct{}
+	viewers map[string]int       // connexions par visiteur ; un visiteur anonyme compte pour chaque connexion
+	typing  map[string]time.Time // dernière indication de chaque utilisateur
+	history []models.LiveEvent
+	since   int // les événements de numéro supérieur à since sont tous dans history
+	idle    *time.Timer
+}
+
+// LiveStream est l'abonnement d'un visiteur aux événements d'un post.
+// Events est fermé quand le flux est retiré du hub.
+type LiveStream struct {
+	Events <-chan models.LiveEvent
+
+	events chan models.LiveEvent
+	postID int
+	userID string
+	viewer string
+}
+
+// Subscribe ouvre un flux sur le post postID pour userID ("" pour un visiteur anonyme).
+// lastSeq est le dernier événement reçu avant une reconnexion (0 sinon) : les événements manqués
+// sont retournés dans missed, ou stale vaut true s'ils ne sont plus connus.
+func (h *LiveHub) Subscribe(postID int, userID string, lastSeq int) (stream *LiveStream, missed []models.LiveEvent, stale bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channel(postID)
+	if lastSeq > 0 {
+		if lastSeq < ch.since || lastSeq > h.seq {
+			stale = true
+		} else {
+			for _, event := range ch.history {
+				if event.Seq > lastSeq {
+					missed = append(missed, event)
+				}
+			}
+		}
+	}
+
+	events := make(chan models.LiveEvent, liveBuffer)
+	stream = &LiveStream{Events: events, events: events, postID: postID, userID: userID, viewer: userID}
+	if userID == "" {
+		stream.viewer = fmt.Sprintf("anonymous-%p", stream)
+	}
+	ch.streams[stream] = struct{}{}
+	ch.viewers[stream.viewer]++
+	if ch.idle != nil {
+		ch.idle.Stop()
+		ch.idle = nil
+	}
+	if ch.viewers[stream.viewer] == 1 {
+		h.presence(ch)
+	}
+	return stream, missed, stale
+}
+
+// Unsubscribe retire un flux du hub ; sans effet s'il a déjà été retiré.
+func (h *LiveHub) Unsubscribe(stream *LiveStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(stream)
+}
+
+// Watched indique si le post a au moins un visiteur connecté.
+func (h *LiveHub) Watched(postID int) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := h.channels[postID]
+	return ch != nil && len(ch.streams) > 0
+}
+
+// Publish numérote un événement, le garde dans l'historique du post et l'envoie à ses visiteurs.
+// Sans effet si personne n'a ouvert le post récemment.
+func (h *LiveHub) Publish(postID int, event models.LiveEvent) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channels[postID]
+	if ch == nil {
+		return
+	}
+	h.seq++
+	event.Seq = h.seq
+	ch.history = append(ch.history, event)
+	if len(ch.history) > liveHistory {
+		ch.since = ch.history[0].Seq
+		ch.history = ch.history[1:]
+	}
+
+	for stream := range ch.streams {
+		select {
+		case stream.events <- event:
+		default:
+			// File pleine : le visiteur rattrapera à sa reconnexion
+			h.remove(stream)
+		}
+	}
+}
+
+// Typing prévient les autres visiteurs du post que username est en train d'écrire ;
+// une indication par utilisateur au plus toutes les typingInterval.
+func (h *LiveHub) Typing(postID int, userID, username string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channels[postID]
+	if ch == nil {
+		return
+	}
+	now := time.Now()
+	if last, ok := ch.typing[userID]; ok && now.Sub(last) < typingInterval {
+		return
+	}
+	ch.typing[userID] = now
+
+	h.broadcast(ch, models.LiveEvent{Type: models.LiveTyping, User: username}, userID)
+}
+
+// channel retourne le canal du post, créé au besoin ; h.mu doit être verrouillé.
+func (h *LiveHub) channel(postID int) *liveChannel {
+	if h.channels == nil {
+		h.channels = make(map[int]*liveChannel)
+	}
+	ch := h.channels[postID]
+	if ch == nil {
+		ch = &liveChannel{
+			streams: make(map[*LiveStream]struct{}),
+			viewers: make(map[string]int),
+			typing:  make(map[string]time.Time),
+			since:   h.seq,
+		}
+		h.channels[postID] = ch
+	}
+	return ch
+}
+
+// remove retire un flux et prévient les autres visiteurs ; h.mu doit être verrouillé.
+// Le post garde son historique liveIdleTTL après le départ de son dernier visiteur.
+func (h *LiveHub) remove(stream *LiveStream) {
+	ch := h.channels[stream.postID]
+	if ch == nil {
+		return
+	}
+	if _, ok := ch.streams[stream]; !ok {
+		return
+	}
+	delete(ch.streams, stream)
+	close(stream.events)
+
+	ch.viewers[stream.viewer]--
+	if ch.viewers[stream.viewer] > 0 {
+		return
+	}
+	delete(ch.viewers, stream.viewer)
+	delete(ch.typing, stream.userID)
+	h.presence(ch)
+
+	if len(ch.streams) == 0 && ch.idle == nil {
+		postID := stream.postID
+		ch.idle = time.AfterFunc(liveIdleTTL, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if current := h.channels[postID]; current == ch && len(ch.streams) == 0 {
+				delete(h.channels, postID)
+			}
+		})
+	}
+}
+
+// presence envoie le nombre de visiteurs du post ; h.mu doit être verrouillé.
+func (h *LiveHub) presence(ch *liveChannel) {
+	h.broadcast(ch, models.LiveEvent{Type: models.LivePresence, Viewers: len(ch.viewers)}, "")
+}
+
+// broadcast envoie un événement éphémère (non numéroté, non rejoué) à tous les flux du post sauf
+// ceux de except ; un flux dont la file est pleine ne le reçoit simplement pas.
+func (h *LiveHub) broadcast(ch *liveChannel, event models.LiveEvent, except string) {
+	for stream := range ch.streams {
+		if except != "" && stream.userID == except {
+			continue
+		}
+		select {
+		case stream.events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"forum/models"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mailer envoie les emails du forum ; l'implémentation est choisie au démarrage.
+type Mailer interface {
+	Send(msg models.Email) error
+}
+
+// FileMailer écrit chaque email dans un fichier .eml du dossier Dir au lieu de l'envoyer :
+// pratique en développement, les fichiers s'ouvrent avec n'importe quel client mail.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send écrit l'email dans un nouveau fichier de Dir.
+func (m *FileMailer) Send(msg models.Email) error {
+	data, err := buildMessage(m.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+	if err := os.WriteFile(filepath.Join(m.Dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+// SMTPMailer remet les emails à un serveur SMTP sans authentification, par exemple un relais local
+// ou un serveur de test qui les capture (MailHog, Mailpit...).
+type SMTPMailer struct {
+	Addr string // hôte:port
+	From string
+}
+
+// Send remet l'email au serveur SMTP.
+func (m *SMTPMailer) Send(msg models.Email) error {
+	data, err := buildMessage(m.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.Addr, nil, m.From, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// buildMessage construit un message MIME multipart/alternative (texte brut puis HTML).
+func buildMessage(from string, msg models.Email) ([]byte, error) {
+	if msg.To == "" || strings.ContainsAny(msg.To, "\r\n") {
+		return nil, fmt.Errorf("invalid recipient %q", msg.To)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	for _, key := range keys {
+		value := headers[key]
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid %s header", key)
+		}
+		fmt.Fprintf(&out, "%s: %s\r\n", key, value)
+	}
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// mentionPattern reconnaît @username en début de texte ou après un caractère qui ne peut pas
+// faire partie d'un nom, pour ignorer les adresses email (alice@example.com).
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w[\w.-]*)`)
+
+// Mention est un @username trouvé dans un texte ; Start et End encadrent "@username".
+type Mention struct {
+	Username   string
+	Start, End int
+}
+
+// FindMentions retourne les @username de content dans l'ordre du texte. Le point ou le tiret
+// qui termine une phrase ("merci @alice.") ne fait pas partie du nom.
+func FindMentions(content string) []Mention {
+	var mentions []Mention
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		name := strings.TrimRight(content[loc[2]:loc[3]], ".-")
+		mentions = append(mentions, Mention{Username: name, Start: loc[2] - 1, End: loc[2] + len(name)})
+	}
+	return mentions
+}
+
+// Mentionable indique si un nom d'utilisateur peut être mentionné tel quel avec @.
+func Mentionable(username string) bool {
+	mentions := FindMentions("@" + username)
+	return len(mentions) == 1 && mentions[0].Username == username
+}
+
+// MentionModel prévient les utilisateurs mentionnés dans les posts et les commentaires.
+type MentionModel struct {
+	DB            *sql.DB
+	Permissions   *PermissionModel
+	Notifications *Notification
+}
+
+// Notify prévient les utilisateurs mentionnés dans content par actorID : dans le post postID,
+// ou dans le commentaire commentID de ce post s'il n'est pas nul. Chacun n'est prévenu qu'une fois
+// par post ou commentaire, même après une modification ; l'auteur, les utilisateurs qui ne peuvent
+// pas voir le post et ceux qui ont bloqué l'auteur sont ignorés. Retourne le nombre de notifications.
+func (m *MentionModel) Notify(actorID string, postID, commentID int, content string) (int, error) {
+	if m == nil {
+		return 0, nil
+	}
+	sourceType, sourceID := "post", postID
+	if commentID != 0 {
+		sourceType, sourceID = "comment", commentID
+	}
+
+	sent := 0
+	seen := map[string]bool{}
+	for _, mention := range FindMentions(content) {
+		if seen[mention.Username] {
+			continue
+		}
+		seen[mention.Username] = true
+
+		var userID string
+		err := m.DB.QueryRow(`SELECT id FROM Users WHERE username = ?`, mention.Username).Scan(&userID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return sent, fmt.Errorf("failed to resolve mention @%s: %w", mention.Username, err)
+		}
+		if userID == actorID {
+			continue
+		}
+
+		if ok, err := m.allowed(userID, actorID, postID); err != nil {
+			return sent, err
+		} else if !ok {
+			continue
+		}
+
+		result, err := m.DB.Exec(`INSERT OR IGNORE INTO Mention (source_type, source_id, user_id) VALUES (?, ?, ?)`,
+			sourceType, sourceID, userID)
+		if err != nil {
+			return sent, fmt.Errorf("failed to record mention: %w", err)
+		}
+		if added, _ := result.RowsAffected(); added == 0 {
+			continue
+		}
+
+		if err := m.Notifications.AddMentionNotification(userID, actorID, postID, commentID); err != nil {
+			log.Printf("Erreur lors de la notification de mention de %s (post %d): %v", userID, postID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// allowed indique si userID peut être prévenu d'une mention par actorID dans le post postID :
+// il doit pouvoir voir le post et ne pas avoir bloqué l'auteur.
+func (m *MentionModel) allowed(userID, actorID string, postID int) (bool, error) {
+	if m.Permissions != nil {
+		if err := m.Permissions.CheckPost(userID, postID, ActionView); errors.Is(err, ErrForbidden) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	var blocked int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM UserBlock WHERE blocker_id = ? AND blocked_id = ?`, userID, actorID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check blocks: %w", err)
+	}
+	return blocked == 0, nil
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"forum/models"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrBlocked              = errors.New("this user does not accept your messages")
+	ErrInvalidMessage       = errors.New("a message must contain between 1 and 5000 characters")
+	ErrNoRecipient          = errors.New("choose at least one recipient")
+	ErrTooManyParticipants  = errors.New("too many participants in the conversation")
+	ErrInvalidReport        = errors.New("please give a reason for the report")
+	ErrSelfBlock            = errors.New("you cannot block yourself")
+)
+
+const (
+	// MaxConversationParticipants est la taille maximale d'une conversation de groupe, auteur compris.
+	MaxConversationParticipants = 8
+	maxMessageLength            = 5000
+)
+
+// MessageModel gère les conversations privées, les blocages et les signalements de conversations.
+type MessageModel struct {
+	DB            *sql.DB
+	Notifications *Notification
+}
+
+// Start ouvre une conversation entre senderID et les destinataires avec un premier message.
+// Un message à un seul destinataire, sans titre, reprend la conversation à deux existante.
+func (m *MessageModel) Start(senderID string, recipientIDs []string, title, content string) (int, error) {
+	content, err := validMessage(content)
+	if err != nil {
+		return 0, err
+	}
+
+	// Destinataires distincts, sans l'auteur
+	seen := map[string]bool{senderID: true}
+	var recipients []string
+	for _, id := range recipientIDs {
+		if !seen[id] {
+			seen[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+	if len(recipients) == 0 {
+		return 0, ErrNoRecipient
+	}
+	if len(recipients)+1 > MaxConversationParticipants {
+		return 0, ErrTooManyParticipants
+	}
+
+	args := []interface{}{senderID}
+	for _, id := range recipients {
+		args = append(args, id)
+	}
+	var blocked int
+	err = m.DB.QueryRow(`SELECT COUNT(*) FROM UserBlock WHERE blocked_id = ? AND blocker_id IN (?`+
+		strings.Repeat(", ?", len(recipients)-1)+`)`, args...).Scan(&blocked)
+	if err != nil {
+		return 0, err
+	}
+	if blocked > 0 {
+		return 0, ErrBlocked
+	}
+
+	title = strings.TrimSpace(title)
+	if len(recipients) == 1 && title == "" {
+		existing, err := m.directConversation(senderID, recipients[0])
+		if err != nil {
+			return 0, err
+		}
+		if existing != 0 {
+			_, err := m.Send(existing, senderID, content)
+			return existing, err
+		}
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var nullableTitle interface{}
+	if title != "" {
+		nullableTitle = title
+	}
+	res, err := tx.Exec(`INSERT INTO Conversation (title, created_by) VALUES (?, ?)`, nullableTitle, senderID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	conversationID := int(id)
+
+	for _, userID := range append([]string{senderID}, recipients...) {
+		_, err = tx.Exec(`INSERT INTO ConversationParticipant (conversation_id, user_id) VALUES (?, ?)`, conversationID, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if _, err := addMessage(tx, conversationID, senderID, content); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	m.notifyParticipants(conversationID, senderID)
+	return conversationID, nil
+}
+
+// directConversation retourne la conversation à deux (sans titre) entre deux utilisateurs, ou 0.
+func (m *MessageModel) directConversation(userA, userB string) (int, error) {
+	var id int
+	err := m.DB.QueryRow(`
+		SELECT c.id
+		FROM Conversation c
+		JOIN ConversationParticipant a ON a.conversation_id = c.id AND a.user_id = ?
+		JOIN ConversationParticipant b ON b.conversation_id = c.id AND b.user_id = ?
+		WHERE c.title IS NULL
+		  AND (SELECT COUNT(*) FROM ConversationParticipant p WHERE p.conversation_id = c.id) = 2
+		ORDER BY c.id
+		LIMIT 1`, userA, userB).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// Send ajoute un message à une conversation dont senderID est participant ; retourne l'identifiant du message.
+// Le message est refusé si un autre participant a bloqué l'auteur.
+func (m *MessageModel) Send(conversationID int, senderID, content string) (int, error) {
+	content, err := validMessage(content)
+	if err != nil {
+		return 0, err
+	}
+
+	if ok, err := m.IsParticipant(conversationID, senderID); err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, ErrConversationNotFound
+	}
+
+	var blocked int
+	err = m.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM UserBlock b
+		JOIN ConversationParticipant p ON p.user_id = b.blocker_id
+		WHERE p.conversation_id = ? AND b.blocked_id = ?`, conversationID, senderID).Scan(&blocked)
+	if err != nil {
+		return 0, err
+	}
+	if blocked > 0 {
+		return 0, ErrBlocked
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	messageID, err := addMessage(tx, conversationID, senderID, content)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	m.notifyParticipants(conversationID, senderID)
+	return messageID, nil
+}
+
+// addMessage insère un message, le marque comme lu pour son auteur et fait réapparaître
+// la conversation chez les participants qui l'avaient supprimée.
+func addMessage(tx *sql.Tx, conversationID int, senderID, content string) (int, error) {
+	res, err := tx.Exec(`INSERT INTO Message (conversation_id, sender_id, content) VALUES (?, ?, ?)`, conversationID, senderID, content)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE ConversationParticipant SET hidden = 0 WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`UPDATE ConversationParticipant SET last_read_id = ? WHERE conversation_id = ? AND user_id = ?`, id, conversationID, senderID)
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// notifyParticipants prévient les autres participants d'un nouveau message (non bloquant).
+func (m *MessageModel) notifyParticipants(conversationID int, senderID string) {
+	participants, err := m.participants(conversationID)
+	if err != nil {
+		log.Printf("Erreur lors de la notification de la conversation %d: %v", conversationID, err)
+		return
+	}
+	for _, p := range participants {
+		if p.Id.String() == senderID {
+			continue
+		}
+		if err := m.Notifications.AddMessageNotification(p.Id.String(), senderID, conversationID); err != nil {
+			log.Printf("Erreur lors de la notification de la conversation %d: %v", conversationID, err)
+		}
+	}
+}
+
+// validMessage retourne le message sans espaces superflus, ou ErrInvalidMessage s'il est vide ou trop long.
+func validMessage(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || utf8.RuneCountInString(content) > maxMessageLength {
+		return "", ErrInvalidMessage
+	}
+	return content, nil
+}
+
+// IsParticipant indique si un utilisateur participe à une conversation.
+func (m *MessageModel) IsParticipant(conversationID int, userID string) (bool, error) {
+	var count int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM ConversationParticipant WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// participants retourne les participants d'une conversation, dans leur ordre d'arrivée.
+func (m *MessageModel) participants(conversationID int) ([]models.User, error) {
+	rows, err := m.DB.Query(`
+		SELECT u.id, u.username, COALESCE(u.picture, '')
+		FROM ConversationParticipant p
+		JOIN Users u ON u.id = p.user_id
+		WHERE p.conversation_id = ?
+		ORDER BY p.joined_at, u.username`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		var id string
+		if err := rows.Scan(&id, &u.Username, &u.Picture); err != nil {
+			return nil, err
+		}
+		if u.Id, err = uuid.Parse(id); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Inbox retourne les conversations visibles d'un utilisateur, la plus récemment active en premier.
+func (m *MessageModel) Inbox(userID string) ([]models.ConversationSummary, error) {
+	rows, err := m.DB.Query(`
+		SELECT c.id, COALESCE(c.title, ''),
+			msg.id, msg.sender_id, u.username, msg.content, msg.created_at,
+			(SELECT COUNT(*) FROM Message x
+			 WHERE x.conversation_id = c.id AND x.id > p.last_read_id AND x.id > p.cleared_id
+			   AND x.sender_id != p.user_id)
+		FROM ConversationParticipant p
+		JOIN Conversation c ON c.id = p.conversation_id
+		JOIN Message msg ON msg.id = (SELECT MAX(id) FROM Message WHERE conversation_id = c.id)
+		JOIN Users u ON u.id = msg.sender_id
+		WHERE p.user_id = ? AND p.hidden = 0 AND msg.id > p.cleared_id
+		ORDER BY msg.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var inbox []models.ConversationSummary
+	for rows.Next() {
+		var s models.ConversationSummary
+		var senderID string
+		err := rows.Scan(&s.ID, &s.Title,
+			&s.LastMessage.ID, &senderID, &s.LastMessage.Sender.Username, &s.LastMessage.Content, &s.LastMessage.CreatedAt,
+			&s.Unread)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if s.LastMessage.Sender.Id, err = uuid.Parse(senderID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		inbox = append(inbox, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range inbox {
+		participants, err := m.participants(inbox[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range participants {
+			if p.Id.String() != userID {
+				inbox[i].Participants = append(inbox[i].Participants, p)
+			}
+		}
+	}
+	return inbox, nil
+}
+
+// Conversation retourne une conversation et ses messages pour un participant, sans les messages
+// qu'il a supprimés. Un modérateur (moderator à true) peut lire en entier une conversation signalée.
+func (m *MessageModel) Conversation(conversationID int, userID string, moderator bool) (*models.Conversation, error) {
+	c := &models.Conversation{ID: conversationID}
+	err := m.DB.QueryRow(`
+		SELECT COALESCE(title, ''), created_at,
+			EXISTS (SELECT 1 FROM ConversationReport WHERE conversation_id = c.id AND resolved = 0)
+		FROM Conversation c
+		WHERE id = ?`, conversationID).Scan(&c.Title, &c.CreatedAt, &c.Reported)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConversationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var clearedID int
+	err = m.DB.QueryRow(`SELECT cleared_id FROM ConversationParticipant WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID).Scan(&clearedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !moderator || !c.Reported {
+			return nil, ErrConversationNotFound
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if c.Participants, err = m.participants(conversationID); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT msg.id, msg.sender_id, u.username, COALESCE(u.picture, ''), msg.content, msg.created_at
+		FROM Message msg
+		JOIN Users u ON u.id = msg.sender_id
+		WHERE msg.conversation_id = ? AND msg.id > ?
+		ORDER BY msg.id`, conversationID, clearedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.Message
+		var senderID string
+		if err := rows.Scan(&msg.ID, &senderID, &msg.Sender.Username, &msg.Sender.Picture, &msg.Content, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		if msg.Sender.Id, err = uuid.Parse(senderID); err != nil {
+			return nil, err
+		}
+		c.Messages = append(c.Messages, msg)
+	}
+	return c, rows.Err()
+}
+
+// MarkRead marque comme lus les messages d'une conversation et les notifications qui les annoncent.
+func (m *MessageModel) MarkRead(conversationID int, userID string) error {
+	_, err := m.DB.Exec(`
+		UPDATE ConversationParticipant
+		SET last_read_id = COALESCE((SELECT MAX(id) FROM Message WHERE conversation_id = ?), 0)
+		WHERE conversation_id = ? AND user_id = ?`, conversationID, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	return m.Notifications.ReadMessageNotifications(userID, conversationID)
+}
+
+// UnreadCount retourne le nombre de conversations qui ont des messages non lus.
+func (m *MessageModel) UnreadCount(userID string) (int, error) {
+	var count int
+	err := m.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM ConversationParticipant p
+		WHERE p.user_id = ? AND p.hidden = 0
+		  AND EXISTS (SELECT 1 FROM Message x
+		              WHERE x.conversation_id = p.conversation_id AND x.id > p.last_read_id
+		                AND x.id > p.cleared_id AND x.sender_id != p.user_id)`, userID).Scan(&count)
+	return count, err
+}
+
+// Delete supprime une conversation pour un participant seulement : elle disparaît de sa boîte
+// avec ses messages actuels, et réapparaît, sans eux, au prochain message.
+func (m *MessageModel) Delete(conversationID int, userID string) error {
+	res, err := m.DB.Exec(`
+		UPDATE ConversationParticipant
+		SET hidden = 1,
+			cleared_id = COALESCE((SELECT MAX(id) FROM Message WHERE conversation_id = ?), 0),
+			last_read_id = COALESCE((SELECT MAX(id) FROM Message WHERE conversation_id = ?), 0)
+		WHERE conversation_id = ? AND user_id = ?`, conversationID, conversationID, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrConversationNotFound
+	}
+	return m.Notifications.ReadMessageNotifications(userID, conversationID)
+}
+
+// Block empêche blockedID d'envoyer des messages à blockerID.
+func (m *MessageModel) Block(blockerID, blockedID string) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+	_, err := m.DB.Exec(`INSERT OR IGNORE INTO UserBlock (blocker_id, blocked_id) VALUES (?, ?)`, blockerID, blockedID)
+	return err
+}
+
+// Unblock lève le blocage de blockedID par blockerID.
+func (m *MessageModel) Unblock(blockerID, blockedID string) error {
+	_, err := m.DB.Exec(`DELETE FROM UserBlock WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	return err
+}
+
+// IsBlocked indique si blockerID a bloqué blockedID.
+func (m *MessageModel) IsBlocked(blockerID, blockedID string) (bool, error) {
+	var count int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM UserBlock WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID).Scan(&count)
+	return count > 0, err
+}
+
+// Report signale une conversation aux modérateurs ; seul un participant peut la signaler.
+func (m *MessageModel) Report(conversationID int, userID, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrInvalidReport
+	}
+	if ok, err := m.IsParticipant(conversationID, userID); err != nil {
+		return err
+	} else if !ok {
+		return ErrConversationNotFound
+	}
+
+	_, err := m.DB.Exec(`INSERT INTO ConversationReport (conversation_id, user_id, reason) VALUES (?, ?, ?)`, conversationID, userID, reason)
+	return err
+}
+
+// Reports retourne les signalements de conversations en attente, du plus ancien au plus récent.
+func (m *MessageModel) Reports() ([]models.ConversationReport, error) {
+	rows, err := m.DB.Query(`
+		SELECT r.id, r.conversation_id, COALESCE(c.title, ''), r.user_id, u.username, r.reason, r.created_at
+		FROM ConversationReport r
+		JOIN Conversation c ON c.id = r.conversation_id
+		JOIN Users u ON u.id = r.user_id
+		WHERE r.resolved = 0
+		ORDER BY r.created_at, r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.ConversationReport
+	for rows.Next() {
+		var r models.ConversationReport
+		var reporterID string
+		if err := rows.Scan(&r.ID, &r.ConversationID, &r.Title, &reporterID, &r.Reporter.Username, &r.Reason, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if r.Reporter.Id, err = uuid.Parse(reporterID); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// Resolve clôt les signalements d'une conversation, qui n'est alors plus lisible par les modérateurs.
+func (m *MessageModel) Resolve(conversationID int) error {
+	_, err := m.DB.Exec(`UPDATE ConversationReport SET resolved = 1 WHERE conversation_id = ? AND resolved = 0`, conversationID)
+	return err
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"forum/models"
+	"sync"
+)
+
+// ErrTooManyStreams est retournée quand un utilisateur a déjà le nombre maximal de flux ouverts.
+var ErrTooManyStreams = errors.New("too many notification streams")
+
+// streamBuffer est le nombre d'événements qu'un flux peut avoir en attente avant d'être fermé.
+const streamBuffer = 16
+
+// NotificationHub diffuse en temps réel les nouvelles notifications aux flux ouverts de leur destinataire.
+// Il ne garde rien en mémoire : un client qui se reconnecte rattrape les notifications manquées en base.
+type NotificationHub struct {
+	MaxPerUser int // flux simultanés par utilisateur ; 0 : pas de limite
+
+	mu      sync.Mutex
+	streams map[string]map[*Stream]struct{}
+}
+
+// Stream est un abonnement d'un client aux notifications d'un utilisateur.
+// Events est fermé quand le flux est retiré du hub.
+type Stream struct {
+	Events <-chan models.NotificationEvent
+
+	events chan models.NotificationEvent
+	userID string
+}
+
+// Subscribe ouvre un flux pour userID, dans la limite de MaxPerUser flux simultanés.
+func (h *NotificationHub) Subscribe(userID string) (*Stream, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.MaxPerUser > 0 && len(h.streams[userID]) >= h.MaxPerUser {
+		return nil, ErrTooManyStreams
+	}
+	if h.streams == nil {
+		h.streams = make(map[string]map[*Stream]struct{})
+	}
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[*Stream]struct{})
+	}
+
+	events := make(chan models.NotificationEvent, streamBuffer)
+	stream := &Stream{Events: events, events: events, userID: userID}
+	h.streams[userID][stream] = struct{}{}
+	return stream, nil
+}
+
+// Unsubscribe retire un flux du hub ; sans effet s'il a déjà été retiré.
+func (h *NotificationHub) Unsubscribe(stream *Stream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(stream)
+}
+
+func (h *NotificationHub) remove(stream *Stream) {
+	userStreams := h.streams[stream.userID]
+	if _, ok := userStreams[stream]; !ok {
+		return
+	}
+	delete(userStreams, stream)
+	close(stream.events)
+	if len(userStreams) == 0 {
+		delete(h.streams, stream.userID)
+	}
+}
+
+// Listening indique si userID a au moins un flux ouvert.
+func (h *NotificationHub) Listening(userID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.streams[userID]) > 0
+}
+
+// Publish envoie un événement à tous les flux de userID sans jamais bloquer : un flux dont la file
+// est pleine est fermé, son client se reconnecte et rattrape les notifications avec Last-Event-ID.
+func (h *NotificationHub) Publish(userID string, event models.NotificationEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for stream := range h.streams[userID] {
+		select {
+		case stream.events <- event:
+		default:
+			h.remove(stream)
+		}
+	}
+}
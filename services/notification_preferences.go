@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+	"forum/models"
+)
+
+// Canaux de notification.
+const (
+	ChannelInApp  = "in_app" // cloche, page des notifications et toasts
+	ChannelEmail  = "email"  // un email par notification
+	ChannelDigest = "digest" // résumé périodique par email
+)
+
+// NotificationChannels liste les canaux dans l'ordre de la page des préférences.
+var NotificationChannels = []string{ChannelInApp, ChannelEmail, ChannelDigest}
+
+// defaultChannels sont les canaux d'un événement que l'utilisateur n'a pas réglé.
+var defaultChannels = map[string]bool{ChannelInApp: true, ChannelEmail: false, ChannelDigest: true}
+
+// notificationEvent regroupe les types de notification réglés ensemble.
+type notificationEvent struct {
+	Name  string
+	Label string
+	Types []string
+}
+
+// notificationEvents sont les événements réglables, dans l'ordre de la page des préférences.
+var notificationEvents = []notificationEvent{
+	{Name: "likes", Label: "Likes on your posts", Types: []string{"like"}},
+	{Name: "dislikes", Label: "Dislikes on your posts", Types: []string{"dislike"}},
+	{Name: "comments", Label: "Comments on your posts", Types: []string{"comment"}},
+	{Name: "replies", Label: "Replies to your comments", Types: []string{"reply"}},
+	{Name: "mentions", Label: "Mentions of your username", Types: []string{"mention"}},
+	{Name: "follows", Label: "New posts from people you follow", Types: []string{"new_post"}},
+	{Name: "watches", Label: "Activity on posts and categories you watch", Types: []string{"watch_comment", "watch_post"}},
+	{Name: "messages", Label: "Private messages", Types: []string{"message"}},
+	{Name: "moderation", Label: "Moderation of your posts", Types: []string{"moderation"}},
+	{Name: "badges", Label: "Badges you earn", Types: []string{"badge"}},
+}
+
+// NotificationEventOf retourne l'événement réglable d'un type de notification, ou "" s'il n'en a pas.
+func NotificationEventOf(notifType string) string {
+	for _, event := range notificationEvents {
+		for _, t := range event.Types {
+			if t == notifType {
+				return event.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Preferences retourne les réglages d'un utilisateur pour chaque événement, valeurs par défaut comprises.
+func (n *Notification) Preferences(userId string) ([]models.NotificationPreference, error) {
+	saved, err := n.savedPreferences(userId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := make([]models.NotificationPreference, len(notificationEvents))
+	for i, event := range notificationEvents {
+		prefs[i] = models.NotificationPreference{Event: event.Name, Label: event.Label, Channels: map[string]bool{}}
+		for _, channel := range NotificationChannels {
+			enabled, ok := saved[event.Name+"/"+channel]
+			if !ok {
+				enabled = defaultChannels[channel]
+			}
+			prefs[i].Channels[channel] = enabled
+		}
+	}
+	return prefs, nil
+}
+
+// SetPreferences enregistre les réglages d'un utilisateur ; les événements et canaux inconnus sont ignorés.
+func (n *Notification) SetPreferences(userId string, prefs []models.NotificationPreference) error {
+	tx, err := n.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, pref := range prefs {
+		if !knownEvent(pref.Event) {
+			continue
+		}
+		for _, channel := range NotificationChannels {
+			_, err := tx.Exec(`
+				INSERT INTO NotificationPreference (user_id, event, channel, enabled) VALUES (?, ?, ?, ?)
+				ON CONFLICT (user_id, event, channel) DO UPDATE SET enabled = excluded.enabled`,
+				userId, pref.Event, channel, pref.Channels[channel])
+			if err != nil {
+				return fmt.Errorf("failed to save notification preferences: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Channels retourne les canaux sur lesquels un utilisateur veut recevoir un type de notification.
+// Un type qui n'appartient à aucun événement réglable suit les valeurs par défaut.
+func (n *Notification) Channels(userId, notifType string) (map[string]bool, error) {
+	event := NotificationEventOf(notifType)
+	channels := make(map[string]bool, len(defaultChannels))
+	for channel, enabled := range defaultChannels {
+		channels[channel] = enabled
+	}
+	if event == "" {
+		return channels, nil
+	}
+
+	saved, err := n.savedPreferences(userId, event)
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range NotificationChannels {
+		if enabled, ok := saved[event+"/"+channel]; ok {
+			channels[channel] = enabled
+		}
+	}
+	return channels, nil
+}
+
+// TypesOn retourne les types de notification qu'un utilisateur veut recevoir sur un canal.
+func (n *Notification) TypesOn(userId, channel string) ([]string, error) {
+	prefs, err := n.Preferences(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []string
+	for i, event := range notificationEvents {
+		if prefs[i].Channels[channel] {
+			types = append(types, event.Types...)
+		}
+	}
+	return types, nil
+}
+
+// savedPreferences retourne les réglages enregistrés ("événement/canal" -> activé), pour un événement ou tous ("").
+func (n *Notification) savedPreferences(userId, event string) (map[string]bool, error) {
+	query := `SELECT event, channel, enabled FROM NotificationPreference WHERE user_id = ?`
+	args := []interface{}{userId}
+	if event != "" {
+		query += ` AND event = ?`
+		args = append(args, event)
+	}
+
+	rows, err := n.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	saved := make(map[string]bool)
+	for rows.Next() {
+		var event, channel string
+		var enabled bool
+		if err := rows.Scan(&event, &channel, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		saved[event+"/"+channel] = enabled
+	}
+	return saved, rows.Err()
+}
+
+func knownEvent(name string) bool {
+	for _, event := range notificationEvents {
+		if event.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,15 +2,38 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"forum/models"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+// ErrNotificationNotFound est renvoyée pour une notification inexistante ou appartenant à un autre utilisateur.
+var ErrNotificationNotFound = errors.New("notification not found")
+
 type Notification struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Hub   *NotificationHub   // diffusion en temps réel ; nil : pas de diffusion
+	Email NotificationSender // envoi par email ; nil : canal email inactif
+
+	emails chan int64 // notifications à envoyer par email ; nil : envoyées pendant la requête (voir StartEmails)
 }
 
-func (n *Notification) AddNotification(userId string, postId int, commentId int, notifType string) error {
+// emailQueueSize borne le nombre d'emails en attente d'envoi ; au-delà, ils restent marqués email_pending
+// jusqu'au prochain passage de RunEmailSweeper.
+const emailQueueSize = 256
+
+// NotificationSender envoie une notification hors du site, par exemple par email.
+type NotificationSender interface {
+	SendNotification(userId string, event models.NotificationEvent) error
+}
+
+// AddVoteNotification prévient l'auteur d'un post (ou d'un commentaire si commentId est non nul) que userId
+// l'a aimé ou non (voteType "like" ou "dislike") ; la notification d'un vote précédent du même utilisateur est remplacée.
+func (n *Notification) AddVoteNotification(userId string, postId int, commentId int, voteType string) error {
 	var (
 		ownerId string
 		err     error
@@ -34,67 +57,24 @@ func (n *Notification) AddNotification(userId string, postId int, commentId int,
 		return nil
 	}
 
-	// Préparer `commentId` pour l'insertion (NULL si 0)
-	var nullableCommentId interface{}
-	if commentId == 0 {
-		nullableCommentId = nil
-	} else {
-		nullableCommentId = commentId
-	}
-
-	// Déterminer le type de notification opposé
-	var oppositeNotifType string
-	switch notifType {
-	case "like":
-		oppositeNotifType = "dislike"
-	case "dislike":
-		oppositeNotifType = "like"
-	default:
-		oppositeNotifType = ""
-	}
-
-	// Supprimer la notification opposée si elle existe
-	if oppositeNotifType != "" {
-		queryDeleteOpposite := `
-            DELETE FROM Notification
-            WHERE user_id = ? AND user_id2 = ? AND post_id = ? AND comment_id IS ? AND type = ?
-        `
-		_, err = n.DB.Exec(queryDeleteOpposite, ownerId, userId, postId, nullableCommentId, oppositeNotifType)
-		if err != nil {
-			return fmt.Errorf("failed to delete opposite notification: %w", err)
-		}
-	}
-
-	// Supprimer la notification du même type pour gérer les relikes/redislikes
-	queryDeleteSame := `
-        DELETE FROM Notification
-        WHERE user_id = ? AND user_id2 = ? AND post_id = ? AND comment_id IS ? AND type = ?
-    `
-	result, err := n.DB.Exec(queryDeleteSame, ownerId, userId, postId, nullableCommentId, notifType)
-	if err != nil {
-		return fmt.Errorf("failed to delete existing notification: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-
-	// Si une notification du même type a été supprimée, ne pas réinsérer (annulation d'action)
-	if rowsAffected > 0 {
-		return nil
+	if err := n.RemoveVoteNotification(userId, postId, commentId); err != nil {
+		return err
 	}
+	return n.Dispatch(models.NotificationDraft{
+		UserID: ownerId, ActorID: userId, PostID: postId, CommentID: commentId, Type: voteType,
+	})
+}
 
-	// Ajouter une nouvelle notification
-	queryInsert := `
-        INSERT INTO Notification (user_id, user_id2, post_id, comment_id, type, read)
-        VALUES (?, ?, ?, ?, ?, ?)
-    `
-	_, err = n.DB.Exec(queryInsert, ownerId, userId, postId, nullableCommentId, notifType, false)
+// RemoveVoteNotification supprime la notification du like ou du dislike de userId sur un post
+// (ou un commentaire si commentId est non nul), quand il retire ou change son vote.
+func (n *Notification) RemoveVoteNotification(userId string, postId int, commentId int) error {
+	_, err := n.DB.Exec(`
+		DELETE FROM Notification
+		WHERE user_id2 = ? AND post_id = ? AND comment_id IS ? AND type IN ('like', 'dislike')`,
+		userId, postId, nullableID(commentId))
 	if err != nil {
-		return fmt.Errorf("failed to add notification: %w", err)
+		return fmt.Errorf("failed to delete vote notification: %w", err)
 	}
-
 	return nil
 }
 
@@ -106,11 +86,15 @@ func (n *Notification) AddCommentNotification(commentId int) error {
 		err         error
 	)
 
-	// Récupérer l'ID du post et l'ID de l'auteur du commentaire
+	// Récupérer l'ID du post, l'ID de l'auteur du commentaire et celui du commentaire parent
+	var parentAuthorId sql.NullString
 	queryComment := `
-        SELECT post_id, user_id FROM Comment WHERE id = ?
+        SELECT c.post_id, c.user_id, parent.user_id
+        FROM Comment c
+        LEFT JOIN Comment parent ON parent.id = c.parent_id
+        WHERE c.id = ?
     `
-	err = n.DB.QueryRow(queryComment, commentId).Scan(&postId, &commenterId)
+	err = n.DB.QueryRow(queryComment, commentId).Scan(&postId, &commenterId, &parentAuthorId)
 	if err != nil {
 		return fmt.Errorf("failed to get comment details: %w", err)
 	}
@@ -132,15 +116,105 @@ func (n *Notification) AddCommentNotification(commentId int) error {
 		return nil
 	}
 
+	// Le propriétaire du post qui est aussi l'auteur du commentaire parent reçoit déjà la notification de réponse
+	if parentAuthorId.Valid && parentAuthorId.String == ownerId {
+		return nil
+	}
+
 	// Ajouter la notification pour le propriétaire du post
-	queryInsert := `
-		INSERT INTO Notification (user_id, user_id2, post_id, comment_id, type, read)
-		VALUES (?,?,NULL, ?, ?, ?)
-	`
-	notifType := "comment"
-	_, err = n.DB.Exec(queryInsert, ownerId, commenterId, commentId, notifType, false)
+	return n.Dispatch(models.NotificationDraft{UserID: ownerId, ActorID: commenterId, CommentID: commentId, Type: "comment"})
+}
+
+// AddReplyNotification prévient l'auteur du commentaire parent qu'on lui a répondu.
+// Rien n'est ajouté pour un commentaire de premier niveau, un parent supprimé ou une réponse à soi-même.
+func (n *Notification) AddReplyNotification(commentId int) error {
+	var replierId string
+	var parentAuthorId sql.NullString
+	var parentDeleted sql.NullBool
+
+	query := `
+        SELECT c.user_id, parent.user_id, parent.deleted
+        FROM Comment c
+        LEFT JOIN Comment parent ON parent.id = c.parent_id
+        WHERE c.id = ?
+    `
+	err := n.DB.QueryRow(query, commentId).Scan(&replierId, &parentAuthorId, &parentDeleted)
+	if err != nil {
+		return fmt.Errorf("failed to get reply details: %w", err)
+	}
+
+	if !parentAuthorId.Valid || parentDeleted.Bool || parentAuthorId.String == replierId {
+		return nil
+	}
+
+	return n.Dispatch(models.NotificationDraft{UserID: parentAuthorId.String, ActorID: replierId, CommentID: commentId, Type: "reply"})
+}
+
+// AddBadgeNotification prévient un utilisateur qu'il a obtenu un badge ; badgeName est conservé dans data.
+func (n *Notification) AddBadgeNotification(userId string, badgeName string) error {
+	return n.Dispatch(models.NotificationDraft{UserID: userId, ActorID: userId, Type: "badge", Data: badgeName})
+}
+
+// AddNewPostNotification prévient un abonné que l'auteur qu'il suit a publié un post.
+func (n *Notification) AddNewPostNotification(followerId string, authorId string, postId int) error {
+	return n.Dispatch(models.NotificationDraft{UserID: followerId, ActorID: authorId, PostID: postId, Type: "new_post"})
+}
+
+// AddWatchNotification prévient un abonné d'un nouveau commentaire sur un post qu'il suit (commentId non nul)
+// ou d'un nouveau post dans une catégorie qu'il suit ; actorId est l'auteur du commentaire ou du post.
+func (n *Notification) AddWatchNotification(watcherId string, actorId string, postId int, commentId int) error {
+	if commentId != 0 {
+		return n.Dispatch(models.NotificationDraft{UserID: watcherId, ActorID: actorId, CommentID: commentId, Type: "watch_comment"})
+	}
+	return n.Dispatch(models.NotificationDraft{UserID: watcherId, ActorID: actorId, PostID: postId, Type: "watch_post"})
+}
+
+// AddMentionNotification prévient un utilisateur qu'actorId l'a mentionné dans un commentaire
+// (commentId non nul) ou dans le post postId.
+func (n *Notification) AddMentionNotification(userId string, actorId string, postId int, commentId int) error {
+	if commentId != 0 {
+		return n.Dispatch(models.NotificationDraft{UserID: userId, ActorID: actorId, CommentID: commentId, Type: "mention"})
+	}
+	return n.Dispatch(models.NotificationDraft{UserID: userId, ActorID: actorId, PostID: postId, Type: "mention"})
+}
+
+// AddMessageNotification prévient un participant d'un nouveau message ; l'identifiant de la conversation
+// est conservé dans data. Une seule notification non lue est gardée par conversation.
+func (n *Notification) AddMessageNotification(userId string, senderId string, conversationId int) error {
+	var unread int
+	err := n.DB.QueryRow(`
+		SELECT COUNT(*) FROM Notification WHERE user_id = ? AND type = 'message' AND data = ? AND read = 0
+	`, userId, strconv.Itoa(conversationId)).Scan(&unread)
 	if err != nil {
-		return fmt.Errorf("failed to add notification: %w", err)
+		return fmt.Errorf("failed to check message notifications: %w", err)
+	}
+	if unread > 0 {
+		return nil
+	}
+
+	return n.Dispatch(models.NotificationDraft{UserID: userId, ActorID: senderId, Type: "message", Data: strconv.Itoa(conversationId)})
+}
+
+// AddModerationNotification prévient l'auteur d'un post qu'un modérateur l'a épinglé, verrouillé
+// ou archivé (ou l'inverse) ; l'action est conservée dans data. Rien n'est envoyé pour ses propres posts.
+func (n *Notification) AddModerationNotification(moderatorId string, postId int, action string) error {
+	var authorId string
+	if err := n.DB.QueryRow(`SELECT user_id FROM Post WHERE id = ?`, postId).Scan(&authorId); err != nil {
+		return fmt.Errorf("failed to get post owner: %w", err)
+	}
+	if authorId == moderatorId {
+		return nil
+	}
+	return n.Dispatch(models.NotificationDraft{UserID: authorId, ActorID: moderatorId, PostID: postId, Type: "moderation", Data: action})
+}
+
+// ReadMessageNotifications marque comme lues les notifications de messages d'une conversation.
+func (n *Notification) ReadMessageNotifications(userId string, conversationId int) error {
+	_, err := n.DB.Exec(`
+		UPDATE Notification SET read = 1 WHERE user_id = ? AND type = 'message' AND data = ?
+	`, userId, strconv.Itoa(conversationId))
+	if err != nil {
+		return fmt.Errorf("failed to mark message notifications as read: %w", err)
 	}
 
 	return nil
@@ -149,7 +223,7 @@ func (n *Notification) AddCommentNotification(commentId int) error {
 func (n *Notification) HaveNotifications(userId string) (bool, error) {
 	var count int
 	query := `
-		SELECT COUNT(*) FROM Notification WHERE user_id = ? AND read = 0
+		SELECT COUNT(*) FROM Notification WHERE user_id = ? AND read = 0 AND in_app = 1
 	`
 	err := n.DB.QueryRow(query, userId).Scan(&count)
 	if err != nil {
@@ -159,30 +233,72 @@ func (n *Notification) HaveNotifications(userId string) (bool, error) {
 	return count > 0, nil
 }
 
-func (n *Notification) GetNotification(userId string) ([]models.Notification, error) {
-	var notifications []models.Notification
+// notificationGroup regroupe les notifications non lues semblables : les likes ou dislikes d'une même cible,
+// les commentaires d'un même post et les réponses à un même commentaire. Une notification lue, ou d'un
+// autre type, forme un groupe à elle seule. n est la notification et c son commentaire.
+const notificationGroup = `COALESCE(CASE
+		WHEN n.read = 1 THEN NULL
+		WHEN n.type IN ('like', 'dislike') THEN n.type || ':' || COALESCE(n.post_id, '') || ':' || COALESCE(n.comment_id, '')
+		WHEN n.type IN ('comment', 'watch_comment') THEN n.type || ':' || c.post_id
+		WHEN n.type = 'reply' THEN 'reply:' || c.parent_id
+	END, 'n' || n.id)`
+
+// notificationsOfGroup sélectionne les notifications visibles d'un utilisateur du même groupe qu'une
+// notification ; arguments : l'utilisateur, la notification et de nouveau l'utilisateur.
+const notificationsOfGroup = `id IN (
+		SELECT n.id FROM Notification n LEFT JOIN Comment c ON c.id = n.comment_id
+		WHERE n.user_id = ? AND n.in_app = 1 AND ` + notificationGroup + ` = (
+			SELECT ` + notificationGroup + ` FROM Notification n LEFT JOIN Comment c ON c.id = n.comment_id
+			WHERE n.id = ? AND n.user_id = ? AND n.in_app = 1))`
+
+// GetNotification retourne une page des notifications visibles d'un utilisateur, des plus récentes aux
+// plus anciennes, les non lues semblables regroupées sous la plus récente, et le nombre total de groupes.
+func (n *Notification) GetNotification(userId string, query models.NotificationQuery) ([]models.Notification, int, error) {
+	where := `n.user_id = ? AND n.in_app = 1`
+	if query.UnreadOnly {
+		where += ` AND n.read = 0`
+	}
 
-	query := `
+	var total int
+	err := n.DB.QueryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT 1 FROM Notification n LEFT JOIN Comment c ON c.id = n.comment_id
+			WHERE `+where+` GROUP BY `+notificationGroup+`
+		)`, userId).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	rows, err := n.DB.Query(`
+		WITH grouped AS (
+			SELECT MAX(n.id) AS id, COUNT(*) AS count, COUNT(DISTINCT n.user_id2) AS actors
+			FROM Notification n LEFT JOIN Comment c ON c.id = n.comment_id
+			WHERE `+where+`
+			GROUP BY `+notificationGroup+`
+		)
 		SELECT 
-			n.id, n.user_id, n.user_id2, n.post_id, n.comment_id, n.type, n.read, n.created_at,
+			n.id, n.user_id, n.user_id2, n.post_id, n.comment_id, n.type, COALESCE(n.data, ''), n.read, n.created_at,
 			u1.id, u1.username, u1.email, u1.picture, u1.role, u1.created_at,
 			u2.id, u2.username, u2.email, u2.picture, u2.role, u2.created_at,
 			c.content, c.post_id,
-			p.title
-		FROM Notification n
+			COALESCE(p.title, cp.title),
+			g.count, g.actors
+		FROM grouped g
+		JOIN Notification n ON n.id = g.id
 		LEFT JOIN Users u1 ON n.user_id = u1.id
 		LEFT JOIN Users u2 ON n.user_id2 = u2.id
 		LEFT JOIN Comment c ON n.comment_id = c.id
 		LEFT JOIN Post p ON n.post_id = p.id
-		WHERE n.user_id = ? AND n.read = 0
-	`
-
-	rows, err := n.DB.Query(query, userId)
+		LEFT JOIN Post cp ON c.post_id = cp.id
+		ORDER BY n.id DESC
+		LIMIT ? OFFSET ?
+	`, userId, query.PerPage, (query.Page-1)*query.PerPage)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get notifications: %w", err)
+		return nil, 0, fmt.Errorf("failed to get notifications: %w", err)
 	}
 	defer rows.Close()
 
+	var notifications []models.Notification
 	for rows.Next() {
 		var notif models.Notification
 		var user1, user2 models.User
@@ -191,24 +307,28 @@ func (n *Notification) GetNotification(userId string) ([]models.Notification, er
 		var commentContent sql.NullString
 		var commentPostId sql.NullInt64
 		var postTitle sql.NullString
+		var actors int
 
 		err = rows.Scan(
 			&notif.Id, &notif.UserId.Id, &notif.UserId2.Id, &postId, &commentId,
-			&notif.Type, &notif.IsRead, &notif.CreatedAt,
+			&notif.Type, &notif.Data, &notif.IsRead, &notif.CreatedAt,
 			&user1.Id, &user1.Username, &user1.Email, &user1.Picture, &user1.Roles, &user1.CreatedAt,
 			&user2.Id, &user2.Username, &user2.Email, &user2.Picture, &user2.Roles, &user2.CreatedAt,
 			&commentContent, &commentPostId,
 			&postTitle,
+			&notif.Count, &actors,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan notification: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan notification: %w", err)
 		}
+		notif.Others = actors - 1
 
 		// Associate users
 		notif.UserId = user1
 		notif.UserId2 = user2
 
-		// Handle NULL values for Post_Id and Comment_Id
+		// Handle NULL values for Post_Id and Comment_Id ; le titre d'une notification de commentaire
+		// est celui du post commenté
 		if postId.Valid {
 			notif.Post_Id = &models.Post{
 				ID:    int(postId.Int64),
@@ -224,59 +344,398 @@ func (n *Notification) GetNotification(userId string) ([]models.Notification, er
 				Content: commentContent.String,
 				PostID:  int(commentPostId.Int64),
 			}
+			if !postId.Valid && commentPostId.Valid {
+				notif.Post_Id = &models.Post{ID: int(commentPostId.Int64), Title: postTitle.String}
+			}
 		} else {
 			notif.Comment_Id = nil
 		}
 
 		notifications = append(notifications, notif)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read notifications: %w", err)
+	}
 
-	return notifications, nil
+	return notifications, total, nil
 }
 
+// ReadNotification marque comme lue une notification de l'utilisateur et celles de son groupe.
 func (n *Notification) ReadNotification(userId string, notifId int) error {
-	query := `
-		UPDATE Notification
-		SET read = 1
-		WHERE user_id = ? AND id = ?
-	`
-	_, err := n.DB.Exec(query, userId, notifId)
+	result, err := n.DB.Exec(`UPDATE Notification SET read = 1 WHERE read = 0 AND `+notificationsOfGroup,
+		userId, notifId, userId)
 	if err != nil {
 		return fmt.Errorf("failed to mark notification as read: %w", err)
 	}
+	return n.checkAffected(result, userId, notifId)
+}
 
+// ReadAll marque comme lues toutes les notifications visibles d'un utilisateur.
+func (n *Notification) ReadAll(userId string) error {
+	_, err := n.DB.Exec(`UPDATE Notification SET read = 1 WHERE user_id = ? AND read = 0 AND in_app = 1`, userId)
+	if err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
 	return nil
 }
 
-func (n *Notification) GetPostId(notifId int) (int, error) {
-	var postId sql.NullInt64
-	var commentId sql.NullInt64
+// DeleteNotification supprime une notification de l'utilisateur et celles de son groupe.
+func (n *Notification) DeleteNotification(userId string, notifId int) error {
+	result, err := n.DB.Exec(`DELETE FROM Notification WHERE `+notificationsOfGroup, userId, notifId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+	return n.checkAffected(result, userId, notifId)
+}
 
-	query := `
-		SELECT post_id, comment_id FROM Notification WHERE id = ?
-	`
-	err := n.DB.QueryRow(query, notifId).Scan(&postId, &commentId)
+// DeleteAll supprime toutes les notifications visibles d'un utilisateur ; celles gardées pour le seul
+// résumé par email restent jusqu'à son envoi.
+func (n *Notification) DeleteAll(userId string) error {
+	_, err := n.DB.Exec(`DELETE FROM Notification WHERE user_id = ? AND in_app = 1`, userId)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get post ID and comment ID: %w", err)
+		return fmt.Errorf("failed to delete notifications: %w", err)
 	}
+	return nil
+}
 
-	if postId.Valid {
-		return int(postId.Int64), nil
+// checkAffected renvoie ErrNotificationNotFound si une requête sur une notification n'a touché aucune
+// ligne parce qu'elle n'appartient pas à l'utilisateur (une notification déjà lue n'est pas une erreur).
+func (n *Notification) checkAffected(result sql.Result, userId string, notifId int) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	var exists bool
+	err = n.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM Notification WHERE id = ? AND user_id = ? AND in_app = 1)`,
+		notifId, userId).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get notification: %w", err)
+	}
+	if !exists {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// Destination retourne la page où mène une notification de l'utilisateur : le commentaire, la conversation,
+// les badges du profil ou le post ; ErrNotificationNotFound si elle ne lui appartient pas.
+func (n *Notification) Destination(userId string, notifId int) (string, error) {
+	var notifType, data, username string
+	var postId, commentId sql.NullInt64
+
+	err := n.DB.QueryRow(`
+		SELECT n.type, COALESCE(n.data, ''), n.post_id, n.comment_id, u.username
+		FROM Notification n
+		JOIN Users u ON u.id = n.user_id
+		WHERE n.id = ? AND n.user_id = ? AND n.in_app = 1
+	`, notifId, userId).Scan(&notifType, &data, &postId, &commentId, &username)
+	if err == sql.ErrNoRows {
+		return "", ErrNotificationNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get notification target: %w", err)
 	}
 
-	if commentId.Valid {
-		queryComment := `
-			SELECT post_id FROM Comment WHERE id = ?
-		`
-		err = n.DB.QueryRow(queryComment, commentId.Int64).Scan(&postId)
+	return notificationLink(notifType, data, username, postId, commentId), nil
+}
+
+// notificationLink retourne le chemin de ce que désigne une notification ; username est son destinataire.
+func notificationLink(notifType, data, username string, postId, commentId sql.NullInt64) string {
+	switch {
+	case commentId.Valid:
+		return fmt.Sprintf("/comment/%d", commentId.Int64)
+	case notifType == "message":
+		return "/messages/" + data
+	case notifType == "badge":
+		return "/profile/" + url.PathEscape(username) + "#badges"
+	case postId.Valid:
+		return fmt.Sprintf("/post/direct/%d", postId.Int64)
+	}
+	return "/notification"
+}
+
+// Prune supprime les notifications lues, et celles gardées pour le seul résumé par email,
+// plus anciennes que days jours.
+func (n *Notification) Prune(days int) (int64, error) {
+	result, err := n.DB.Exec(`
+		DELETE FROM Notification
+		WHERE (read = 1 OR in_app = 0) AND created_at < datetime('now', ?)`,
+		fmt.Sprintf("-%d days", days))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune notifications: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RunPruner supprime à intervalle régulier les anciennes notifications ; à lancer dans une goroutine.
+func (n *Notification) RunPruner(days int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := n.Prune(days)
 		if err != nil {
-			return 0, fmt.Errorf("failed to get post ID from comment: %w", err)
+			log.Printf("Erreur lors de la suppression des anciennes notifications: %v", err)
+		} else if pruned > 0 {
+			log.Printf("%d notification(s) de plus de %d jours supprimée(s)", pruned, days)
 		}
+		<-ticker.C
+	}
+}
 
-		if postId.Valid {
-			return int(postId.Int64), nil
+// UnreadCount retourne le nombre de notifications non lues d'un utilisateur.
+func (n *Notification) UnreadCount(userId string) (int, error) {
+	var count int
+	err := n.DB.QueryRow(`SELECT COUNT(*) FROM Notification WHERE user_id = ? AND read = 0 AND in_app = 1`, userId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get notification count: %w", err)
+	}
+	return count, nil
+}
+
+// maxReplayedEvents borne le nombre de notifications renvoyées à un flux qui se reconnecte.
+const maxReplayedEvents = 50
+
+// Since retourne, de la plus ancienne à la plus récente, les notifications non lues d'un utilisateur
+// postérieures à lastId : ce qu'un flux a manqué pendant sa déconnexion.
+func (n *Notification) Since(userId string, lastId int) ([]models.NotificationEvent, error) {
+	return n.events(`n.user_id = ? AND n.read = 0 AND n.in_app = 1 AND n.id > ? ORDER BY n.id LIMIT ?`, userId, lastId, maxReplayedEvents)
+}
+
+// Dispatch envoie une notification sur les canaux choisis par son destinataire ; toutes les notifications
+// passent par ici. Elle est enregistrée si l'un des canaux la veut (le résumé relit la base), n'apparaît
+// sur le site que si le canal in_app est activé et part par email, en arrière-plan (voir StartEmails),
+// si un expéditeur est configuré. Dispatch n'attend ni l'envoi des emails ni les pages ouvertes.
+func (n *Notification) Dispatch(d models.NotificationDraft) error {
+	channels, err := n.Channels(d.UserID, d.Type)
+	if err != nil {
+		return err
+	}
+	if !channels[ChannelInApp] && !channels[ChannelEmail] && !channels[ChannelDigest] {
+		return nil
+	}
+
+	sendEmail := channels[ChannelEmail] && n.Email != nil
+	result, err := n.DB.Exec(`
+		INSERT INTO Notification (user_id, user_id2, post_id, comment_id, type, data, read, in_app, email_pending)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?)`,
+		d.UserID, d.ActorID, nullableID(d.PostID), nullableID(d.CommentID), d.Type, d.Data, false, channels[ChannelInApp], sendEmail)
+	if err != nil {
+		return fmt.Errorf("failed to add %s notification: %w", d.Type, err)
+	}
+
+	publish := channels[ChannelInApp] && n.Hub != nil && n.Hub.Listening(d.UserID)
+	if !sendEmail && !publish {
+		return nil
+	}
+
+	// Les canaux en direct et email sont secondaires : une erreur est seulement journalisée
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Erreur lors de l'envoi d'une notification à %s: %v", d.UserID, err)
+		return nil
+	}
+	if publish {
+		events, err := n.events(`n.id = ?`, id)
+		if err != nil || len(events) == 0 {
+			log.Printf("Erreur lors de l'envoi de la notification %d: %v", id, err)
+		} else {
+			n.Hub.Publish(d.UserID, events[0])
 		}
 	}
+	if sendEmail {
+		n.queueEmail(id)
+	}
+	return nil
+}
 
-	return 0, fmt.Errorf("post ID not found")
+// StartEmails lance workers goroutines qui envoient les notifications du canal email, pour que la requête
+// qui crée une notification n'attende pas le serveur SMTP. Sans appel à StartEmails, elles partent pendant la requête.
+func (n *Notification) StartEmails(workers int) {
+	if n.emails != nil || n.Email == nil || workers <= 0 {
+		return
+	}
+	n.emails = make(chan int64, emailQueueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for id := range n.emails {
+				if err := n.sendEmail(id); err != nil {
+					log.Printf("Erreur lors de l'envoi par email de la notification %d: %v", id, err)
+				}
+			}
+		}()
+	}
+}
+
+// RunEmailSweeper remet dans la file, au démarrage puis toutes les interval, les emails qui ne sont
+// pas partis : file pleine, erreur d'envoi ou redémarrage du serveur. Ils sont abandonnés au bout d'un jour.
+func (n *Notification) RunEmailSweeper(interval time.Duration) {
+	for {
+		if err := n.sweepEmails(); err != nil {
+			log.Printf("Erreur lors de la reprise des emails en attente : %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (n *Notification) sweepEmails() error {
+	if n.Email == nil {
+		return nil
+	}
+	rows, err := n.DB.Query(`SELECT id FROM Notification WHERE email_pending = 1 AND created_at >= datetime('now', '-1 day')`)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		n.queueEmail(id)
+	}
+	return nil
+}
+
+// queueEmail met une notification dans la file d'envoi, ou l'envoie aussitôt si StartEmails n'a pas été appelée.
+func (n *Notification) queueEmail(id int64) {
+	if n.emails == nil {
+		if err := n.sendEmail(id); err != nil {
+			log.Printf("Erreur lors de l'envoi par email de la notification %d: %v", id, err)
+		}
+		return
+	}
+	select {
+	case n.emails <- id:
+	default:
+		// File pleine : l'email reste marqué jusqu'au prochain passage de RunEmailSweeper
+	}
+}
+
+// sendEmail envoie une notification par email. Elle est réservée avant l'envoi pour ne partir qu'une fois,
+// même mise deux fois dans la file, et remise en attente si l'envoi échoue.
+func (n *Notification) sendEmail(id int64) error {
+	result, err := n.DB.Exec(`UPDATE Notification SET email_pending = 0 WHERE id = ? AND email_pending = 1`, id)
+	if err != nil {
+		return err
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return nil
+	}
+
+	var userId string
+	if err := n.DB.QueryRow(`SELECT user_id FROM Notification WHERE id = ?`, id).Scan(&userId); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	events, err := n.events(`n.id = ?`, id)
+	if err == nil && len(events) > 0 {
+		err = n.Email.SendNotification(userId, events[0])
+	}
+	if err != nil {
+		if _, dbErr := n.DB.Exec(`UPDATE Notification SET email_pending = 1 WHERE id = ?`, id); dbErr != nil {
+			log.Printf("Erreur lors de la remise en attente de l'email de la notification %d: %v", id, dbErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// nullableID convertit un identifiant facultatif pour la base : 0 devient NULL.
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// events charge les notifications qui vérifient where sous la forme envoyée aux flux.
+func (n *Notification) events(where string, args ...interface{}) ([]models.NotificationEvent, error) {
+	rows, err := n.DB.Query(`
+		SELECT n.id, n.user_id, n.type, COALESCE(n.data, ''), COALESCE(u2.username, ''),
+			COALESCE(p.title, cp.title, ''), COALESCE(c.content, '')
+		FROM Notification n
+		LEFT JOIN Users u2 ON u2.id = n.user_id2
+		LEFT JOIN Post p ON p.id = n.post_id
+		LEFT JOIN Comment c ON c.id = n.comment_id
+		LEFT JOIN Post cp ON cp.id = c.post_id
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.NotificationEvent
+	var userId string
+	for rows.Next() {
+		var event models.NotificationEvent
+		var data, title, comment string
+		if err := rows.Scan(&event.ID, &userId, &event.Type, &data, &event.Actor, &title, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan notification event: %w", err)
+		}
+		event.Text = notificationText(event.Type, event.Actor, title, comment, data)
+		event.Link = fmt.Sprintf("/notification/read/%d", event.ID)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read notification events: %w", err)
+	}
+
+	if len(events) > 0 {
+		unread, err := n.UnreadCount(userId)
+		if err != nil {
+			return nil, err
+		}
+		for i := range events {
+			events[i].Unread = unread
+		}
+	}
+	return events, nil
+}
+
+// notificationText reprend en texte brut les phrases de la page des notifications.
+func notificationText(notifType, actor, title, comment, data string) string {
+	if excerpt := []rune(comment); len(excerpt) > 80 {
+		comment = string(excerpt[:80]) + "…"
+	}
+	switch notifType {
+	case "like":
+		return fmt.Sprintf("%s a aimé votre publication : \"%s\".", actor, title)
+	case "dislike":
+		return fmt.Sprintf("%s n'a pas aimé votre publication : \"%s\".", actor, title)
+	case "comment":
+		return fmt.Sprintf("%s a commenté votre publication : \"%s\".", actor, comment)
+	case "reply":
+		return fmt.Sprintf("%s a répondu à votre commentaire : \"%s\".", actor, comment)
+	case "mention":
+		if comment != "" {
+			return fmt.Sprintf("%s vous a mentionné dans un commentaire : \"%s\".", actor, comment)
+		}
+		return fmt.Sprintf("%s vous a mentionné dans une publication : \"%s\".", actor, title)
+	case "new_post":
+		return fmt.Sprintf("%s a publié un nouveau post : \"%s\".", actor, title)
+	case "watch_comment":
+		return fmt.Sprintf("%s a commenté un post que vous suivez : \"%s\".", actor, comment)
+	case "watch_post":
+		return fmt.Sprintf("%s a publié dans une catégorie que vous suivez : \"%s\".", actor, title)
+	case "message":
+		return fmt.Sprintf("%s vous a envoyé un message.", actor)
+	case "badge":
+		return fmt.Sprintf("Vous avez obtenu le badge \"%s\".", data)
+	case "moderation":
+		return fmt.Sprintf("%s %s votre publication : \"%s\".", actor, models.ModerationVerb(data), title)
+	}
+	return "Nouvelle notification."
 }
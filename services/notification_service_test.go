@@ -0,0 +1,227 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"forum/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSender remplace l'envoi d'emails : il note les notifications envoyées et peut être bloqué
+// (serveur SMTP lent) ou échouer (serveur injoignable).
+type fakeSender struct {
+	mu      sync.Mutex
+	sent    []int
+	fail    error
+	release chan struct{} // non nil : chaque envoi attend sa fermeture
+	done    chan int
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{done: make(chan int, 16)}
+}
+
+func (s *fakeSender) SendNotification(userId string, event models.NotificationEvent) error {
+	s.mu.Lock()
+	release, fail := s.release, s.fail
+	s.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	if fail != nil {
+		s.done <- 0
+		return fail
+	}
+	s.mu.Lock()
+	s.sent = append(s.sent, event.ID)
+	s.mu.Unlock()
+	s.done <- event.ID
+	return nil
+}
+
+func (s *fakeSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+func (s *fakeSender) wait(t *testing.T) int {
+	t.Helper()
+	select {
+	case id := <-s.done:
+		return id
+	case <-time.After(5 * time.Second):
+		t.Fatal("email never sent")
+		return 0
+	}
+}
+
+// enableEmail active le canal email des likes pour userId.
+func enableEmail(t *testing.T, n *Notification, userId string) {
+	t.Helper()
+	err := n.SetPreferences(userId, []models.NotificationPreference{{
+		Event:    "likes",
+		Channels: map[string]bool{ChannelInApp: true, ChannelEmail: true, ChannelDigest: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func emailPending(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM Notification WHERE email_pending = 1`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestDispatchEmailInBackground vérifie que Dispatch n'attend pas l'envoi des emails, qu'un email qui
+// échoue est repris par le balayage et qu'aucun n'est envoyé deux fois.
+func TestDispatchEmailInBackground(t *testing.T) {
+	db := reputationDB(t)
+	sender := newFakeSender()
+	n := &Notification{DB: db, Email: sender}
+	enableEmail(t, n, testAuthor)
+	n.StartEmails(1)
+
+	// Serveur SMTP bloqué : Dispatch retourne quand même
+	sender.mu.Lock()
+	sender.release = make(chan struct{})
+	sender.mu.Unlock()
+	returned := make(chan error, 1)
+	go func() {
+		returned <- n.Dispatch(models.NotificationDraft{UserID: testAuthor, ActorID: testVoter, PostID: 1, Type: "like"})
+	}()
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Dispatch waited for the email to be sent")
+	}
+	sender.mu.Lock()
+	close(sender.release)
+	sender.release = nil
+	sender.mu.Unlock()
+	id := sender.wait(t)
+	if pending := emailPending(t, db); pending != 0 {
+		t.Fatalf("%d emails still pending after sending notification %d", pending, id)
+	}
+
+	// Une remise en file d'une notification déjà envoyée ne la renvoie pas
+	n.queueEmail(int64(id))
+	if err := n.sweepEmails(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if sent := sender.count(); sent != 1 {
+		t.Fatalf("%d emails sent, want 1", sent)
+	}
+
+	// Échec d'envoi : l'email reste en attente, puis part au balayage suivant
+	sender.mu.Lock()
+	sender.fail = errors.New("smtp unreachable")
+	sender.mu.Unlock()
+	if err := n.Dispatch(models.NotificationDraft{UserID: testAuthor, ActorID: testOther, PostID: 1, Type: "like"}); err != nil {
+		t.Fatal(err)
+	}
+	sender.wait(t)
+	deadline := time.Now().Add(5 * time.Second)
+	for emailPending(t, db) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("failed email not put back in the queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sender.mu.Lock()
+	sender.fail = nil
+	sender.mu.Unlock()
+	if err := n.sweepEmails(); err != nil {
+		t.Fatal(err)
+	}
+	sender.wait(t)
+	if sent := sender.count(); sent != 2 {
+		t.Fatalf("%d emails sent, want 2", sent)
+	}
+}
+
+// TestDispatchChannels vérifie que Dispatch suit les canaux choisis : rien n'est enregistré sans canal actif,
+// une notification gardée pour le seul résumé n'apparaît pas sur le site, et l'email ne part que s'il est demandé.
+func TestDispatchChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels map[string]bool // nil : préférences par défaut
+		stored   bool
+		inApp    bool
+		email    bool
+	}{
+		{"default preferences", nil, true, true, false},
+		{"all channels off", map[string]bool{ChannelInApp: false, ChannelEmail: false, ChannelDigest: false}, false, false, false},
+		{"digest only", map[string]bool{ChannelInApp: false, ChannelEmail: false, ChannelDigest: true}, true, false, false},
+		{"email only", map[string]bool{ChannelInApp: false, ChannelEmail: true, ChannelDigest: false}, true, false, true},
+		{"every channel", map[string]bool{ChannelInApp: true, ChannelEmail: true, ChannelDigest: true}, true, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := reputationDB(t)
+			sender := newFakeSender()
+			n := &Notification{DB: db, Hub: &NotificationHub{}, Email: sender}
+			if test.channels != nil {
+				err := n.SetPreferences(testAuthor, []models.NotificationPreference{{Event: "likes", Channels: test.channels}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			stream, err := n.Hub.Subscribe(testAuthor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer n.Hub.Unsubscribe(stream)
+
+			if err := n.Dispatch(models.NotificationDraft{UserID: testAuthor, ActorID: testVoter, PostID: 1, Type: "like"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var stored, inApp int
+			if err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(in_app), 0) FROM Notification`).Scan(&stored, &inApp); err != nil {
+				t.Fatal(err)
+			}
+			if (stored == 1) != test.stored || stored > 1 {
+				t.Errorf("%d notifications stored, want stored = %v", stored, test.stored)
+			}
+			if (inApp == 1) != test.inApp {
+				t.Errorf("in_app = %d, want %v", inApp, test.inApp)
+			}
+			select {
+			case <-stream.Events:
+				if !test.inApp {
+					t.Error("notification published to the site although in_app is off")
+				}
+			default:
+				if test.inApp {
+					t.Error("notification not published to the open stream")
+				}
+			}
+			// Sans StartEmails, l'email part pendant Dispatch
+			if sent := sender.count(); (sent == 1) != test.email {
+				t.Errorf("%d emails sent, want email = %v", sent, test.email)
+			}
+		})
+	}
+
+	// Canal email choisi mais aucun expéditeur configuré : la notification n'attend pas d'envoi
+	db := reputationDB(t)
+	n := &Notification{DB: db}
+	enableEmail(t, n, testAuthor)
+	if err := n.Dispatch(models.NotificationDraft{UserID: testAuthor, ActorID: testVoter, PostID: 1, Type: "like"}); err != nil {
+		t.Fatal(err)
+	}
+	if pending := emailPending(t, db); pending != 0 {
+		t.Fatalf("%d emails pending without a sender", pending)
+	}
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"forum/models"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PermissionModel applique les règles d'accès par catégorie (lecture, création de posts, commentaires)
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+// Actions soumises aux règles d'accès
+const (
+	ActionView    = "view"
+	ActionPost    = "post"
+	ActionComment = "comment"
+)
+
+var (
+	ErrForbidden         = errors.New("you are not allowed to do this in this category")
+	ErrInvalidPermission = errors.New("invalid permission rule")
+	ErrGroupNotFound     = errors.New("group not found")
+	ErrUserNotFound      = errors.New("user not found")
+)
+
+// Rang des rôles : une règle portant sur un rôle s'applique aussi aux rôles supérieurs
+var roleRank = map[string]int{
+	"guest":     0,
+	"user":      1,
+	"moderator": 2,
+	"admin":     3,
+}
+
+// viewer décrit l'utilisateur dont on vérifie les droits
+type viewer struct {
+	role   string
+	groups map[int]bool
+}
+
+// accessRules contient l'arbre des catégories et leurs règles, chargés pour une vérification
+type accessRules struct {
+	parents map[int]int
+	rules   map[int]map[string][]models.CategoryPermission
+}
+
+// Can indique si l'utilisateur (vide pour un visiteur) peut effectuer l'action dans la catégorie.
+// Voir une catégorie suppose de pouvoir voir toutes ses catégories parentes ; poster ou
+// commenter suppose de pouvoir la voir.
+func (m *PermissionModel) Can(userId string, catID int, action string) (bool, error) {
+	v, err := m.loadViewer(userId)
+	if err != nil {
+		return false, err
+	}
+	rules, err := m.loadRules()
+	if err != nil {
+		return false, err
+	}
+	return rules.can(v, catID, action), nil
+}
+
+// CheckCategories renvoie ErrForbidden si l'action n'est pas permise dans l'une des catégories.
+func (m *PermissionModel) CheckCategories(userId string, catIDs []int, action string) error {
+	v, err := m.loadViewer(userId)
+	if err != nil {
+		return err
+	}
+	rules, err := m.loadRules()
+	if err != nil {
+		return err
+	}
+	for _, catID := range catIDs {
+		if !rules.can(v, catID, action) {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// CheckPost vérifie l'action dans toutes les catégories d'un post.
+func (m *PermissionModel) CheckPost(userId string, postID int, action string) error {
+	rows, err := m.DB.Query("SELECT cat_id FROM Catpostrel WHERE post_id = ?", postID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var catIDs []int
+	for rows.Next() {
+		var catID int
+		if err := rows.Scan(&catID); err != nil {
+			return err
+		}
+		catIDs = append(catIDs, catID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return m.CheckCategories(userId, catIDs, action)
+}
+
+// AllowedCategories retourne l'ensemble des catégories où l'utilisateur peut effectuer l'action.
+func (m *PermissionModel) AllowedCategories(userId string, action string) (map[int]bool, error) {
+	v, err := m.loadViewer(userId)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := m.loadRules()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := map[int]bool{}
+	for catID := range rules.parents {
+		if rules.can(v, catID, action) {
+			allowed[catID] = true
+		}
+	}
+	return allowed, nil
+}
+
+// HiddenCategories retourne les catégories que l'utilisateur ne peut pas voir.
+func (m *PermissionModel) HiddenCategories(userId string) ([]int, error) {
+	v, err := m.loadViewer(userId)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := m.loadRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var hidden []int
+	for catID := range rules.parents {
+		if !rules.can(v, catID, ActionView) {
+			hidden = append(hidden, catID)
+		}
+	}
+	return hidden, nil
+}
+
+// hiddenPostFilter construit la condition excluant les posts rangés dans une catégorie invisible
+// pour l'utilisateur. postColumn désigne la colonne contenant l'identifiant du post.
+func hiddenPostFilter(perms *PermissionModel, userId, postColumn string) (string, []interface{}, error) {
+	if perms == nil {
+		return "", nil, nil
+	}
+	hidden, err := perms.HiddenCategories(userId)
+	if err != nil || len(hidden) == 0 {
+		return "", nil, err
+	}
+
+	placeholders := make([]string, len(hidden))
+	args := make([]interface{}, len(hidden))
+	for i, catID := range hidden {
+		placeholders[i] = "?"
+		args[i] = catID
+	}
+
+	where := ` AND NOT EXISTS (
+		SELECT 1 FROM Catpostrel hidden_cp
+		WHERE hidden_cp.post_id = ` + postColumn + `
+		  AND hidden_cp.cat_id IN (` + strings.Join(placeholders, ", ") + `))`
+	return where, args, nil
+}
+
+// loadViewer lit le rôle et les groupes de l'utilisateur ; un utilisateur inconnu est un visiteur.
+func (m *PermissionModel) loadViewer(userId string) (viewer, error) {
+	v := viewer{role: "guest", groups: map[int]bool{}}
+	if userId == "" {
+		return v, nil
+	}
+
+	var role sql.NullString
+	err := m.DB.QueryRow("SELECT role FROM Users WHERE id = ?", userId).Scan(&role)
+	if err == sql.ErrNoRows {
+		return v, nil
+	} else if err != nil {
+		return v, err
+	}
+	v.role = "user"
+	if _, ok := roleRank[role.String]; ok && role.String != "guest" {
+		v.role = role.String
+	}
+
+	rows, err := m.DB.Query("SELECT group_id FROM UserGroupMember WHERE user_id = ?", userId)
+	if err != nil {
+		return v, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupID int
+		if err := rows.Scan(&groupID); err != nil {
+			return v, err
+		}
+		v.groups[groupID] = true
+	}
+
+	return v, rows.Err()
+}
+
+// loadRules charge l'arbre des catégories et toutes les règles d'accès.
+func (m *PermissionModel) loadRules() (*accessRules, error) {
+	rules := &accessRules{
+		parents: map[int]int{},
+		rules:   map[int]map[string][]models.CategoryPermission{},
+	}
+
+	rows, err := m.DB.Query("SELECT id, COALESCE(parent_id, 0) FROM Categories")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, parentID int
+		if err := rows.Scan(&id, &parentID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rules.parents[id] = parentID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = m.DB.Query("SELECT id, cat_id, action, COALESCE(role, ''), COALESCE(group_id, 0) FROM CategoryPermission")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p models.CategoryPermission
+		if err := rows.Scan(&p.ID, &p.CategoryID, &p.Action, &p.Role, &p.GroupID); err != nil {
+			return nil, err
+		}
+		if rules.rules[p.CategoryID] == nil {
+			rules.rules[p.CategoryID] = map[string][]models.CategoryPermission{}
+		}
+		rules.rules[p.CategoryID][p.Action] = append(rules.rules[p.CategoryID][p.Action], p)
+	}
+
+	return rules, rows.Err()
+}
+
+func (r *accessRules) can(v viewer, catID int, action string) bool {
+	// La catégorie et tous ses ancêtres doivent être visibles
+	visited := map[int]bool{}
+	for id := catID; id != 0 && !visited[id]; id = r.parents[id] {
+		visited[id] = true
+		if !v.allows(r.rules[id][ActionView], ActionView) {
+			return false
+		}
+	}
+
+	if action == ActionView {
+		return true
+	}
+	// Seuls les utilisateurs connectés peuvent écrire
+	return v.role != "guest" && v.allows(r.rules[catID][action], action)
+}
+
+// allows applique les règles d'une action : sans règle, la lecture est ouverte à tous et
+// l'écriture aux utilisateurs connectés. Les administrateurs ont tous les droits.
+func (v viewer) allows(rules []models.CategoryPermission, action string) bool {
+	if v.role == "admin" {
+		return true
+	}
+	if len(rules) == 0 {
+		return action == ActionView || roleRank[v.role] >= roleRank["user"]
+	}
+	for _, rule := range rules {
+		if rule.GroupID != 0 && v.groups[rule.GroupID] {
+			return true
+		}
+		if rule.Role != "" && roleRank[v.role] >= roleRank[rule.Role] {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules retourne toutes les règles d'accès, triées par catégorie.
+func (m *PermissionModel) Rules() ([]models.CategoryPermission, error) {
+	rows, err := m.DB.Query(`
+		SELECT p.id, p.cat_id, c.name, p.action, COALESCE(p.role, ''), COALESCE(p.group_id, 0), COALESCE(g.name, '')
+		FROM CategoryPermission p
+		JOIN Categories c ON c.id = p.cat_id
+		LEFT JOIN UserGroup g ON g.id = p.group_id
+		ORDER BY c.position, c.name, p.action`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.CategoryPermission
+	for rows.Next() {
+		var p models.CategoryPermission
+		err := rows.Scan(&p.ID, &p.CategoryID, &p.CategoryName, &p.Action, &p.Role, &p.GroupID, &p.GroupName)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, p)
+	}
+	return rules, rows.Err()
+}
+
+// AddRule ajoute une règle accordant l'action à un rôle minimum ou à un groupe (l'un ou l'autre).
+func (m *PermissionModel) AddRule(catID int, action, role string, groupID int) error {
+	if action != ActionView && action != ActionPost && action != ActionComment {
+		return ErrInvalidPermission
+	}
+	if (role == "") == (groupID == 0) {
+		return ErrInvalidPermission
+	}
+	if _, ok := roleRank[role]; role != "" && !ok {
+		return ErrInvalidPermission
+	}
+
+	var exists bool
+	err := m.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM Categories WHERE id = ?)", catID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	if groupID != 0 {
+		err := m.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM UserGroup WHERE id = ?)", groupID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrGroupNotFound
+		}
+	}
+
+	_, err = m.DB.Exec(`
+		INSERT INTO CategoryPermission (cat_id, action, role, group_id)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, 0))`, catID, action, role, groupID)
+	return err
+}
+
+// DeleteRule supprime une règle d'accès.
+func (m *PermissionModel) DeleteRule(id int) error {
+	_, err := m.DB.Exec("DELETE FROM CategoryPermission WHERE id = ?", id)
+	return err
+}
+
+// Groups retourne les groupes et leurs membres.
+func (m *PermissionModel) Groups() ([]models.UserGroup, error) {
+	rows, err := m.DB.Query(`
+		SELECT g.id, g.name, u.id, u.username
+		FROM UserGroup g
+		LEFT JOIN UserGroupMember gm ON gm.group_id = g.id
+		LEFT JOIN Users u ON u.id = gm.user_id
+		ORDER BY g.name, u.username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.UserGroup
+	for rows.Next() {
+		var id int
+		var name string
+		var userID, username sql.NullString
+		if err := rows.Scan(&id, &name, &userID, &username); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].ID != id {
+			groups = append(groups, models.UserGroup{ID: id, Name: name})
+		}
+		if userID.Valid {
+			member := models.User{Username: username.String}
+			member.Id, _ = uuid.Parse(userID.String)
+			groups[len(groups)-1].Members = append(groups[len(groups)-1].Members, member)
+		}
+	}
+	return groups, rows.Err()
+}
+
+// CreateGroup crée un groupe d'utilisateurs.
+func (m *PermissionModel) CreateGroup(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, ErrInvalidPermission
+	}
+	res, err := m.DB.Exec("INSERT INTO UserGroup (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// DeleteGroup supprime un groupe, ses membres et les règles qui le concernent.
+func (m *PermissionModel) DeleteGroup(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"DELETE FROM CategoryPermission WHERE group_id = ?",
+		"DELETE FROM UserGroupMember WHERE group_id = ?",
+		"DELETE FROM UserGroup WHERE id = ?",
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddMember ajoute un utilisateur, désigné par son nom, à un groupe.
+func (m *PermissionModel) AddMember(groupID int, username string) error {
+	var userID string
+	err := m.DB.QueryRow("SELECT id FROM Users WHERE username = ?", strings.TrimSpace(username)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	res, err := m.DB.Exec(`
+		INSERT OR IGNORE INTO UserGroupMember (group_id, user_id)
+		SELECT id, ? FROM UserGroup WHERE id = ?`, userID, groupID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		var exists bool
+		if err := m.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM UserGroup WHERE id = ?)", groupID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrGroupNotFound
+		}
+	}
+	return nil
+}
+
+// RemoveMember retire un utilisateur d'un groupe.
+func (m *PermissionModel) RemoveMember(groupID int, userID string) error {
+	_, err := m.DB.Exec("DELETE FROM UserGroupMember WHERE group_id = ? AND user_id = ?", groupID, userID)
+	return err
+}
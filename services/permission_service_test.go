@@ -0,0 +1,100 @@
+package services
+
+import (
+	"forum/internal/testdb"
+	"testing"
+)
+
+// TestPermissionInheritance vérifie les règles d'accès d'un arbre de catégories : une catégorie n'est visible
+// que si tous ses ancêtres le sont, les règles de rôle valent pour les rôles supérieurs, les groupes
+// ouvrent l'accès à leurs membres et seuls les utilisateurs connectés écrivent.
+func TestPermissionInheritance(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.AddUser(t, db, "11111111-1111-1111-1111-111111111111", "user", "user")
+	member := testdb.AddUser(t, db, "22222222-2222-2222-2222-222222222222", "member", "user")
+	moderator := testdb.AddUser(t, db, "33333333-3333-3333-3333-333333333333", "moderator", "moderator")
+	admin := testdb.AddUser(t, db, "44444444-4444-4444-4444-444444444444", "admin", "admin")
+	perms := &PermissionModel{DB: db}
+	categories := &CategoryModel{DB: db, Permissions: perms}
+
+	create := func(name string, parentID int) int {
+		t.Helper()
+		id, err := categories.CreateCategory(name, "", "", "", parentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	team := create("Team", 0)
+	projects := create("Projects", team)
+	archive := create("Archive", projects)
+	club := create("Club", 0)
+
+	if err := perms.AddRule(team, ActionView, "moderator", 0); err != nil {
+		t.Fatal(err)
+	}
+	group, err := perms.CreateGroup("club")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := perms.AddMember(group, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if err := perms.AddRule(club, ActionView, "", group); err != nil {
+		t.Fatal(err)
+	}
+	// Un groupe sur une sous-catégorie ne suffit pas sans accès à ses ancêtres
+	if err := perms.AddRule(archive, ActionView, "", group); err != nil {
+		t.Fatal(err)
+	}
+	var announcements int
+	db.QueryRow(`SELECT id FROM Categories WHERE name = 'Announcements'`).Scan(&announcements)
+
+	tests := []struct {
+		name   string
+		userID string
+		catID  int
+		action string
+		want   bool
+	}{
+		{"user cannot see a moderator category", user, team, ActionView, false},
+		{"user cannot see its child", user, projects, ActionView, false},
+		{"user cannot post in its grandchild", user, archive, ActionPost, false},
+		{"moderator sees the child", moderator, projects, ActionView, true},
+		{"moderator comments in the child", moderator, projects, ActionComment, true},
+		{"group on a grandchild does not open hidden ancestors", member, archive, ActionView, false},
+		{"admin sees everything", admin, archive, ActionView, true},
+		{"group member sees the group category", member, club, ActionView, true},
+		{"group member posts in the group category", member, club, ActionPost, true},
+		{"non-member cannot see the group category", user, club, ActionView, false},
+		{"moderator outside the group cannot see it", moderator, club, ActionView, false},
+		{"everyone reads announcements", "", announcements, ActionView, true},
+		{"user cannot post announcements", user, announcements, ActionPost, false},
+		{"admin posts announcements", admin, announcements, ActionPost, true},
+		{"visitor cannot post in an open category", "", 1, ActionPost, false},
+		{"user posts in an open category", user, 1, ActionPost, true},
+	}
+	for _, test := range tests {
+		got, err := perms.Can(test.userID, test.catID, test.action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s: Can = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Un post est caché dès que l'une de ses catégories l'est
+	if _, err := db.Exec(`INSERT INTO Post (id, user_id, title, content) VALUES (1, ?, 't', 'c')`, moderator); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO Catpostrel (cat_id, post_id) VALUES (1, 1), (?, 1)`, projects); err != nil {
+		t.Fatal(err)
+	}
+	if err := perms.CheckPost(user, 1, ActionView); err != ErrForbidden {
+		t.Errorf("CheckPost in a hidden category = %v, want ErrForbidden", err)
+	}
+	if err := perms.CheckPost(moderator, 1, ActionView); err != nil {
+		t.Errorf("CheckPost for a moderator = %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"forum/models"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -13,17 +14,35 @@ import (
 )
 
 type PostModel struct {
-	DB        *sql.DB
-	LikeModel *LikeModel
+	DB          *sql.DB
+	Reactions   *ReactionModel
+	Permissions *PermissionModel
+	Mentions    *MentionModel // users mentioned in the content are notified; nil: no notifications
 }
 
 var ErrPostNotFound = errors.New("post not found")
 
-// Insert inserts a new post along with its categories into the database.
-func (m *PostModel) Insert(title, content, image string, categories []string, userId string) error {
+// CheckInsert returns the error Insert would return for these categories: only existing, non-archived
+// categories the user may post in can be attached to a post. Callers use it to refuse a post before storing its image.
+func (m *PostModel) CheckInsert(categoryIDs []int, userId string) error {
+	if err := m.checkCategories(categoryIDs); err != nil {
+		return err
+	}
+	if m.Permissions != nil {
+		return m.Permissions.CheckCategories(userId, categoryIDs, ActionPost)
+	}
+	return nil
+}
+
+// Insert inserts a new post along with its categories into the database and returns its ID.
+func (m *PostModel) Insert(title, content, image string, categoryIDs []int, userId string) (int, error) {
 	var stmt string
 	var res sql.Result
-	var err error
+
+	err := m.CheckInsert(categoryIDs, userId)
+	if err != nil {
+		return 0, err
+	}
 
 	// Insert the post into the Post table
 	if image == "" {
@@ -36,49 +55,47 @@ func (m *PostModel) Insert(title, content, image string, categories []string, us
 		res, err = m.DB.Exec(stmt, userId, title, content, image)
 	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Get the last inserted post ID
 	postID, err := res.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Insert categories into the Categories table if they don't exist
-	for _, catName := range categories {
-		var catID int
-		// Check if the category already exists
-		err = m.DB.QueryRow("SELECT id FROM Categories WHERE name = ?", catName).Scan(&catID)
+	// Link the post to its categories
+	for _, catID := range categoryIDs {
+		_, err = m.DB.Exec("INSERT OR IGNORE INTO Catpostrel (cat_id, post_id) VALUES (?, ?)", catID, postID)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				// Insert new category
-				res, err = m.DB.Exec("INSERT INTO Categories (name) VALUES (?)", catName)
-				if err != nil {
-					return err
-				}
-				catID64, err := res.LastInsertId()
-				if err != nil {
-					return err
-				}
-				catID = int(catID64)
-			} else {
-				return err
-			}
+			return 0, err
 		}
+	}
 
-		// Insert into Catpostrel table
-		_, err = m.DB.Exec("INSERT INTO Catpostrel (cat_id, post_id) VALUES (?, ?)", catID, postID)
-		if err != nil {
-			return err
-		}
+	// Notify the users mentioned in the content
+	if _, err := m.Mentions.Notify(userId, int(postID), 0, content); err != nil {
+		log.Printf("Failed to notify mentions in post %d: %v", postID, err)
 	}
 
-	return nil
+	return int(postID), nil
 }
 
-// All retrieves all posts along with their categories.
-func (m *PostModel) All(userId string) ([]models.Post, error) {
+// All retrieves all posts along with their categories, in the requested feed order.
+// The "following" feed is limited to the posts of the users userId follows.
+func (m *PostModel) All(userId string, sort models.FeedSort) ([]models.Post, error) {
+	// Posts in categories the user cannot see are left out
+	hidden, args, err := hiddenPostFilter(m.Permissions, userId, "p.id")
+	if err != nil {
+		return nil, err
+	}
+	where, orderBy, sortArgs := feedOrder(sort)
+	where = hidden + " AND p.archived = 0" + where
+	args = append(args, sortArgs...)
+	// The "following" feed only keeps posts from users the viewer follows
+	if sort.Feed == "following" {
+		where += " AND p.user_id IN (SELECT followed_id FROM Follow WHERE follower_id = ?)"
+		args = append(args, userId)
+	}
 	stmt := `SELECT 
                 p.id, 
                 p.title, 
@@ -88,20 +105,29 @@ func (m *PostModel) All(userId string) ([]models.Post, error) {
                 u.id AS user_id, 
                 u.username, 
                 u.picture,
-                GROUP_CONCAT(c.name, ',') AS categories
+                GROUP_CONCAT(c.name, ',') AS categories,
+                p.pinned, p.locked, p.archived
              FROM Post p
              JOIN users u ON p.user_id = u.id
              LEFT JOIN Catpostrel cp ON p.id = cp.post_id
              LEFT JOIN Categories c ON cp.cat_id = c.id
+             LEFT JOIN PostScore s ON s.post_id = p.id
+             WHERE 1 = 1` + where + `
              GROUP BY p.id
-             ORDER BY p.id DESC`
+             ORDER BY p.pinned DESC, ` + orderBy
 
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return m.scanFeedPosts(rows, userId)
+}
+
+// scanFeedPosts reads the rows of a feed query (post, author and concatenated categories)
+// and adds the like/dislike counts and the user's action to each post.
+func (m *PostModel) scanFeedPosts(rows *sql.Rows, userId string) ([]models.Post, error) {
 	posts := []models.Post{}
 	for rows.Next() {
 		var p models.Post
@@ -121,6 +147,9 @@ func (m *PostModel) All(userId string) ([]models.Post, error) {
 			&p.UserID.Username,
 			&userPicture,
 			&categoriesStr, // Scan the concatenated categories
+			&p.Pinned,
+			&p.Locked,
+			&p.Archived,
 		)
 		if err != nil {
 			return nil, err
@@ -155,28 +184,18 @@ func (m *PostModel) All(userId string) ([]models.Post, error) {
 			p.Category = []models.Category{}
 		}
 
-		// Use the injected LikeModel
-		likeCount, dislikeCount, err := m.LikeModel.CountLikesDislikes(p.ID)
-		if err != nil {
-			return nil, err
-		}
-		p.LikeCount = likeCount
-		p.DislikeCount = dislikeCount
-
-		if userId != "" {
-			userAction, err := m.LikeModel.VerifyAction(strconv.Itoa(p.ID), userId)
-			if err != nil {
-				return nil, err
-			}
-			p.UserAction = userAction
-		} else {
-			p.UserAction = ""
-		}
-
 		posts = append(posts, p)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Reactions of every post in a single query
+	if err := applyPostReactions(m.Reactions, posts, userId); err != nil {
+		return nil, err
+	}
+	if err := applyPostReputation(m.DB, posts); err != nil {
 		return nil, err
 	}
 
@@ -283,14 +302,20 @@ func (m *PostModel) AllPostByUser(userid string) ([]models.Post, error) {
 
 // AllPostByUserProfile retrieves all posts by a specific user profile along with their categories.
 func (m *PostModel) AllPostByUserProfile(userid string, currentUserID string, sessionuserdID string) ([]models.Post, error) {
+	// Posts in categories the visitor cannot see are left out
+	hidden, hiddenArgs, err := hiddenPostFilter(m.Permissions, sessionuserdID, "p.id")
+	if err != nil {
+		return nil, err
+	}
+
 	stmt := `SELECT p.id, p.title, p.content, p.image, p.created_at,
 	                u.id AS user_id, u.username, u.picture
 	         FROM Post p
 	         JOIN users u ON p.user_id = u.id
-	         WHERE p.user_id = ?
+	         WHERE p.user_id = ?` + hidden + `
 	         ORDER BY p.id DESC`
 
-	rows, err := m.DB.Query(stmt, userid)
+	rows, err := m.DB.Query(stmt, append([]interface{}{userid}, hiddenArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -343,24 +368,6 @@ func (m *PostModel) AllPostByUserProfile(userid string, currentUserID string, se
 			return nil, err
 		}
 
-		// Use the LikeModel to get likes and dislikes
-		likeCount, dislikeCount, err := m.LikeModel.CountLikesDislikes(p.ID)
-		if err != nil {
-			return nil, err
-		}
-		p.LikeCount = likeCount
-		p.DislikeCount = dislikeCount
-
-		if sessionuserdID != "" {
-			userAction, err := m.LikeModel.VerifyAction(strconv.Itoa(p.ID), sessionuserdID)
-			if err != nil {
-				return nil, err
-			}
-			p.UserAction = userAction
-		} else {
-			p.UserAction = ""
-		}
-
 		posts = append(posts, p)
 	}
 
@@ -368,6 +375,14 @@ func (m *PostModel) AllPostByUserProfile(userid string, currentUserID string, se
 		return nil, err
 	}
 
+	// Reactions of every post in a single query
+	if err := applyPostReactions(m.Reactions, posts, sessionuserdID); err != nil {
+		return nil, err
+	}
+	if err := applyPostReputation(m.DB, posts); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -375,7 +390,8 @@ func (m *PostModel) AllPostByUserProfile(userid string, currentUserID string, se
 func (pm *PostModel) Get(id string) (*models.Post, error) {
 	post := &models.Post{}
 	query := `SELECT p.id, p.title, p.content, p.image, p.created_at,
-	                 u.id, u.username, u.picture
+	                 u.id, u.username, u.picture,
+	                 p.pinned, p.locked, p.archived
 	          FROM Post p
 	          JOIN Users u ON p.user_id = u.id
 	          WHERE p.id = ?`
@@ -393,6 +409,9 @@ func (pm *PostModel) Get(id string) (*models.Post, error) {
 		&userIdStr,
 		&post.UserID.Username,
 		&post.UserID.Picture,
+		&post.Pinned,
+		&post.Locked,
+		&post.Archived,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -422,51 +441,52 @@ func (pm *PostModel) Get(id string) (*models.Post, error) {
 	return post, nil
 }
 
-// GetPostUser retrieves a single post by ID along with user action and categories.
+// GetPostUser retrieves a single post by ID along with its reactions, the user's own reaction and the author's reputation.
 func (pm *PostModel) GetPostUser(postId string, userId string) (*models.Post, error) {
-	post := &models.Post{}
-	likeModel := &LikeModel{DB: pm.DB}
-	if userId != "" {
-		userAction, err := likeModel.VerifyAction(postId, userId)
-		if err != nil {
-			return nil, fmt.Errorf("error getting user action on post: %v", err)
-		}
-		post.UserAction = userAction
-	} else {
-		post.UserAction = "none"
-	}
-
 	post, err := pm.Get(postId)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get likes and dislikes
-	likeCount, dislikeCount, err := pm.LikeModel.CountLikesDislikes(post.ID)
+	summary, err := pm.Reactions.Summary(TargetPost, post.ID, userId)
 	if err != nil {
 		return nil, err
 	}
-	post.LikeCount = likeCount
-	post.DislikeCount = dislikeCount
+	setPostReactions(post, summary)
 
-	// Determine user action on this post
-	if userId != "" {
-		userAction, err := pm.LikeModel.VerifyAction(strconv.Itoa(post.ID), userId)
-		if err != nil {
-			return nil, err
-		}
-		post.UserAction = userAction
-	} else {
-		post.UserAction = ""
+	scores, err := reputations(pm.DB, []string{post.UserID.Id.String()})
+	if err != nil {
+		return nil, err
 	}
+	post.UserID.Reputation = scores[post.UserID.Id.String()]
 
 	return post, nil
 }
 
-// Update updates a post's title, content, image, and categories.
-func (pm *PostModel) Update(id string, title string, content string, image string, categories []string) error {
+// CheckUpdate returns the error Update would return: archived threads are read-only, and the new
+// categories follow the same rules as for a new post.
+func (pm *PostModel) CheckUpdate(id string, categoryIDs []int, userId string) error {
+	var archived bool
+	err := pm.DB.QueryRow("SELECT archived FROM Post WHERE id = ?", id).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	} else if err != nil {
+		return err
+	}
+	if archived {
+		return ErrPostArchived
+	}
+	return pm.CheckInsert(categoryIDs, userId)
+}
+
+// Update updates a post's title, content, image, and categories on behalf of userId.
+func (pm *PostModel) Update(id string, title string, content string, image string, categoryIDs []int, userId string) error {
 	fmt.Println("Updating Post with id: ", id)
-	var err error
+
+	err := pm.CheckUpdate(id, categoryIDs, userId)
+	if err != nil {
+		return err
+	}
 
 	// Update the Post table
 	if image == "" {
@@ -485,34 +505,47 @@ func (pm *PostModel) Update(id string, title string, content string, image strin
 	}
 
 	// Re-insert categories
-	for _, catName := range categories {
-		var catID int
-		// Check if the category exists
-		err = pm.DB.QueryRow("SELECT id FROM Categories WHERE name = ?", catName).Scan(&catID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				// Insert new category
-				res, err := pm.DB.Exec("INSERT INTO Categories (name) VALUES (?)", catName)
-				if err != nil {
-					return err
-				}
-				catID64, err := res.LastInsertId()
-				if err != nil {
-					return err
-				}
-				catID = int(catID64)
-			} else {
-				return err
-			}
-		}
-
-		// Insert into Catpostrel table
-		_, err = pm.DB.Exec("INSERT INTO Catpostrel (cat_id, post_id) VALUES (?, ?)", catID, id)
+	for _, catID := range categoryIDs {
+		_, err = pm.DB.Exec("INSERT OR IGNORE INTO Catpostrel (cat_id, post_id) VALUES (?, ?)", catID, id)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Notify the users newly mentioned in the content; those already notified for this post are skipped
+	postID, _ := strconv.Atoi(id)
+	if _, err := pm.Mentions.Notify(userId, postID, 0, content); err != nil {
+		log.Printf("Failed to notify mentions in post %s: %v", id, err)
+	}
+
+	return nil
+}
+
+// checkCategories returns ErrUnknownCategory if one of the IDs does not match an active category.
+func (pm *PostModel) checkCategories(categoryIDs []int) error {
+	unique := map[int]bool{}
+	for _, id := range categoryIDs {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return ErrUnknownCategory
+	}
+
+	placeholders := make([]string, 0, len(unique))
+	args := make([]interface{}, 0, len(unique))
+	for id := range unique {
+		placeholders = append(placeholders, "?")
+		args = append(args, id)
+	}
+
+	var count int
+	stmt := "SELECT COUNT(*) FROM Categories WHERE archived = 0 AND id IN (" + strings.Join(placeholders, ", ") + ")"
+	if err := pm.DB.QueryRow(stmt, args...).Scan(&count); err != nil {
+		return err
+	}
+	if count != len(unique) {
+		return ErrUnknownCategory
+	}
 	return nil
 }
 
@@ -524,6 +557,31 @@ func (pm *PostModel) Delete(id string) error {
 		return err
 	}
 
+	_, err = pm.DB.Exec("DELETE FROM PostScore WHERE post_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = pm.DB.Exec("DELETE FROM Reaction WHERE target_type = 'post' AND target_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = pm.DB.Exec("DELETE FROM ReputationLedger WHERE target_type = 'post' AND target_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = pm.DB.Exec("DELETE FROM Watch WHERE target_type = 'post' AND target_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = pm.DB.Exec("DELETE FROM Mention WHERE source_type = 'post' AND source_id = ?", id)
+	if err != nil {
+		return err
+	}
+
 	// Delete from Post table
 	_, err = pm.DB.Exec("DELETE FROM Post WHERE id = ?", id)
 	return err
@@ -540,8 +598,13 @@ func (pm *PostModel) GetUserPost(postId string) string {
 	return id
 }
 
-// GetLikedPost retrieves all posts that a user has liked.
+// GetLikedPost retrieves all posts that a user has liked and can still see.
 func (m *PostModel) GetLikedPost(userId string) ([]models.Post, error) {
+	hidden, hiddenArgs, err := hiddenPostFilter(m.Permissions, userId, "p.id")
+	if err != nil {
+		return nil, err
+	}
+
 	stmt := `SELECT 
 				p.id, 
 				p.title, 
@@ -555,7 +618,7 @@ func (m *PostModel) GetLikedPost(userId string) ([]models.Post, error) {
 			FROM 
 				Post p
 			JOIN 
-				LikeDislikePost l ON p.id = l.post_id
+				Reaction l ON l.target_type = 'post' AND l.target_id = p.id
 			JOIN 
 				users u ON p.user_id = u.id
 			LEFT JOIN 
@@ -563,13 +626,13 @@ func (m *PostModel) GetLikedPost(userId string) ([]models.Post, error) {
 			LEFT JOIN 
 				Categories c ON cp.cat_id = c.id
 			WHERE 
-				l.user_id = ? AND l.like = 1
+				l.user_id = ? AND l.reaction = 'like'` + hidden + `
 			GROUP BY 
 				p.id
 			ORDER BY 
 				p.id DESC`
 
-	rows, err := m.DB.Query(stmt, userId)
+	rows, err := m.DB.Query(stmt, append([]interface{}{userId}, hiddenArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -627,19 +690,6 @@ func (m *PostModel) GetLikedPost(userId string) ([]models.Post, error) {
 			p.Category = []models.Category{}
 		}
 
-		likeCount, dislikeCount, err := m.LikeModel.CountLikesDislikes(p.ID)
-		if err != nil {
-			return nil, err
-		}
-		p.LikeCount = likeCount
-		p.DislikeCount = dislikeCount
-
-		userAction, err := m.LikeModel.VerifyAction(strconv.Itoa(p.ID), userId)
-		if err != nil {
-			return nil, err
-		}
-		p.UserAction = userAction
-
 		posts = append(posts, p)
 	}
 
@@ -647,6 +697,14 @@ func (m *PostModel) GetLikedPost(userId string) ([]models.Post, error) {
 		return nil, err
 	}
 
+	// Reactions of every post in a single query
+	if err := applyPostReactions(m.Reactions, posts, userId); err != nil {
+		return nil, err
+	}
+	if err := applyPostReputation(m.DB, posts); err != nil {
+		return nil, err
+	}
+
 	return posts, nil
 }
 
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/models"
+	"log"
+	"strings"
+)
+
+// Types de cibles d'une réaction
+const (
+	TargetPost    = "post"
+	TargetComment = "comment"
+)
+
+var (
+	ErrInvalidReaction = errors.New("invalid reaction")
+	ErrInvalidTarget   = errors.New("invalid reaction target")
+)
+
+// DefaultReactions sont les réactions proposées quand la configuration n'en fournit pas.
+var DefaultReactions = []models.ReactionKind{
+	{Name: "like", Emoji: "👍"},
+	{Name: "dislike", Emoji: "👎"},
+	{Name: "love", Emoji: "❤️"},
+	{Name: "laugh", Emoji: "😂"},
+	{Name: "wow", Emoji: "😮"},
+	{Name: "sad", Emoji: "😢"},
+}
+
+// ReactionModel gère les réactions des utilisateurs sur les posts et les commentaires.
+// Un utilisateur a au plus une réaction par cible.
+type ReactionModel struct {
+	DB    *sql.DB
+	Kinds []models.ReactionKind // réactions proposées ; DefaultReactions si vide
+	Live  *LiveHub              // visiteurs du post prévenus des nouveaux compteurs ; nil : pas de diffusion
+}
+
+// Available retourne les réactions proposées. Like et dislike sont toujours présents,
+// en tête, pour rester compatibles avec les boutons existants.
+func (m *ReactionModel) Available() []models.ReactionKind {
+	if len(m.Kinds) == 0 {
+		return DefaultReactions
+	}
+
+	kinds := make([]models.ReactionKind, 0, len(m.Kinds)+2)
+	for _, base := range DefaultReactions[:2] {
+		if !containsReaction(m.Kinds, base.Name) {
+			kinds = append(kinds, base)
+		}
+	}
+	return append(kinds, m.Kinds...)
+}
+
+// IsValid indique si name est une réaction proposée.
+func (m *ReactionModel) IsValid(name string) bool {
+	return containsReaction(m.Available(), name)
+}
+
+func containsReaction(kinds []models.ReactionKind, name string) bool {
+	for _, k := range kinds {
+		if k.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTarget(targetType string) error {
+	if targetType != TargetPost && targetType != TargetComment {
+		return ErrInvalidTarget
+	}
+	return nil
+}
+
+// Set enregistre la réaction d'un utilisateur sur une cible ; "" ou "none" retire sa réaction.
+func (m *ReactionModel) Set(targetType string, targetID int, userID, reaction string) error {
+	if err := checkTarget(targetType); err != nil {
+		return err
+	}
+
+	if reaction == "" || reaction == "none" {
+		_, err := m.DB.Exec(`DELETE FROM Reaction WHERE target_type = ? AND target_id = ? AND user_id = ?`,
+			targetType, targetID, userID)
+		if err != nil {
+			return err
+		}
+		m.publish(targetType, targetID)
+		return nil
+	}
+	if !m.IsValid(reaction) {
+		return ErrInvalidReaction
+	}
+
+	_, err := m.DB.Exec(`
+		INSERT INTO Reaction (user_id, target_type, target_id, reaction)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, target_type, target_id)
+		DO UPDATE SET reaction = excluded.reaction, created_at = CURRENT_TIMESTAMP`,
+		userID, targetType, targetID, reaction)
+	if err != nil {
+		return err
+	}
+	m.publish(targetType, targetID)
+	return nil
+}
+
+// publish envoie les nouveaux compteurs d'une cible aux visiteurs de son post.
+// Une erreur est seulement journalisée : la réaction est enregistrée.
+func (m *ReactionModel) publish(targetType string, targetID int) {
+	if m.Live == nil {
+		return
+	}
+	postID := targetID
+	if targetType == TargetComment {
+		if err := m.DB.QueryRow(`SELECT post_id FROM Comment WHERE id = ?`, targetID).Scan(&postID); err != nil {
+			log.Printf("Erreur lors de la diffusion des réactions du commentaire %d: %v", targetID, err)
+			return
+		}
+	}
+	if !m.Live.Watched(postID) {
+		return
+	}
+
+	summary, err := m.Summary(targetType, targetID, "")
+	if err != nil {
+		log.Printf("Erreur lors de la diffusion des réactions (%s %d): %v", targetType, targetID, err)
+		return
+	}
+	m.Live.Publish(postID, models.LiveEvent{Type: models.LiveVotes, Target: targetType, ID: targetID, Counts: summary.Counts})
+}
+
+// Toggle applique une réaction comme un bouton : la même réaction une seconde fois la retire.
+// Retourne la réaction de l'utilisateur avant et après l'opération ("" s'il n'en a pas).
+func (m *ReactionModel) Toggle(targetType string, targetID int, userID, reaction string) (previous string, current string, err error) {
+	previous, err = m.Mine(targetType, targetID, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if reaction == previous {
+		reaction = ""
+	}
+	if err := m.Set(targetType, targetID, userID, reaction); err != nil {
+		return "", "", err
+	}
+	if reaction == "none" {
+		reaction = ""
+	}
+	return previous, reaction, nil
+}
+
+// Mine retourne la réaction d'un utilisateur sur une cible, ou "" s'il n'a pas réagi.
+func (m *ReactionModel) Mine(targetType string, targetID int, userID string) (string, error) {
+	if userID == "" {
+		return "", nil
+	}
+
+	var reaction string
+	err := m.DB.QueryRow(`SELECT reaction FROM Reaction WHERE target_type = ? AND target_id = ? AND user_id = ?`,
+		targetType, targetID, userID).Scan(&reaction)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return reaction, err
+}
+
+// Summary retourne les compteurs par réaction d'une cible et la réaction de viewerID.
+func (m *ReactionModel) Summary(targetType string, targetID int, viewerID string) (models.ReactionSummary, error) {
+	summaries, err := m.Summaries(targetType, []int{targetID}, viewerID)
+	if err != nil {
+		return models.ReactionSummary{}, err
+	}
+	return summaries[targetID], nil
+}
+
+// Summaries retourne en une seule requête les compteurs par réaction et la réaction de viewerID
+// pour plusieurs cibles du même type. Chaque cible demandée est présente dans le résultat.
+func (m *ReactionModel) Summaries(targetType string, targetIDs []int, viewerID string) (map[int]models.ReactionSummary, error) {
+	if err := checkTarget(targetType); err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[int]models.ReactionSummary, len(targetIDs))
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	args := []interface{}{viewerID, targetType}
+	for _, id := range targetIDs {
+		summaries[id] = models.ReactionSummary{Counts: map[string]int{}}
+		args = append(args, id)
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT target_id, reaction, COUNT(*), MAX(user_id = ?)
+		FROM Reaction
+		WHERE target_type = ? AND target_id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(targetIDs)), ",")+`)
+		GROUP BY target_id, reaction`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var reaction string
+		var mine bool
+		if err := rows.Scan(&id, &reaction, &count, &mine); err != nil {
+			return nil, err
+		}
+		summary := summaries[id]
+		summary.Counts[reaction] = count
+		if mine {
+			summary.Mine = reaction
+		}
+		summaries[id] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// applyPostReactions renseigne les réactions, les compteurs like/dislike et l'action de viewerID
+// sur une liste de posts.
+func applyPostReactions(reactions *ReactionModel, posts []models.Post, viewerID string) error {
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	summaries, err := reactions.Summaries(TargetPost, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		setPostReactions(&posts[i], summaries[posts[i].ID])
+	}
+	return nil
+}
+
+// setPostReactions copie un résumé de réactions dans un post, compteurs like/dislike compris.
+func setPostReactions(p *models.Post, summary models.ReactionSummary) {
+	p.Reactions = summary
+	p.LikeCount = summary.Counts["like"]
+	p.DislikeCount = summary.Counts["dislike"]
+	p.UserAction = summary.Mine
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"database/sql"
+	"forum/models"
+	"strings"
+)
+
+// Privilèges débloqués par la réputation
+const (
+	PrivilegePostImages = "post_images" // joindre une image à un post
+)
+
+// DefaultReputationRules retourne les règles utilisées pour ce que config.json ne précise pas.
+func DefaultReputationRules() models.ReputationRules {
+	return models.ReputationRules{
+		PostLike:       10,
+		PostDislike:    -2,
+		CommentLike:    5,
+		CommentDislike: -1,
+		DailyCap:       200,
+		Privileges: map[string]int{
+			PrivilegePostImages: 0, // ouvert à tous, comme avant la réputation ; à relever dans config.json
+		},
+	}
+}
+
+// ReputationModel tient le journal de réputation : les likes et dislikes reçus rapportent
+// ou retirent des points à l'auteur du contenu, dans la limite d'un plafond quotidien de gains.
+type ReputationModel struct {
+	DB    *sql.DB
+	Rules models.ReputationRules
+}
+
+// weight retourne les points prévus pour une réaction sur un type de cible (0 pour un emoji).
+func (m *ReputationModel) weight(targetType, reaction string) int {
+	switch {
+	case targetType == TargetPost && reaction == "like":
+		return m.Rules.PostLike
+	case targetType == TargetPost && reaction == "dislike":
+		return m.Rules.PostDislike
+	case targetType == TargetComment && reaction == "like":
+		return m.Rules.CommentLike
+	case targetType == TargetComment && reaction == "dislike":
+		return m.Rules.CommentDislike
+	}
+	return 0
+}
+
+// capped réduit un gain au reste du plafond quotidien, sachant que gained points ont déjà été gagnés ce jour-là.
+func (m *ReputationModel) capped(weight, gained int) int {
+	if weight <= 0 || m.Rules.DailyCap <= 0 {
+		return weight
+	}
+	if rest := m.Rules.DailyCap - gained; rest < weight {
+		return max(rest, 0)
+	}
+	return weight
+}
+
+// Record met le journal à jour après un vote de voterID sur une cible, d'après sa réaction actuelle.
+// Les votes sur son propre contenu et les réactions emoji ne comptent pas.
+func (m *ReputationModel) Record(targetType string, targetID int, voterID string) error {
+	if err := checkTarget(targetType); err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM ReputationLedger WHERE voter_id = ? AND target_type = ? AND target_id = ?`,
+		voterID, targetType, targetID)
+	if err != nil {
+		return err
+	}
+
+	var ownerID, reaction string
+	err = tx.QueryRow(`
+		SELECT t.user_id, r.reaction
+		FROM Reaction r
+		JOIN `+targetTable(targetType)+` t ON t.id = r.target_id
+		WHERE r.user_id = ? AND r.target_type = ? AND r.target_id = ?`,
+		voterID, targetType, targetID).Scan(&ownerID, &reaction)
+	if err == sql.ErrNoRows {
+		return tx.Commit()
+	} else if err != nil {
+		return err
+	}
+
+	weight := m.weight(targetType, reaction)
+	if weight == 0 || ownerID == voterID {
+		return tx.Commit()
+	}
+
+	var gained int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(points), 0) FROM ReputationLedger
+		WHERE user_id = ? AND points > 0 AND date(created_at) = date('now')`, ownerID).Scan(&gained)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ReputationLedger (user_id, voter_id, target_type, target_id, reaction, weight, points)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		ownerID, voterID, targetType, targetID, reaction, weight, m.capped(weight, gained))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Recompute reconstruit tout le journal à partir des réactions, dans l'ordre chronologique,
+// avec les poids et le plafond actuels (après un changement de configuration par exemple).
+func (m *ReputationModel) Recompute() error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM ReputationLedger`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT r.user_id, r.target_type, r.target_id, r.reaction, r.created_at, date(r.created_at),
+		       COALESCE(p.user_id, c.user_id)
+		FROM Reaction r
+		LEFT JOIN Post p ON r.target_type = 'post' AND p.id = r.target_id
+		LEFT JOIN Comment c ON r.target_type = 'comment' AND c.id = r.target_id
+		WHERE r.reaction IN ('like', 'dislike') AND COALESCE(p.user_id, c.user_id) IS NOT NULL
+		ORDER BY r.created_at, r.id`)
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		voterID, targetType, reaction, createdAt, ownerID string
+		targetID, weight, points                          int
+	}
+	var entries []entry
+	gained := make(map[string]int) // points gagnés par utilisateur et par jour
+	for rows.Next() {
+		var e entry
+		var day string
+		if err := rows.Scan(&e.voterID, &e.targetType, &e.targetID, &e.reaction, &e.createdAt, &day, &e.ownerID); err != nil {
+			rows.Close()
+			return err
+		}
+		e.weight = m.weight(e.targetType, e.reaction)
+		if e.weight == 0 || e.ownerID == e.voterID {
+			continue
+		}
+
+		key := e.ownerID + "/" + day
+		e.points = m.capped(e.weight, gained[key])
+		if e.points > 0 {
+			gained[key] += e.points
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		_, err := tx.Exec(`
+			INSERT INTO ReputationLedger (user_id, voter_id, target_type, target_id, reaction, weight, points, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.ownerID, e.voterID, e.targetType, e.targetID, e.reaction, e.weight, e.points, e.createdAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Backfill reconstruit le journal s'il est vide alors que des likes ou dislikes ont déjà été donnés :
+// c'est le cas au premier démarrage après la migration qui le crée, les votes plus anciens n'y étant pas.
+func (m *ReputationModel) Backfill() error {
+	var missing bool
+	err := m.DB.QueryRow(`
+		SELECT NOT EXISTS (SELECT 1 FROM ReputationLedger)
+		   AND EXISTS (SELECT 1 FROM Reaction WHERE reaction IN ('like', 'dislike'))`).Scan(&missing)
+	if err != nil || !missing {
+		return err
+	}
+	return m.Recompute()
+}
+
+// Get retourne la réputation d'un utilisateur.
+func (m *ReputationModel) Get(userID string) (int, error) {
+	var score int
+	err := m.DB.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM ReputationLedger WHERE user_id = ?`, userID).Scan(&score)
+	return score, err
+}
+
+// Has indique si l'utilisateur a la réputation requise pour un privilège.
+// Les modérateurs et les administrateurs ont tous les privilèges, et un privilège sans seuil est ouvert à tous.
+func (m *ReputationModel) Has(userID, privilege string) (bool, error) {
+	threshold, ok := m.Rules.Privileges[privilege]
+	if !ok || threshold <= 0 {
+		return true, nil
+	}
+
+	var role sql.NullString
+	err := m.DB.QueryRow(`SELECT role FROM Users WHERE id = ?`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if role.String == "admin" || role.String == "moderator" {
+		return true, nil
+	}
+
+	score, err := m.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	return score >= threshold, nil
+}
+
+// Threshold retourne la réputation requise pour un privilège (0 s'il est ouvert à tous).
+func (m *ReputationModel) Threshold(privilege string) int {
+	return max(m.Rules.Privileges[privilege], 0)
+}
+
+// targetTable retourne la table qui contient les cibles d'un type donné.
+func targetTable(targetType string) string {
+	if targetType == TargetComment {
+		return "Comment"
+	}
+	return "Post"
+}
+
+// reputations retourne la réputation de chaque utilisateur de userIDs.
+func reputations(db *sql.DB, userIDs []string) (map[string]int, error) {
+	scores := make(map[string]int, len(userIDs))
+	if len(userIDs) == 0 {
+		return scores, nil
+	}
+
+	seen := make(map[string]bool, len(userIDs))
+	var args []interface{}
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	rows, err := db.Query(`
+		SELECT user_id, SUM(points) FROM ReputationLedger
+		WHERE user_id IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+		GROUP BY user_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var score int
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, err
+		}
+		scores[id] = score
+	}
+	return scores, rows.Err()
+}
+
+// applyPostReputation renseigne la réputation des auteurs d'une liste de posts.
+func applyPostReputation(db *sql.DB, posts []models.Post) error {
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = p.UserID.Id.String()
+	}
+	scores, err := reputations(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].UserID.Reputation = scores[posts[i].UserID.Id.String()]
+	}
+	return nil
+}
+
+// applyCommentReputation renseigne la réputation des auteurs d'une liste de commentaires.
+func applyCommentReputation(db *sql.DB, comments []models.Comment) error {
+	ids := make([]string, len(comments))
+	for i, c := range comments {
+		ids[i] = c.UserID.Id.String()
+	}
+	scores, err := reputations(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].UserID.Reputation = scores[comments[i].UserID.Id.String()]
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"database/sql"
+	"forum/internal/testdb"
+	"testing"
+)
+
+const (
+	testAuthor = "11111111-1111-1111-1111-111111111111"
+	testVoter  = "22222222-2222-2222-2222-222222222222"
+	testOther  = "33333333-3333-3333-3333-333333333333"
+)
+
+// reputationDB prépare un auteur, deux votants et un post de l'auteur (id 1).
+func reputationDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := testdb.Open(t)
+	testdb.AddUser(t, db, testAuthor, "author", "user")
+	testdb.AddUser(t, db, testVoter, "voter", "user")
+	testdb.AddUser(t, db, testOther, "other", "user")
+	if _, err := db.Exec(`INSERT INTO Post (id, user_id, title, content) VALUES (1, ?, 't', 'c')`, testAuthor); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func reputationOf(t *testing.T, m *ReputationModel, userID string) int {
+	t.Helper()
+	score, err := m.Get(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return score
+}
+
+// TestReputationBackfill vérifie que les votes donnés avant le journal y sont reportés une seule fois,
+// sans les votes sur son propre contenu ni les emoji.
+func TestReputationBackfill(t *testing.T) {
+	db := reputationDB(t)
+	for _, vote := range []struct{ user, reaction string }{
+		{testVoter, "like"}, {testOther, "dislike"}, {testAuthor, "like"},
+	} {
+		if _, err := db.Exec(`INSERT INTO Reaction (user_id, target_type, target_id, reaction) VALUES (?, 'post', 1, ?)`,
+			vote.user, vote.reaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &ReputationModel{DB: db, Rules: DefaultReputationRules()}
+
+	if err := m.Backfill(); err != nil {
+		t.Fatal(err)
+	}
+	want := m.Rules.PostLike + m.Rules.PostDislike
+	if got := reputationOf(t, m, testAuthor); got != want {
+		t.Fatalf("reputation after backfill = %d, want %d", got, want)
+	}
+
+	// Le journal n'est plus vide : un nouveau démarrage n'y touche pas
+	if _, err := db.Exec(`UPDATE ReputationLedger SET points = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Backfill(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reputationOf(t, m, testAuthor); got != 2 {
+		t.Fatalf("second backfill rebuilt the ledger: reputation = %d", got)
+	}
+}
+
+// TestReputationDailyCap vérifie que les gains d'une journée s'arrêtent au plafond, que les pertes
+// ne sont pas plafonnées et ne rouvrent pas de marge, et que Recompute retrouve les mêmes points.
+func TestReputationDailyCap(t *testing.T) {
+	db := reputationDB(t)
+	if _, err := db.Exec(`INSERT INTO Post (id, user_id, title, content) VALUES (2, ?, 't', 'c'), (3, ?, 't', 'c'), (4, ?, 't', 'c')`,
+		testAuthor, testAuthor, testAuthor); err != nil {
+		t.Fatal(err)
+	}
+	rules := DefaultReputationRules()
+	rules.DailyCap = 25
+	m := &ReputationModel{DB: db, Rules: rules}
+
+	vote := func(voterID string, postID int, reaction string) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO Reaction (user_id, target_type, target_id, reaction) VALUES (?, 'post', ?, ?)`,
+			voterID, postID, reaction); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Record("post", postID, voterID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Les gains d'hier ne comptent pas dans le plafond du jour
+	if _, err := db.Exec(`
+		INSERT INTO ReputationLedger (user_id, voter_id, target_type, target_id, reaction, weight, points, created_at)
+		VALUES (?, ?, 'comment', 99, 'like', 25, 25, datetime('now', '-1 day'))`, testAuthor, testOther); err != nil {
+		t.Fatal(err)
+	}
+
+	vote(testVoter, 1, "like")    // 10
+	vote(testVoter, 2, "like")    // 10
+	vote(testVoter, 3, "like")    // 5, le reste du plafond
+	vote(testOther, 1, "dislike") // -2, non plafonné
+	vote(testOther, 4, "like")    // 0, le plafond est atteint malgré le dislike
+
+	want := 25 + 25 + rules.PostDislike
+	if got := reputationOf(t, m, testAuthor); got != want {
+		t.Fatalf("reputation = %d, want %d", got, want)
+	}
+	var points int
+	if err := db.QueryRow(`SELECT points FROM ReputationLedger WHERE voter_id = ? AND target_id = 3`, testVoter).Scan(&points); err != nil {
+		t.Fatal(err)
+	}
+	if points != 5 {
+		t.Fatalf("like reaching the cap counted %d points, want 5", points)
+	}
+
+	// Recompute rejoue les votes du jour avec le même plafond (la ligne d'hier n'a pas de réaction)
+	if err := m.Recompute(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reputationOf(t, m, testAuthor); got != 25+rules.PostDislike {
+		t.Fatalf("reputation after Recompute = %d, want %d", got, 25+rules.PostDislike)
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Storage range les fichiers dans un bucket d'un service compatible S3 (AWS S3, MinIO, Garage...),
+// partagé par toutes les instances du forum. Les requêtes sont signées en AWS Signature Version 4.
+type S3Storage struct {
+	Endpoint  string // adresse du service, par exemple http://localhost:9000
+	Region    string // vide : us-east-1
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool         // bucket dans le chemin (http://hôte/bucket/clé, MinIO) plutôt que dans le nom d'hôte
+	Client    *http.Client // nil : http.DefaultClient
+}
+
+// s3MaxPresign est la durée de validité maximale d'un lien signé S3 (7 jours).
+const s3MaxPresign = 7 * 24 * time.Hour
+
+// unsignedPayload remplace l'empreinte du contenu dans les liens signés, qui n'en ont pas.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Put envoie data sous key.
+func (s *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get lit le fichier key.
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		var failure *s3Error
+		if errors.As(err, &failure) && failure.notFound() {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	info := ObjectInfo{Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if info.ContentType == "" {
+		info.ContentType = contentTypeOf(key)
+	}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, info, nil
+}
+
+// Delete supprime le fichier key ; S3 ne signale pas les fichiers absents.
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		var failure *s3Error
+		if errors.As(err, &failure) && failure.notFound() {
+			return nil
+		}
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SignedURL retourne un lien présigné qui permet de lire key directement auprès du service.
+func (s *S3Storage) SignedURL(key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	expires = min(max(expires, time.Second), s3MaxPresign)
+
+	target, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	target.RawQuery = canonicalQuery(query)
+	signature := s.signature(http.MethodGet, target, nil, []string{"host"}, unsignedPayload, now)
+	target.RawQuery += "&X-Amz-Signature=" + signature
+	return target.String(), nil
+}
+
+// objectURL retourne l'adresse du fichier key, selon que le bucket est dans le chemin ou le nom d'hôte.
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", s.Endpoint)
+	}
+	target := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	prefix := strings.TrimSuffix(endpoint.Path, "/")
+	if s.PathStyle {
+		prefix += "/" + s.Bucket
+	} else {
+		target.Host = s.Bucket + "." + endpoint.Host
+	}
+	target.Path = prefix + "/" + key
+	target.RawPath = uriEncode(target.Path, false)
+	return target, nil
+}
+
+// request prépare une requête signée sur le fichier key, avec body comme contenu.
+func (s *S3Storage) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	signature := s.signature(method, target, req.Header, signed, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.scope(now), strings.Join(signed, ";"), signature))
+	return req, nil
+}
+
+// s3Error est une réponse d'erreur du service : <Error><Code>NoSuchKey</Code><Message>...</Message></Error>.
+type s3Error struct {
+	Status  string `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+	status  int
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return "storage service replied " + e.Status
+	}
+	return fmt.Sprintf("storage service replied %s: %s: %s", e.Status, e.Code, e.Message)
+}
+
+// notFound indique si le fichier demandé n'existe pas ; un bucket absent est une erreur de configuration.
+func (e *s3Error) notFound() bool {
+	return e.status == http.StatusNotFound && (e.Code == "" || e.Code == "NoSuchKey")
+}
+
+// do envoie req et retourne une *s3Error si le service ne l'accepte pas.
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	failure := &s3Error{Status: resp.Status, status: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(body, failure) != nil {
+		failure.Code, failure.Message = "", ""
+	}
+	return nil, failure
+}
+
+// region retourne la région du service ; MinIO et la plupart des services compatibles acceptent us-east-1.
+func (s *S3Storage) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+// scope est la portée des clés de signature : date, région et service.
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region() + "/s3/aws4_request"
+}
+
+// signature calcule la signature Version 4 d'une requête : requête canonique, chaîne à signer,
+// puis HMAC avec la clé dérivée de SecretKey pour la date, la région et le service.
+func (s *S3Storage) signature(method string, target *url.URL, header http.Header, signed []string, payloadHash string, now time.Time) string {
+	var headers strings.Builder
+	for _, name := range signed {
+		value := header.Get(name)
+		if name == "host" {
+			value = target.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonical := strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		target.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + s.scope(now) + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encode les paramètres triés par nom, comme l'attend la signature Version 4.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// uriEncode encode s selon la RFC 3986 : seuls les lettres, chiffres et "-_.~" restent tels quels,
+// ainsi que "/" si encodeSlash est faux (chemins).
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/models"
+	"log"
+	"math"
+	"time"
+)
+
+// ScoreModel maintient la table PostScore utilisée pour trier les fils
+type ScoreModel struct {
+	DB *sql.DB
+}
+
+// Origine des temps du score "hot" ; seule la différence entre deux posts compte
+var hotEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type postCounts struct {
+	postID    int
+	createdAt time.Time
+	likes     int
+	dislikes  int
+	comments  int
+}
+
+// Refresh recalcule le score de tous les posts.
+func (s *ScoreModel) Refresh() error {
+	counts, err := s.loadCounts(0)
+	if err != nil {
+		return err
+	}
+	if err := s.save(counts); err != nil {
+		return err
+	}
+
+	// Supprimer les scores des posts qui n'existent plus
+	_, err = s.DB.Exec("DELETE FROM PostScore WHERE post_id NOT IN (SELECT id FROM Post)")
+	return err
+}
+
+// RefreshPost recalcule le score d'un seul post, après un vote ou un commentaire.
+func (s *ScoreModel) RefreshPost(postID int) error {
+	counts, err := s.loadCounts(postID)
+	if err != nil {
+		return err
+	}
+	return s.save(counts)
+}
+
+// RunRefresher recalcule les scores à intervalle régulier ; à lancer dans une goroutine.
+func (s *ScoreModel) RunRefresher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(); err != nil {
+			log.Printf("Erreur lors du recalcul des scores: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// loadCounts lit les compteurs d'un post (ou de tous les posts si postID vaut 0).
+func (s *ScoreModel) loadCounts(postID int) ([]postCounts, error) {
+	stmt := `
+		SELECT p.id, p.created_at,
+		       (SELECT COUNT(*) FROM Reaction l WHERE l.target_type = 'post' AND l.target_id = p.id AND l.reaction = 'like'),
+		       (SELECT COUNT(*) FROM Reaction l WHERE l.target_type = 'post' AND l.target_id = p.id AND l.reaction = 'dislike'),
+		       (SELECT COUNT(*) FROM Comment c WHERE c.post_id = p.id AND c.deleted = 0)
+		FROM Post p`
+	var args []interface{}
+	if postID != 0 {
+		stmt += " WHERE p.id = ?"
+		args = append(args, postID)
+	}
+
+	rows, err := s.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load post counts: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []postCounts
+	for rows.Next() {
+		var c postCounts
+		if err := rows.Scan(&c.postID, &c.createdAt, &c.likes, &c.dislikes, &c.comments); err != nil {
+			return nil, fmt.Errorf("failed to scan post counts: %w", err)
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// save enregistre les scores calculés dans une seule transaction.
+func (s *ScoreModel) save(counts []postCounts) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		INSERT INTO PostScore (post_id, like_count, dislike_count, comment_count, score, hot, controversy, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'))
+		ON CONFLICT(post_id) DO UPDATE SET
+			like_count = excluded.like_count,
+			dislike_count = excluded.dislike_count,
+			comment_count = excluded.comment_count,
+			score = excluded.score,
+			hot = excluded.hot,
+			controversy = excluded.controversy,
+			updated_at = excluded.updated_at`
+
+	for _, c := range counts {
+		_, err := tx.Exec(stmt, c.postID, c.likes, c.dislikes, c.comments, c.likes-c.dislikes,
+			HotScore(c.likes, c.dislikes, c.createdAt), ControversyScore(c.likes, c.dislikes))
+		if err != nil {
+			return fmt.Errorf("failed to save score of post %d: %w", c.postID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// HotScore combine le solde des votes et l'ancienneté : un post gagne autant
+// en étant 10 fois mieux noté qu'en étant publié 12h30 plus tard.
+func HotScore(likes, dislikes int, createdAt time.Time) float64 {
+	score := float64(likes - dislikes)
+	order := math.Log10(math.Max(math.Abs(score), 1))
+
+	var sign float64
+	switch {
+	case score > 0:
+		sign = 1
+	case score < 0:
+		sign = -1
+	}
+
+	seconds := createdAt.Sub(hotEpoch).Seconds()
+	return math.Round((sign*order+seconds/45000)*1e7) / 1e7
+}
+
+// ControversyScore favorise les posts ayant beaucoup de votes répartis équitablement entre likes et dislikes.
+func ControversyScore(likes, dislikes int) float64 {
+	if likes <= 0 || dislikes <= 0 {
+		return 0
+	}
+	magnitude := float64(likes + dislikes)
+	balance := float64(min(likes, dislikes)) / float64(max(likes, dislikes))
+	return math.Pow(magnitude, balance)
+}
+
+// feedOrder traduit un mode de tri en clause ORDER BY (et filtre de période pour "top").
+// Les valeurs inconnues retombent sur le tri chronologique.
+func feedOrder(sort models.FeedSort) (string, string, []interface{}) {
+	switch sort.Mode {
+	case "hot":
+		return "", "COALESCE(s.hot, 0) DESC, p.id DESC", nil
+	case "top":
+		windows := map[string]string{
+			"day":   "-1 day",
+			"week":  "-7 days",
+			"month": "-1 month",
+		}
+		if modifier, ok := windows[sort.Window]; ok {
+			return " AND p.created_at >= datetime('now', ?)", "COALESCE(s.score, 0) DESC, p.id DESC", []interface{}{modifier}
+		}
+		return "", "COALESCE(s.score, 0) DESC, p.id DESC", nil
+	case "controversial":
+		return "", "COALESCE(s.controversy, 0) DESC, p.id DESC", nil
+	case "comments":
+		return "", "COALESCE(s.comment_count, 0) DESC, p.id DESC", nil
+	default:
+		return "", "p.created_at DESC, p.id DESC", nil
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/models"
+	"html"
+	"html/template"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// SearchModel gère la recherche plein texte (FTS5) sur les posts et les commentaires
+type SearchModel struct {
+	DB          *sql.DB
+	Permissions *PermissionModel
+}
+
+const defaultSearchPerPage = 10
+
+// Marqueurs posés par snippet() autour des termes trouvés, remplacés par <mark> après échappement
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// Search retourne une page de résultats classés par pertinence (bm25) ainsi que le nombre total de résultats.
+// Les posts (et leurs commentaires) rangés dans une catégorie invisible pour viewerId sont exclus.
+func (s *SearchModel) Search(q models.SearchQuery, viewerId string) ([]models.SearchResult, int, error) {
+	match := BuildMatchQuery(q.Terms)
+	if match == "" {
+		return []models.SearchResult{}, 0, nil
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage <= 0 {
+		q.PerPage = defaultSearchPerPage
+	}
+
+	hidden, hiddenArgs, err := hiddenPostFilter(s.Permissions, viewerId, "p.id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	postWhere, postArgs := searchFilters(q, "p.created_at", "u.username")
+	commentWhere, commentArgs := searchFilters(q, "c.created_at", "u.username")
+	postWhere += hidden
+	postArgs = append(postArgs, hiddenArgs...)
+	commentWhere += hidden
+	commentArgs = append(commentArgs, hiddenArgs...)
+
+	postFrom := `
+		FROM PostSearch
+		JOIN Post p ON p.id = PostSearch.rowid
+		JOIN Users u ON u.id = p.user_id
+		WHERE PostSearch MATCH ?` + postWhere
+	commentFrom := `
+		FROM CommentSearch
+		JOIN Comment c ON c.id = CommentSearch.rowid
+		JOIN Post p ON p.id = c.post_id
+		JOIN Users u ON u.id = c.user_id
+		WHERE CommentSearch MATCH ?` + commentWhere
+
+	args := append([]interface{}{match}, postArgs...)
+	args = append(args, match)
+	args = append(args, commentArgs...)
+
+	var total int
+	countStmt := `SELECT (SELECT COUNT(*) ` + postFrom + `) + (SELECT COUNT(*) ` + commentFrom + `)`
+	if err := s.DB.QueryRow(countStmt, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if total == 0 {
+		return []models.SearchResult{}, 0, nil
+	}
+
+	// Le titre pèse plus lourd que le contenu dans le classement des posts
+	stmt := `
+		SELECT kind, post_id, comment_id, title, snippet, created_at, user_id, username, picture
+		FROM (
+			SELECT 'post' AS kind, p.id AS post_id, 0 AS comment_id, p.title AS title,
+			       snippet(PostSearch, -1, char(2), char(3), '…', 16) AS snippet,
+			       p.created_at AS created_at, u.id AS user_id, u.username AS username, u.picture AS picture,
+			       bm25(PostSearch, 5.0, 1.0) AS rank
+			` + postFrom + `
+			UNION ALL
+			SELECT 'comment', p.id, c.id, p.title,
+			       snippet(CommentSearch, 0, char(2), char(3), '…', 16),
+			       c.created_at, u.id, u.username, u.picture,
+			       bm25(CommentSearch)
+			` + commentFrom + `
+		)
+		ORDER BY rank
+		LIMIT ? OFFSET ?`
+
+	args = append(args, q.PerPage, (q.Page-1)*q.PerPage)
+	rows, err := s.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var res models.SearchResult
+		var snippet, createdAt, userIdStr string
+		var picture sql.NullString
+
+		err := rows.Scan(&res.Kind, &res.PostID, &res.CommentID, &res.Title, &snippet, &createdAt,
+			&userIdStr, &res.Author.Username, &picture)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		res.Author.Id, err = uuid.Parse(userIdStr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if picture.Valid {
+			res.Author.Picture = picture.String
+		} else {
+			res.Author.Picture = "default.jpg"
+		}
+		res.CreatedAt = parseTimestamp(createdAt)
+		res.Snippet = highlightSnippet(snippet)
+
+		results = append(results, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+// searchFilters construit les conditions additionnelles (catégorie, auteur, période) d'une branche de la recherche.
+func searchFilters(q models.SearchQuery, dateColumn, authorColumn string) (string, []interface{}) {
+	var where strings.Builder
+	var args []interface{}
+
+	if q.Category != "" {
+		where.WriteString(` AND EXISTS (
+			SELECT 1 FROM Catpostrel cp
+			JOIN Categories cat ON cat.id = cp.cat_id
+			WHERE cp.post_id = p.id AND cat.name = ?)`)
+		args = append(args, q.Category)
+	}
+	if q.Author != "" {
+		where.WriteString(" AND " + authorColumn + " = ?")
+		args = append(args, q.Author)
+	}
+	if q.From != "" {
+		where.WriteString(" AND date(" + dateColumn + ") >= date(?)")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where.WriteString(" AND date(" + dateColumn + ") <= date(?)")
+		args = append(args, q.To)
+	}
+
+	return where.String(), args
+}
+
+// BuildMatchQuery transforme la saisie de l'utilisateur en requête MATCH FTS5 sûre.
+// Les expressions entre guillemets sont conservées comme phrases et un terme
+// terminé par * devient une recherche par préfixe ; tout le reste est cité
+// pour que la syntaxe FTS5 (AND, NEAR, colonnes...) ne puisse pas être injectée.
+func BuildMatchQuery(input string) string {
+	var parts []string
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+
+		case runes[i] == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			words := strings.FieldsFunc(string(runes[i+1:end]), func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if len(words) > 0 {
+				parts = append(parts, `"`+strings.Join(words, " ")+`"`)
+			}
+			i = end + 1
+
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			term := string(runes[i:end])
+			prefix := strings.HasSuffix(term, "*")
+			term = strings.Trim(term, "*")
+			if strings.IndexFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+				quoted := `"` + term + `"`
+				if prefix {
+					quoted += "*"
+				}
+				parts = append(parts, quoted)
+			}
+			i = end
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// highlightSnippet échappe l'extrait renvoyé par FTS5 puis transforme les marqueurs en balises <mark>.
+func highlightSnippet(snippet string) template.HTML {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetOpen, "<mark>")
+	escaped = strings.ReplaceAll(escaped, snippetClose, "</mark>")
+	return template.HTML(escaped)
+}
+
+// parseTimestamp convertit une date SQLite lue sous forme de texte.
+func parseTimestamp(value string) time.Time {
+	layouts := []string{
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage conserve les fichiers envoyés par les utilisateurs (images des posts, photos de profil),
+// rangés sous des clés de la forme "images_post/abc.jpg" ; l'implémentation est choisie au démarrage.
+type Storage interface {
+	// Put enregistre data sous key, en remplaçant le fichier existant.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get ouvre le fichier key ; ErrObjectNotFound s'il n'existe pas.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete supprime le fichier key ; un fichier absent n'est pas une erreur.
+	Delete(ctx context.Context, key string) error
+	// SignedURL retourne un lien qui permet de lire key sans autre vérification jusqu'à l'expiration.
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// ObjectInfo décrit un fichier conservé par un Storage.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+var (
+	ErrObjectNotFound   = errors.New("stored file not found")
+	ErrInvalidKey       = errors.New("invalid storage key")
+	ErrInvalidSignature = errors.New("invalid or expired link")
+)
+
+// checkKey refuse les clés vides, absolues ou qui sortent du stockage ("..").
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// contentTypeOf retourne le type d'un fichier d'après l'extension de sa clé.
+func contentTypeOf(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// LocalStorage range les fichiers dans le dossier Dir : suffisant pour une seule instance du forum.
+// Ses liens signés pointent vers URL (par exemple /media), servi par le forum lui-même (voir Verify).
+type LocalStorage struct {
+	Dir    string
+	URL    string // préfixe des liens signés, sans "/" final
+	Secret []byte // clé de signature des liens
+}
+
+// Put écrit data sous key ; le fichier est écrit à côté puis renommé pour n'être jamais lu à moitié.
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return writeUpload(filepath.Join(s.Dir, filepath.FromSlash(path.Dir(key))), path.Base(key), data)
+}
+
+// Get ouvre le fichier key.
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to open stored file: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		file.Close()
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	return file, ObjectInfo{Size: stat.Size(), ContentType: contentTypeOf(key), ModTime: stat.ModTime()}, nil
+}
+
+// Delete supprime le fichier key.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete stored file: %w", err)
+	}
+	return nil
+}
+
+// SignedURL retourne URL/key avec une date d'expiration et sa signature HMAC.
+func (s *LocalStorage) SignedURL(key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	expiry := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{"expires": {expiry}, "signature": {s.signature(key, expiry)}}
+	return s.URL + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// Verify renvoie ErrInvalidSignature si signature n'est pas celle d'un lien vers key encore valide.
+func (s *LocalStorage) Verify(key, expiry, signature string) error {
+	given, err := hex.DecodeString(signature)
+	if err != nil || checkKey(key) != nil {
+		return ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(s.signature(key, expiry))
+	if !hmac.Equal(given, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s *LocalStorage) signature(key, expiry string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte("storage:" + key + "\n" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeUpload écrit data sous name dans dir. Le fichier est écrit à côté puis renommé pour n'être
+// jamais lu à moitié.
+func writeUpload(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrPostLocked   = errors.New("this thread is locked")
+	ErrPostArchived = errors.New("this thread is archived and read-only")
+)
+
+// SetPinned épingle (ou désépingle) un post en tête des fils.
+func (m *PostModel) SetPinned(postID int, pinned bool) error {
+	return m.setThreadFlag(postID, "pinned", pinned)
+}
+
+// SetLocked verrouille (ou déverrouille) un post : plus aucun commentaire n'est accepté.
+func (m *PostModel) SetLocked(postID int, locked bool) error {
+	return m.setThreadFlag(postID, "locked", locked)
+}
+
+// SetArchived archive (ou restaure) un post. Un post restauré repart avec une activité récente
+// pour ne pas être archivé de nouveau au prochain passage de l'archivage automatique.
+func (m *PostModel) SetArchived(postID int, archived bool) error {
+	if err := m.setThreadFlag(postID, "archived", archived); err != nil {
+		return err
+	}
+	if archived {
+		return nil
+	}
+	_, err := m.DB.Exec("UPDATE Post SET last_activity_at = datetime('now') WHERE id = ?", postID)
+	return err
+}
+
+// CheckVotable renvoie ErrPostArchived si le post est archivé : ses réactions et celles de ses
+// commentaires sont figées comme le reste du fil. Un fil verrouillé accepte toujours les votes.
+func (m *PostModel) CheckVotable(postID int) error {
+	var archived bool
+	err := m.DB.QueryRow("SELECT archived FROM Post WHERE id = ?", postID).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	} else if err != nil {
+		return err
+	}
+	if archived {
+		return ErrPostArchived
+	}
+	return nil
+}
+
+// setThreadFlag modifie l'une des colonnes d'état d'un post (pinned, locked ou archived).
+func (m *PostModel) setThreadFlag(postID int, column string, value bool) error {
+	res, err := m.DB.Exec("UPDATE Post SET "+column+" = ? WHERE id = ?", value, postID)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", column, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// ArchiveInactive archive les posts sans activité (création ou commentaire) depuis days jours.
+// Les posts épinglés ne sont jamais archivés automatiquement.
+func (m *PostModel) ArchiveInactive(days int) (int64, error) {
+	res, err := m.DB.Exec(`
+		UPDATE Post SET archived = 1
+		WHERE archived = 0 AND pinned = 0
+		  AND COALESCE(last_activity_at, created_at) < datetime('now', ?)`,
+		fmt.Sprintf("-%d days", days))
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive inactive posts: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunArchiver archive à intervalle régulier les posts inactifs ; à lancer dans une goroutine.
+func (m *PostModel) RunArchiver(days int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		archived, err := m.ArchiveInactive(days)
+		if err != nil {
+			log.Printf("Erreur lors de l'archivage automatique: %v", err)
+		} else if archived > 0 {
+			log.Printf("%d post(s) archivé(s) après %d jours sans activité", archived, days)
+		}
+		<-ticker.C
+	}
+}
+
+// checkThreadWritable renvoie ErrPostArchived ou ErrPostLocked si le post n'accepte plus de commentaires.
+func checkThreadWritable(db *sql.DB, postID int) error {
+	var locked, archived bool
+	err := db.QueryRow("SELECT locked, archived FROM Post WHERE id = ?", postID).Scan(&locked, &archived)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if archived {
+		return ErrPostArchived
+	}
+	if locked {
+		return ErrPostLocked
+	}
+	return nil
+}
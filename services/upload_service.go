@@ -1,63 +1,391 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"errors"
-	"mime/multipart"
-	"os"
-	"path/filepath"
+	"fmt"
+	"image"
+	_ "image/gif" // décodeurs utilisés par image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
 )
 
-// Liste des formats d'images autorisés
-var allowedImageFormats = map[string]bool{
-	".jpg":  true,
-	".jpeg": true,
-	".png":  true,
-	".gif":  true,
+// Types d'upload.
+const (
+	UploadPost    = "post"    // image d'un post
+	UploadProfile = "profile" // photo de profil
+)
+
+// uploadDirs sont les dossiers, dans le stockage comme sous /static/, où sont rangés les types d'upload.
+var uploadDirs = map[string]string{
+	UploadPost:    "images_post",
+	UploadProfile: "images_profile",
+}
+
+// imageFormats sont les formats d'images acceptés, par type détecté : format décodé et extension du fichier.
+// Le SVG, qui peut contenir des scripts, est refusé.
+var imageFormats = map[string]struct{ format, ext string }{
+	"image/jpeg": {"jpeg", ".jpg"},
+	"image/png":  {"png", ".png"},
+	"image/gif":  {"gif", ".gif"},
 }
 
 // Taille maximale autorisée pour les images (20 Mo)
 const maxImageSize = 20 * 1024 * 1024 // 20 MB
 
-// UploadImage gère l'upload d'une image, vérifie le format et la taille, puis la sauvegarde sur le serveur.
-func UploadImage(file multipart.File, fileHeader *multipart.FileHeader, uploadPath string) (string, error) {
-	// Vérifier la taille du fichier
-	if fileHeader.Size > maxImageSize {
-		return "", errors.New("le fichier est trop volumineux, la taille maximale est de 20 MB")
+// maxImagePixels borne les dimensions d'une image, pour qu'un petit fichier ne se décompresse pas en gigaoctets
+// (une image de 25 millions de pixels occupe 100 Mo une fois décodée).
+const maxImagePixels = 25_000_000
+
+// maxGIFFrames borne le nombre d'images d'un GIF animé ; leurs pixels cumulés sont bornés par maxImagePixels
+// (un octet par pixel une fois décodés).
+const maxGIFFrames = 500
+
+var (
+	ErrImageTooLarge    = errors.New("the image is too large, the maximum size is 20 MB")
+	ErrUnsupportedImage = errors.New("unsupported image, accepted formats are JPEG, PNG and GIF")
+	ErrInvalidUpload    = errors.New("invalid upload type")
+)
+
+// uploadQueueSize borne le nombre d'images en attente de traitement ; au-delà, elles restent en attente
+// dans la table Uploads jusqu'au prochain passage de RunSweeper.
+const uploadQueueSize = 64
+
+// UploadModel range les images envoyées par les utilisateurs sous le nom de l'empreinte de leur contenu,
+// jamais sous le nom choisi par le client, et garde trace de leurs propriétaires dans la table Uploads.
+// Les images sont ré-encodées dans chacune de leurs tailles par un nombre borné de goroutines (voir Start) :
+// la requête d'upload n'attend pas leur traitement. Les fichiers sont conservés par Storage, sous
+// images_post/ et images_profile/ ; les images reçues, telles quelles, attendent leur traitement sous pending/.
+type UploadModel struct {
+	DB      *sql.DB
+	Storage Storage
+	Legacy  Storage // images envoyées avant Storage (dossier static/), lues en dernier recours ; peut être nil
+
+	mu      sync.Mutex
+	jobs    chan uploadJob           // nil : images traitées pendant la requête d'upload
+	pending map[string]chan struct{} // images dans la file ou en traitement ; fermé une fois traitée
+
+	// files empêche Release de supprimer une image entre le moment où Save la trouve déjà enregistrée
+	// (et n'en écrit pas les fichiers) et celui où Save note son nouveau propriétaire.
+	files sync.Mutex
+}
+
+// uploadJob est une image à traiter.
+type uploadJob struct {
+	kind, name string
+}
+
+// Start lance workers goroutines qui traitent les images envoyées. Sans appel à Start, les images
+// sont traitées pendant la requête d'upload.
+func (m *UploadModel) Start(workers int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs != nil || workers <= 0 {
+		return
 	}
+	m.jobs = make(chan uploadJob, uploadQueueSize)
+	m.pending = map[string]chan struct{}{}
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+}
 
-	// Vérifier le format du fichier
-	ext := filepath.Ext(fileHeader.Filename)
-	if !allowedImageFormats[ext] {
-		return "", errors.New("format d'image non autorisé. Formats acceptés : .jpg, .jpeg, .png, .gif")
+// Save vérifie que file est bien une image acceptée d'après son contenu, la met en attente de traitement
+// et note que userID l'a envoyée. Retourne le nom de l'image, à conserver dans Post.image ou Users.picture ;
+// ses fichiers sont disponibles une fois l'image traitée (voir Await).
+func (m *UploadModel) Save(userID, kind string, file io.Reader) (string, error) {
+	if _, ok := uploadDirs[kind]; !ok {
+		return "", ErrInvalidUpload
 	}
 
-	// Générer un chemin complet pour sauvegarder l'image
-	newFilename := filepath.Join(uploadPath, fileHeader.Filename)
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxImageSize {
+		return "", ErrImageTooLarge
+	}
 
-	// Créer le fichier sur le serveur
-	outFile, err := os.Create(newFilename)
+	contentType, config, err := checkImage(data)
 	if err != nil {
 		return "", err
 	}
-	defer outFile.Close()
 
-	// Copier le fichier uploadé dans le fichier destination
-	_, err = file.Seek(0, 0) // Remettre le curseur du fichier à zéro
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + imageFormats[contentType].ext
+
+	status, err := m.record(userID, kind, name, contentType, data, config)
 	if err != nil {
 		return "", err
 	}
-	if _, err := outFile.ReadFrom(file); err != nil {
-		return "", err
+	if status == "pending" {
+		if err := m.submit(uploadJob{kind: kind, name: name}); err != nil {
+			return "", err
+		}
 	}
+	return name, nil
+}
+
+// record note que userID a envoyé l'image name et retourne son état. Une image déjà envoyée n'est
+// pas réécrite : seul son nouveau propriétaire est noté ; sinon, elle est mise en attente de traitement.
+func (m *UploadModel) record(userID, kind, name, contentType string, data []byte, config image.Config) (string, error) {
+	m.files.Lock()
+	defer m.files.Unlock()
 
-	return newFilename, nil
+	var status string
+	err := m.DB.QueryRow(`SELECT status FROM Uploads WHERE kind = ? AND name = ? LIMIT 1`, kind, name).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to check upload: %w", err)
+	}
+	if status == "failed" {
+		return "", ErrUnsupportedImage
+	}
+	if status == "" {
+		status = "pending"
+		if err := m.Storage.Put(context.Background(), stagedKey(kind, name), data, contentType); err != nil {
+			return "", fmt.Errorf("failed to store upload: %w", err)
+		}
+	}
+
+	_, err = m.DB.Exec(`
+		INSERT OR IGNORE INTO Uploads (kind, name, user_id, content_type, size, width, height, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, kind, name, userID, contentType, len(data), config.Width, config.Height, status)
+	if err != nil {
+		return "", fmt.Errorf("failed to record upload: %w", err)
+	}
+	return status, nil
 }
 
-// ValidateImageFormat vérifie si le format d'image est autorisé.
-func ValidateImageFormat(filename string) error {
-	ext := filepath.Ext(filename)
-	if !allowedImageFormats[ext] {
-		return errors.New("format d'image non autorisé")
+// Await attend la fin du traitement d'une image envoyée, au plus jusqu'à l'annulation de ctx.
+// Elle retourne aussitôt si l'image n'est pas en cours de traitement.
+func (m *UploadModel) Await(ctx context.Context, kind, name string) {
+	m.mu.Lock()
+	done := m.pending[kind+"/"+name]
+	m.mu.Unlock()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// RunSweeper remet dans la file, au démarrage puis toutes les interval, les images restées en attente :
+// file pleine, redémarrage du serveur ou images envoyées avant leur traitement.
+func (m *UploadModel) RunSweeper(interval time.Duration) {
+	for {
+		if err := m.sweep(); err != nil {
+			log.Printf("Erreur lors de la reprise des images en attente : %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// sweep soumet les images en attente qui ne sont pas déjà dans la file.
+func (m *UploadModel) sweep() error {
+	rows, err := m.DB.Query(`SELECT DISTINCT kind, name FROM Uploads WHERE status = 'pending'`)
+	if err != nil {
+		return err
+	}
+	var jobs []uploadJob
+	for rows.Next() {
+		var job uploadJob
+		if err := rows.Scan(&job.kind, &job.name); err != nil {
+			rows.Close()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := m.submit(job); err != nil {
+			log.Printf("Erreur lors du traitement de l'image %s : %v", job.name, err)
+		}
 	}
 	return nil
 }
+
+// submit met une image dans la file des goroutines de traitement, ou la traite aussitôt si Start
+// n'a pas été appelée. Une image déjà dans la file n'y est pas remise.
+func (m *UploadModel) submit(job uploadJob) error {
+	m.mu.Lock()
+	if m.jobs == nil {
+		m.mu.Unlock()
+		return m.process(job)
+	}
+	defer m.mu.Unlock()
+
+	key := job.kind + "/" + job.name
+	if _, queued := m.pending[key]; queued {
+		return nil
+	}
+	select {
+	case m.jobs <- job:
+		m.pending[key] = make(chan struct{})
+	default:
+		// File pleine : l'image reste en attente jusqu'au prochain passage de RunSweeper
+	}
+	return nil
+}
+
+// work traite les images de la file une à une.
+func (m *UploadModel) work() {
+	for job := range m.jobs {
+		if err := m.process(job); err != nil {
+			log.Printf("Erreur lors du traitement de l'image %s : %v", job.name, err)
+		}
+
+		key := job.kind + "/" + job.name
+		m.mu.Lock()
+		if done, ok := m.pending[key]; ok {
+			close(done)
+			delete(m.pending, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// process ré-encode une image en attente dans chacune de ses tailles, puis la marque comme prête,
+// ou en échec si elle ne peut pas être décodée. Une erreur de lecture ou d'écriture la laisse en attente.
+func (m *UploadModel) process(job uploadJob) error {
+	ctx := context.Background()
+	staged, public := stagedKey(job.kind, job.name), UploadKey(job.kind, job.name)
+	data, err := m.read(ctx, staged, public)
+	if err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	files, err := processImage(job.kind, job.name, data)
+	if err != nil {
+		if _, dbErr := m.DB.Exec(`UPDATE Uploads SET status = 'failed' WHERE kind = ? AND name = ?`, job.kind, job.name); dbErr != nil {
+			return dbErr
+		}
+		m.Storage.Delete(ctx, staged)
+		m.Storage.Delete(ctx, public)
+		return err
+	}
+
+	for name, content := range files {
+		if err := m.Storage.Put(ctx, UploadKey(job.kind, name), content, contentTypeOf(name)); err != nil {
+			return err
+		}
+	}
+	if _, err := m.DB.Exec(`UPDATE Uploads SET status = 'ready' WHERE kind = ? AND name = ?`, job.kind, job.name); err != nil {
+		return fmt.Errorf("failed to update upload: %w", err)
+	}
+	if err := m.Storage.Delete(ctx, staged); err != nil {
+		return fmt.Errorf("failed to delete staged upload: %w", err)
+	}
+	return nil
+}
+
+// read retourne le contenu de l'image reçue : en attente sous staged ou, pour les images envoyées
+// avant leur traitement, l'original rangé sous public, dans Storage puis dans Legacy.
+func (m *UploadModel) read(ctx context.Context, staged, public string) ([]byte, error) {
+	sources := []struct {
+		storage Storage
+		key     string
+	}{{m.Storage, staged}, {m.Storage, public}, {m.Legacy, public}}
+
+	for _, source := range sources {
+		if source.storage == nil {
+			continue
+		}
+		body, _, err := source.storage.Get(ctx, source.key)
+		if errors.Is(err, ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(body, maxImageSize+1))
+		body.Close()
+		return data, err
+	}
+	return nil, ErrObjectNotFound
+}
+
+// UploadKey retourne la clé, dans Storage, du fichier name (image ou l'une de ses tailles) de type kind.
+func UploadKey(kind, name string) string {
+	return uploadDirs[kind] + "/" + name
+}
+
+// stagedKey est la clé d'une image en attente de traitement.
+func stagedKey(kind, name string) string {
+	return "pending/" + kind + "-" + name
+}
+
+// Release supprime une image envoyée, toutes tailles comprises, qui n'est plus utilisée par aucun post
+// ou profil. Les fichiers qui ne viennent pas d'un upload (image par défaut, anciens fichiers) ne sont
+// jamais supprimés.
+func (m *UploadModel) Release(kind, name string) error {
+	if _, ok := uploadDirs[kind]; !ok {
+		return ErrInvalidUpload
+	}
+	if name == "" {
+		return nil
+	}
+
+	// Les lignes ne sont supprimées que si aucun post ou profil n'utilise l'image, dans la même requête :
+	// une image réutilisée entre-temps est gardée, fichiers compris
+	unused := `NOT EXISTS (SELECT 1 FROM Post WHERE image = ?)`
+	if kind == UploadProfile {
+		unused = `NOT EXISTS (SELECT 1 FROM Users WHERE picture = ?)`
+	}
+
+	m.files.Lock()
+	defer m.files.Unlock()
+	result, err := m.DB.Exec(`DELETE FROM Uploads WHERE kind = ? AND name = ? AND `+unused, kind, name, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return nil
+	}
+
+	keys := []string{stagedKey(kind, name)}
+	for _, variant := range imageVariants[kind] {
+		keys = append(keys, UploadKey(kind, variantName(name, variant.Suffix)))
+	}
+	for _, key := range keys {
+		if err := m.Storage.Delete(context.Background(), key); err != nil {
+			return fmt.Errorf("failed to delete upload file: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkImage détecte le type d'une image d'après son contenu, sans se fier au nom ni au type annoncés
+// par le client, et vérifie que son en-tête est valide, de ce type et de dimensions raisonnables.
+// L'image est entièrement décodée lors de son traitement.
+func checkImage(data []byte) (string, image.Config, error) {
+	contentType := http.DetectContentType(data)
+	expected, ok := imageFormats[contentType]
+	if !ok {
+		return "", image.Config{}, ErrUnsupportedImage
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != expected.format {
+		return "", image.Config{}, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return "", image.Config{}, ErrUnsupportedImage
+	}
+	return contentType, config, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"forum/internal/testdb"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// storedFiles retourne les tailles d'une image présentes dans le stockage.
+func storedFiles(t *testing.T, storage Storage, kind, name string) int {
+	t.Helper()
+	found := 0
+	for _, variant := range imageVariants[kind] {
+		body, _, err := storage.Get(context.Background(), UploadKey(kind, variantName(name, variant.Suffix)))
+		if errors.Is(err, ErrObjectNotFound) {
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		body.Close()
+		found++
+	}
+	return found
+}
+
+// TestUploadReferences vérifie qu'une image envoyée par plusieurs utilisateurs n'est stockée qu'une fois
+// et que Release ne la supprime, lignes et fichiers, qu'une fois qu'aucun post ne l'utilise.
+func TestUploadReferences(t *testing.T) {
+	db := testdb.Open(t)
+	alice := testdb.AddUser(t, db, "11111111-1111-1111-1111-111111111111", "alice", "user")
+	bob := testdb.AddUser(t, db, "22222222-2222-2222-2222-222222222222", "bob", "user")
+	storage := &LocalStorage{Dir: t.TempDir()}
+	uploads := &UploadModel{DB: db, Storage: storage}
+
+	data := testPNG(t)
+	name, err := uploads.Save(alice, UploadPost, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := uploads.Save(bob, UploadPost, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != name {
+		t.Fatalf("same image stored as %s and %s", name, again)
+	}
+	rows := func() int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM Uploads WHERE name = ?`, name).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := rows(); n != 2 {
+		t.Fatalf("%d Uploads rows, want one per user", n)
+	}
+	if n := storedFiles(t, storage, UploadPost, name); n != len(imageVariants[UploadPost]) {
+		t.Fatalf("%d stored sizes, want %d", n, len(imageVariants[UploadPost]))
+	}
+
+	// Un post utilise l'image : elle est gardée
+	if _, err := db.Exec(`INSERT INTO Post (id, user_id, title, content, image) VALUES (1, ?, 't', 'c', ?)`, bob, name); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Release(UploadPost, name); err != nil {
+		t.Fatal(err)
+	}
+	if n := rows(); n != 2 {
+		t.Fatalf("image in use lost its Uploads rows: %d left", n)
+	}
+	if n := storedFiles(t, storage, UploadPost, name); n != len(imageVariants[UploadPost]) {
+		t.Fatalf("image in use lost its files: %d left", n)
+	}
+
+	// Plus aucun post : lignes et fichiers sont supprimés
+	if _, err := db.Exec(`DELETE FROM Post WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Release(UploadPost, name); err != nil {
+		t.Fatal(err)
+	}
+	if n := rows(); n != 0 {
+		t.Fatalf("%d Uploads rows left after release", n)
+	}
+	if n := storedFiles(t, storage, UploadPost, name); n != 0 {
+		t.Fatalf("%d files left after release", n)
+	}
+
+	// Une photo de profil utilisée est gardée de la même façon
+	if _, err := uploads.Save(alice, UploadProfile, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE Users SET picture = ? WHERE id = ?`, name, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploads.Release(UploadProfile, name); err != nil {
+		t.Fatal(err)
+	}
+	if n := storedFiles(t, storage, UploadProfile, name); n != len(imageVariants[UploadProfile]) {
+		t.Fatalf("profile picture in use lost its files: %d left", n)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
 type UserModel struct {
@@ -56,3 +57,39 @@ func (u *UserModel) GetAllInfoUser(id string) (string, string, *string, error) {
 	}
 	return user, email, picture, nil
 }
+
+// GetRole retourne le rôle (user, moderator, admin) d'un utilisateur
+func (u *UserModel) GetRole(id string) (string, error) {
+	var role string
+	err := u.DB.QueryRow(`SELECT role FROM users WHERE id = ?`, id).Scan(&role)
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// Suggest retourne au plus limit noms d'utilisateurs mentionnables (voir Mentionable) qui commencent
+// par prefix, sans tenir compte de la casse, les plus courts d'abord.
+func (u *UserModel) Suggest(prefix string, limit int) ([]string, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	rows, err := u.DB.Query(`
+		SELECT username FROM users
+		WHERE username LIKE ? ESCAPE '\' AND username NOT GLOB '*[^A-Za-z0-9_.-]*'
+		ORDER BY length(username), username`, escaped+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest users: %w", err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() && len(usernames) < limit {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		if Mentionable(username) {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames, rows.Err()
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"slices"
+)
+
+// TargetCategory désigne une catégorie suivie ; un post suivi utilise TargetPost.
+const TargetCategory = "category"
+
+// ErrInvalidWatch est retournée pour un abonnement à autre chose qu'un post ou une catégorie.
+var ErrInvalidWatch = errors.New("invalid watch target")
+
+// WatchModel gère les abonnements aux posts et aux catégories et prévient les abonnés
+// des nouveaux commentaires et des nouveaux posts.
+type WatchModel struct {
+	DB            *sql.DB
+	Permissions   *PermissionModel
+	Notifications *Notification
+}
+
+// Watch abonne un utilisateur à un post ou à une catégorie, y compris après un désabonnement.
+func (m *WatchModel) Watch(userID, targetType string, targetID int) error {
+	return m.set(userID, targetType, targetID, true)
+}
+
+// Unwatch désabonne un utilisateur ; il ne sera plus réabonné automatiquement à ce post.
+func (m *WatchModel) Unwatch(userID, targetType string, targetID int) error {
+	return m.set(userID, targetType, targetID, false)
+}
+
+func (m *WatchModel) set(userID, targetType string, targetID int, active bool) error {
+	if targetType != TargetPost && targetType != TargetCategory {
+		return ErrInvalidWatch
+	}
+	_, err := m.DB.Exec(`
+		INSERT INTO Watch (user_id, target_type, target_id, active) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, target_type, target_id) DO UPDATE SET active = excluded.active`,
+		userID, targetType, targetID, active)
+	return err
+}
+
+// AutoWatch abonne un utilisateur au post qu'il vient de commenter, sauf s'il s'en est déjà désabonné.
+func (m *WatchModel) AutoWatch(userID string, postID int) error {
+	_, err := m.DB.Exec(`INSERT OR IGNORE INTO Watch (user_id, target_type, target_id) VALUES (?, 'post', ?)`, userID, postID)
+	return err
+}
+
+// IsWatching indique si un utilisateur est abonné à un post ou à une catégorie.
+func (m *WatchModel) IsWatching(userID, targetType string, targetID int) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+	var active bool
+	err := m.DB.QueryRow(`SELECT active FROM Watch WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+		userID, targetType, targetID).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return active, err
+}
+
+// NotifyComment prévient les abonnés du post et de ses catégories d'un nouveau commentaire ;
+// retourne le nombre de notifications envoyées. L'auteur du commentaire n'est pas notifié, ni ceux
+// que AddCommentNotification et AddReplyNotification visent déjà : l'auteur du post et celui du
+// commentaire parent s'il n'est pas supprimé.
+func (m *WatchModel) NotifyComment(commentID int) (int, error) {
+	var postID int
+	var commenterID string
+	err := m.DB.QueryRow(`SELECT post_id, user_id FROM Comment WHERE id = ?`, commentID).Scan(&postID, &commenterID)
+	if err != nil {
+		return 0, err
+	}
+
+	watchers, err := m.watchers(postID, commenterID, `
+		AND w.user_id NOT IN (SELECT user_id FROM Post WHERE id = ?)
+		AND w.user_id NOT IN (
+			SELECT parent.user_id FROM Comment c JOIN Comment parent ON parent.id = c.parent_id
+			WHERE c.id = ? AND parent.deleted = 0)`, postID, commentID)
+	if err != nil {
+		return 0, err
+	}
+	return m.notify(watchers, commenterID, postID, commentID)
+}
+
+// NotifyPost prévient les abonnés des catégories d'un nouveau post ; retourne le nombre de notifications
+// envoyées. L'auteur et les abonnés déjà prévenus par NotifyFollowers (notified) ne sont pas notifiés.
+func (m *WatchModel) NotifyPost(postID int, authorID string, notified []string) (int, error) {
+	watchers, err := m.watchers(postID, authorID, `
+		AND w.target_type = 'category'`)
+	if err != nil {
+		return 0, err
+	}
+	watchers = slices.DeleteFunc(watchers, func(id string) bool { return slices.Contains(notified, id) })
+	return m.notify(watchers, authorID, postID, 0)
+}
+
+// watchers retourne les abonnés actifs du post ou de l'une de ses catégories, hors actorID,
+// filtrés par la condition supplémentaire extra.
+func (m *WatchModel) watchers(postID int, actorID, extra string, extraArgs ...interface{}) ([]string, error) {
+	args := append([]interface{}{postID, postID, actorID}, extraArgs...)
+	rows, err := m.DB.Query(`
+		SELECT DISTINCT w.user_id
+		FROM Watch w
+		WHERE w.active = 1
+		  AND ((w.target_type = 'post' AND w.target_id = ?)
+		    OR (w.target_type = 'category' AND w.target_id IN (SELECT cat_id FROM Catpostrel WHERE post_id = ?)))
+		  AND w.user_id != ?`+extra, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var watchers []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, id)
+	}
+	return watchers, rows.Err()
+}
+
+// notify envoie une notification d'abonnement à chaque abonné qui peut voir le post.
+func (m *WatchModel) notify(watchers []string, actorID string, postID, commentID int) (int, error) {
+	sent := 0
+	for _, watcherID := range watchers {
+		if err := m.Permissions.CheckPost(watcherID, postID, ActionView); errors.Is(err, ErrForbidden) {
+			continue
+		} else if err != nil {
+			return sent, err
+		}
+
+		if err := m.Notifications.AddWatchNotification(watcherID, actorID, postID, commentID); err != nil {
+			log.Printf("Erreur lors de la notification d'abonnement de %s (post %d): %v", watcherID, postID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,188 @@
+// Page d'un post en direct : nouveaux commentaires, modifications, suppressions et compteurs de réactions
+// poussés par /post/stream/{id}, avec le nombre de visiteurs et qui est en train d'écrire.
+// EventSource se reconnecte seul avec Last-Event-ID ; si des événements ont été perdus,
+// le serveur envoie "stale" et on propose de recharger la page.
+(function () {
+    var bar = document.getElementById("live-bar");
+    if (!bar || !window.EventSource || !window.fetch) {
+        return;
+    }
+    var postId = bar.dataset.postId;
+    var viewers = bar.querySelector(".live-viewers");
+    var typingLabel = bar.querySelector(".live-typing");
+    var stale = bar.querySelector(".live-stale");
+    var typing = {};
+
+    function data(event) {
+        return JSON.parse(event.data);
+    }
+
+    // Affiche un contenu comme le serveur : chaque @username devient un lien vers le profil.
+    function setContent(element, text) {
+        var pattern = /(^|[^\w@])@(\w[\w.-]*)/g;
+        var last = 0;
+        var match;
+        element.textContent = "";
+        while ((match = pattern.exec(text)) !== null) {
+            var name = match[2].replace(/[.-]+$/, "");
+            var start = match.index + match[1].length;
+            element.appendChild(document.createTextNode(text.slice(last, start)));
+            var link = document.createElement("a");
+            link.href = "/profile/" + encodeURIComponent(name);
+            link.className = "mention";
+            link.textContent = "@" + name;
+            element.appendChild(link);
+            last = start + name.length + 1;
+        }
+        element.appendChild(document.createTextNode(text.slice(last)));
+    }
+
+    function comment(id) {
+        return document.getElementById("comment-" + id);
+    }
+
+    function showTyping() {
+        var names = Object.keys(typing);
+        if (names.length === 0) {
+            typingLabel.textContent = "";
+        } else if (names.length === 1) {
+            typingLabel.textContent = names[0] + " is typing…";
+        } else {
+            typingLabel.textContent = names.join(", ") + " are typing…";
+        }
+    }
+
+    function insert(event, html) {
+        var template = document.createElement("template");
+        template.innerHTML = html.trim();
+        var node = template.content.firstElementChild;
+        if (!node || comment(event.id)) {
+            return;
+        }
+
+        if (event.parent_id) {
+            // Réponse à un commentaire d'une autre page : rien à afficher ici
+            var parent = comment(event.parent_id);
+            if (!parent) {
+                return;
+            }
+            var replies = parent.querySelector(":scope > .comment-replies");
+            if (!replies) {
+                replies = document.createElement("div");
+                replies.className = "comment-replies";
+                parent.appendChild(replies);
+            }
+            replies.appendChild(node);
+            return;
+        }
+
+        var list = document.getElementById("comment-list");
+        if (!list || list.dataset.liveInsert !== "top") {
+            stale.hidden = false;
+            return;
+        }
+        list.insertBefore(node, list.firstChild);
+        var empty = document.querySelector(".pasdecom");
+        if (empty) {
+            empty.remove();
+        }
+    }
+
+    var source = new EventSource("/post/stream/" + postId);
+
+    source.addEventListener("presence", function (event) {
+        var count = data(event).viewers || 0;
+        viewers.textContent = count === 1 ? "1 person viewing" : count + " people viewing";
+    });
+
+    source.addEventListener("typing", function (event) {
+        var user = data(event).user;
+        clearTimeout(typing[user]);
+        typing[user] = setTimeout(function () {
+            delete typing[user];
+            showTyping();
+        }, 5000);
+        showTyping();
+    });
+
+    source.addEventListener("comment", function (event) {
+        var created = data(event);
+        if (comment(created.id)) {
+            return;
+        }
+        fetch("/comment/" + created.id + "/fragment", { credentials: "same-origin" }).then(function (response) {
+            if (!response.ok) {
+                throw new Error(response.status);
+            }
+            return response.text();
+        }).then(function (html) {
+            insert(created, html);
+        }).catch(function () {
+            stale.hidden = false;
+        });
+    });
+
+    source.addEventListener("comment_edited", function (event) {
+        var edited = data(event);
+        var node = comment(edited.id);
+        var content = node && node.querySelector(":scope > .comment-item .comment-content p");
+        if (content) {
+            setContent(content, edited.content);
+        }
+    });
+
+    source.addEventListener("comment_deleted", function (event) {
+        var deleted = data(event);
+        var node = comment(deleted.id);
+        if (!node) {
+            return;
+        }
+        if (deleted.removed) {
+            node.remove();
+            return;
+        }
+        // Un commentaire qui a des réponses garde sa place dans le fil
+        var item = node.querySelector(":scope > .comment-item");
+        if (item) {
+            item.className = "comment-item comment-deleted";
+            item.innerHTML = '<div class="comment-content"><p>[deleted]</p></div>';
+        }
+    });
+
+    source.addEventListener("votes", function (event) {
+        var votes = data(event);
+        var selector = 'form.vote-form[action="/' + votes.target + "/" + votes.id + '/vote"]';
+        document.querySelectorAll(selector).forEach(function (form) {
+            var action = form.querySelector('input[name="action"]').value;
+            var count = (votes.counts && votes.counts[action]) || 0;
+            var button = form.querySelector("button");
+            if (button.dataset.emoji) {
+                button.textContent = button.dataset.emoji + (count ? " " + count : "");
+                return;
+            }
+            var counter = form.nextElementSibling;
+            if (counter && counter.tagName === "SPAN") {
+                counter.textContent = count;
+            }
+        });
+    });
+
+    source.addEventListener("stale", function () {
+        stale.hidden = false;
+    });
+
+    // Indication "en train d'écrire", au plus une requête toutes les 3 secondes
+    var lastTyping = 0;
+    document.addEventListener("input", function (event) {
+        var input = event.target;
+        if (input.name !== "content" || !input.closest(".comment-section, .comment-reply")) {
+            return;
+        }
+        var now = Date.now();
+        if (now - lastTyping < 3000) {
+            return;
+        }
+        lastTyping = now;
+        fetch("/post/typing/" + postId, { method: "POST", credentials: "same-origin" });
+    });
+})();
@@ -0,0 +1,133 @@
+// Autocomplétion des mentions : dans les champs marqués data-mentions, taper "@" suivi du début
+// d'un nom propose les utilisateurs correspondants (GET /users/suggest?q=).
+// Flèches haut et bas pour choisir, Entrée ou Tab pour insérer, Échap pour fermer.
+(function () {
+    var list = document.createElement("ul");
+    list.className = "mention-suggestions";
+    list.hidden = true;
+    document.body.appendChild(list);
+
+    var field = null;   // champ en cours d'édition
+    var start = 0;      // position du "@" dans le champ
+    var active = 0;     // suggestion sélectionnée
+    var pending = null; // requête en attente
+
+    function close() {
+        list.hidden = true;
+        list.innerHTML = "";
+        field = null;
+    }
+
+    // Retourne le nom en cours de saisie avant le curseur, ou null s'il n'y en a pas.
+    function query(input) {
+        var before = input.value.slice(0, input.selectionStart);
+        var match = /(?:^|[^\w@])@([\w.-]*)$/.exec(before);
+        if (!match || match[1] === "") {
+            return null;
+        }
+        start = before.length - match[1].length - 1;
+        return match[1];
+    }
+
+    function select(index) {
+        var items = list.children;
+        if (!items.length) {
+            return;
+        }
+        active = (index + items.length) % items.length;
+        for (var i = 0; i < items.length; i++) {
+            items[i].classList.toggle("active", i === active);
+        }
+    }
+
+    function insert(username) {
+        var value = field.value;
+        var end = field.selectionStart;
+        field.value = value.slice(0, start) + "@" + username + " " + value.slice(end);
+        var caret = start + username.length + 2;
+        field.setSelectionRange(caret, caret);
+        field.focus();
+        close();
+    }
+
+    function show(input, usernames) {
+        list.innerHTML = "";
+        if (!usernames.length) {
+            close();
+            return;
+        }
+        field = input;
+        usernames.forEach(function (username) {
+            var item = document.createElement("li");
+            item.textContent = "@" + username;
+            item.addEventListener("mousedown", function (event) {
+                event.preventDefault();
+                insert(username);
+            });
+            list.appendChild(item);
+        });
+        var rect = input.getBoundingClientRect();
+        list.style.left = (window.scrollX + rect.left) + "px";
+        list.style.top = (window.scrollY + rect.bottom) + "px";
+        list.hidden = false;
+        select(0);
+    }
+
+    document.addEventListener("input", function (event) {
+        var input = event.target;
+        if (!input.hasAttribute || !input.hasAttribute("data-mentions") || !window.fetch) {
+            return;
+        }
+        var prefix = query(input);
+        clearTimeout(pending);
+        if (prefix === null) {
+            close();
+            return;
+        }
+        pending = setTimeout(function () {
+            fetch("/users/suggest?q=" + encodeURIComponent(prefix), {
+                credentials: "same-origin",
+                headers: { "Accept": "application/json" }
+            })
+                .then(function (response) {
+                    return response.ok ? response.json() : [];
+                })
+                .then(function (usernames) {
+                    if (query(input) === prefix) {
+                        show(input, usernames);
+                    }
+                })
+                .catch(close);
+        }, 150);
+    });
+
+    document.addEventListener("keydown", function (event) {
+        if (list.hidden || event.target !== field) {
+            return;
+        }
+        switch (event.key) {
+            case "ArrowDown":
+                select(active + 1);
+                break;
+            case "ArrowUp":
+                select(active - 1);
+                break;
+            case "Enter":
+            case "Tab":
+                insert(list.children[active].textContent.slice(1));
+                break;
+            case "Escape":
+                close();
+                break;
+            default:
+                return;
+        }
+        event.preventDefault();
+    });
+
+    document.addEventListener("focusout", function (event) {
+        if (event.target === field) {
+            close();
+        }
+    });
+})();
@@ -0,0 +1,49 @@
+// Notifications en temps réel : la cloche passe à l'état "non lu" et un toast s'affiche
+// à chaque notification poussée par /notification/stream. EventSource se reconnecte seul
+// en renvoyant Last-Event-ID ; une réponse d'erreur (déconnexion, trop d'onglets) arrête le flux.
+(function () {
+    var bell = document.querySelector('.notification-btn img[alt="notification"]');
+    if (!bell || !window.EventSource) {
+        return;
+    }
+    var images = [
+        "/static/images/bell-notification-social-media-vide.png",
+        "/static/images/bell-notification-social-media-plein.png"
+    ];
+
+    function setUnread(count) {
+        bell.src = images[count > 0 ? 1 : 0];
+    }
+
+    function toast(notification) {
+        var container = document.querySelector(".toast-container");
+        if (!container) {
+            container = document.createElement("div");
+            container.className = "toast-container";
+            document.body.appendChild(container);
+        }
+
+        var item = document.createElement("a");
+        item.className = "toast";
+        item.href = notification.link;
+        item.textContent = notification.text;
+        container.appendChild(item);
+
+        setTimeout(function () {
+            item.classList.add("toast-hide");
+            setTimeout(function () {
+                item.remove();
+            }, 500);
+        }, 6000);
+    }
+
+    var source = new EventSource("/notification/stream");
+    source.addEventListener("unread", function (event) {
+        setUnread(JSON.parse(event.data).unread);
+    });
+    source.addEventListener("notification", function (event) {
+        var notification = JSON.parse(event.data);
+        setUnread(notification.unread);
+        toast(notification);
+    });
+})();
@@ -0,0 +1,57 @@
+// Votes sans rechargement : les formulaires .vote-form sont envoyés en JSON
+// et tous les boutons de la même cible sont mis à jour avec la réponse.
+// Sans JavaScript, le formulaire est envoyé normalement et le serveur redirige vers return_to.
+(function () {
+    var images = {
+        like: ["/static/images/heart.png", "/static/images/heartplein.png"],
+        dislike: ["/static/images/heart-slash.png", "/static/images/heart-slashplein.png"]
+    };
+
+    function update(form, state) {
+        var action = form.querySelector('input[name="action"]').value;
+        var count = state.counts[action] || 0;
+        var button = form.querySelector("button");
+
+        if (images[action]) {
+            var img = button.querySelector("img");
+            if (img) {
+                img.src = images[action][state.mine === action ? 1 : 0];
+            }
+            var counter = form.nextElementSibling;
+            if (counter && counter.tagName === "SPAN") {
+                counter.textContent = count;
+            }
+            return;
+        }
+
+        button.classList.toggle("active", state.mine === action);
+        button.textContent = button.dataset.emoji + (count ? " " + count : "");
+    }
+
+    document.addEventListener("submit", function (event) {
+        var form = event.target;
+        if (!form.classList || !form.classList.contains("vote-form") || !window.fetch) {
+            return;
+        }
+        event.preventDefault();
+
+        var target = form.getAttribute("action");
+        fetch(target, {
+            method: "POST",
+            headers: { "Accept": "application/json" },
+            body: new URLSearchParams(new FormData(form)),
+            credentials: "same-origin"
+        }).then(function (response) {
+            if (!response.ok) {
+                throw new Error(response.status);
+            }
+            return response.json();
+        }).then(function (state) {
+            document.querySelectorAll('form.vote-form[action="' + target + '"]').forEach(function (f) {
+                update(f, state);
+            });
+        }).catch(function () {
+            form.submit();
+        });
+    });
+})();